@@ -1,8 +1,44 @@
 package v1
 
 const (
-	StroomClusterFinalizerName = "stroomcluster.finalizers.stroom.gchq.github.io"
-	WaitNodeTasksFinalizerName = "waitnodetasks.finalizers.stroom.gchq.github.io"
+	StroomClusterFinalizerName   = "stroomcluster.finalizers.stroom.gchq.github.io"
+	WaitNodeTasksFinalizerName   = "waitnodetasks.finalizers.stroom.gchq.github.io"
+	DatabaseRestoreFinalizerName = "databaserestore.finalizers.stroom.gchq.github.io"
+
+	// RestoreInProgressAnnotation is set on a StroomCluster while a DatabaseRestore is running against its database.
+	// The value is the `namespace/name` of the DatabaseRestore. While present, all NodeSets are scaled to zero.
+	RestoreInProgressAnnotation = "stroom.gchq.github.io/restore-in-progress"
+
+	// DatabaseRoleLabel is set on each Pod of a group-replicated DatabaseServer, to either `primary` or `secondary`.
+	// The primary Service selects the Pod labelled `primary`.
+	DatabaseRoleLabel = "stroom.gchq.github.io/database-role"
+
+	// ConfigHashAnnotation is set on a Pod template to a digest of the configuration mounted by its Pods, so they are
+	// restarted when it changes
+	ConfigHashAnnotation = "stroom.gchq.github.io/config-hash"
+
+	// RotateCredentialsAnnotation requests the passwords of a DatabaseServer be rotated, whenever its value changes
+	RotateCredentialsAnnotation = "stroom.gchq.github.io/rotate-credentials"
+
+	// CredentialsRotatedAnnotation is set on the Pod template of each NodeSet to the time the passwords of its
+	// DatabaseServer were last rotated, so the Stroom nodes are restarted with the new passwords
+	CredentialsRotatedAnnotation = "stroom.gchq.github.io/credentials-rotated"
+
+	// NodeEnabledAnnotation is set on a Stroom node Pod once the operator has enabled the node and its jobs. Its value
+	// is the restart count of the Stroom container, so the node is enabled again whenever the container restarts.
+	NodeEnabledAnnotation = "stroom.gchq.github.io/node-enabled"
+
+	// PodTemplateHashAnnotation is set on the StatefulSet of each NodeSet to a digest of its Pod template, so the
+	// operator can drain each node before a change to the template is rolled out to its Pod
+	PodTemplateHashAnnotation = "stroom.gchq.github.io/pod-template-hash"
+
+	// NodeDrainStartedAnnotation is set on a Stroom node Pod to the time the operator disabled its jobs, ahead of the
+	// Pod being replaced by a rolling update
+	NodeDrainStartedAnnotation = "stroom.gchq.github.io/drain-started"
+
+	// NodeDrainedAnnotation is set on a terminating Stroom node Pod once its node has no running tasks. The pre-stop hook
+	// of the Pod waits for it before the Stroom container is stopped.
+	NodeDrainedAnnotation = "stroom.gchq.github.io/drained"
 
 	// SecretFileMode is the file mode to use for Secret volume mounts
 	SecretFileMode int32 = 0400
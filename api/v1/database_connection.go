@@ -1,5 +1,7 @@
 package v1
 
+import corev1 "k8s.io/api/core/v1"
+
 type DatabaseServerRef struct {
 	// If specified, point to an operator-managed DatabaseServer object
 	// +optional
@@ -8,7 +10,8 @@ type DatabaseServerRef struct {
 	// This allows external database instances to be used in place of an operator-managed one.
 	ServerAddress ServerAddress `json:"serverAddress,omitempty"`
 	// UserName is the name of the Stroom database user to use when connecting to the server.
-	// A corresponding key should exist in the provided Secret referenced by SecretName.
+	// Unless the password is read from `passwordSecretKeyRef` or `passwordFile`, a corresponding key should exist in
+	// the provided Secret referenced by SecretName.
 	// +kubebuilder:default:=stroomuser
 	UserName string `json:"userName,omitempty"`
 }
@@ -21,4 +24,29 @@ type ServerAddress struct {
 	Port int32 `json:"port,omitempty"`
 	// SecretName is the name of the secret containing the `password` of the database user `stroomuser`
 	SecretName string `json:"secretName,omitempty"`
+	// PasswordSecretKeyRef selects the Secret key containing the password of the database user, where the key is not
+	// named after the user. Takes precedence over SecretName.
+	// +optional
+	PasswordSecretKeyRef *corev1.SecretKeySelector `json:"passwordSecretKeyRef,omitempty"`
+	// PasswordFile reads the password of the database user from a file, such as one mounted by the Secrets Store CSI
+	// driver, rather than a Secret
+	// +optional
+	PasswordFile *PasswordFileSource `json:"passwordFile,omitempty"`
+	// CaSecretName is the name of a Secret containing the CA certificate (`ca.crt`) that issued the certificate of the
+	// database server. If specified, connections use TLS and the identity of the server is verified.
+	// +optional
+	CaSecretName string `json:"caSecretName,omitempty"`
+}
+
+// PasswordFileSource is a file containing the password of a database user, within a volume
+type PasswordFileSource struct {
+	// Volume containing the password file. It is mounted in Stroom Pods and database backup and restore Jobs.
+	Volume corev1.VolumeSource `json:"volume"`
+	// Path of the password file, relative to the root of the volume
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+	// Path of the password file within the operator container. The same volume must be mounted in the operator
+	// Deployment, so the operator can connect to the database.
+	// +kubebuilder:validation:MinLength=1
+	OperatorPath string `json:"operatorPath"`
 }
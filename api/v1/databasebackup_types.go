@@ -33,18 +33,170 @@ type DatabaseBackupSpec struct {
 	DatabaseServerRef DatabaseServerRef `json:"databaseServerRef"`
 	// Backup the specified database names. If unspecified, all user databases are backed up
 	DatabaseNames []string `json:"databaseNames,omitempty"`
-	// File system location to store the backup files
-	TargetVolume corev1.VolumeSource `json:"volume"`
+	// File system location to store the backup files. Either this or ObjectStorage must be specified.
+	// +optional
+	TargetVolume *corev1.VolumeSource `json:"volume,omitempty"`
+	// S3-compatible object store to stream the backup files to. Either this or TargetVolume must be specified.
+	// +optional
+	ObjectStorage *BackupObjectStorage `json:"objectStorage,omitempty"`
 	// Cron schedule that determines how often backups are to be performed
 	Schedule string `json:"schedule"`
+	// Policy determining which archives are retained after each successful backup. If unspecified, archives are
+	// retained indefinitely.
+	Retention BackupRetention `json:"retention,omitempty"`
+	// Restore drills, in which archives are loaded into a temporary MySQL server and checked for the expected tables.
+	// If unspecified, archives are not verified.
+	// +optional
+	Verify *BackupVerification `json:"verify,omitempty"`
 }
 
+// BackupObjectStorage defines an S3-compatible bucket that backup archives are uploaded to
+type BackupObjectStorage struct {
+	// Image containing the AWS CLI (e.g. `amazon/aws-cli`), used to upload archives
+	// +kubebuilder:validation:Required
+	Image           Image             `json:"image"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Name of the bucket to upload archives to
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+	// Key prefix under which archives are stored (e.g. `stroom/prod`)
+	Prefix string `json:"prefix,omitempty"`
+	// URL of an S3-compatible service (e.g. `http://minio.minio.svc:9000`). If unspecified, AWS S3 is used.
+	// Path-style addressing is used when an endpoint is specified.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region of the bucket
+	// +kubebuilder:default:=us-east-1
+	Region string `json:"region,omitempty"`
+	// Name of a Secret in the same namespace containing the keys `accessKeyId` and `secretAccessKey`
+	// +kubebuilder:validation:MinLength=1
+	CredentialsSecretName string `json:"credentialsSecretName"`
+	// Server-side encryption algorithm to apply to uploaded archives
+	// +kubebuilder:validation:Enum=AES256;"aws:kms"
+	ServerSideEncryption string `json:"serverSideEncryption,omitempty"`
+	// ID of the KMS key used when ServerSideEncryption is `aws:kms`. If unspecified, the AWS managed key is used.
+	KmsKeyId string `json:"kmsKeyId,omitempty"`
+}
+
+// BackupRetention determines which backup archives are retained. An archive is retained if it satisfies any of the
+// specified rules. The most recent archive is always retained.
+type BackupRetention struct {
+	// Retain this number of the most recent archives
+	// +kubebuilder:validation:Minimum:=0
+	KeepLast int `json:"keepLast,omitempty"`
+	// Retain all archives created within this number of days
+	// +kubebuilder:validation:Minimum:=0
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+	// Retain the most recent archive of each of this number of days
+	// +kubebuilder:validation:Minimum:=0
+	KeepDaily int `json:"keepDaily,omitempty"`
+	// Retain the most recent archive of each of this number of weeks
+	// +kubebuilder:validation:Minimum:=0
+	KeepWeekly int `json:"keepWeekly,omitempty"`
+	// Retain the most recent archive of each of this number of months
+	// +kubebuilder:validation:Minimum:=0
+	KeepMonthly int `json:"keepMonthly,omitempty"`
+}
+
+// IsZero returns whether no retention rules are specified, in which case archives are never pruned
+func (in *BackupRetention) IsZero() bool {
+	return in.KeepLast == 0 && in.MaxAgeDays == 0 && in.KeepDaily == 0 && in.KeepWeekly == 0 && in.KeepMonthly == 0
+}
+
+// BackupVerification defines how backup archives are verified to be restorable
+type BackupVerification struct {
+	// Image of the MySQL server the archive is loaded into. This should be the same version as the source database
+	// server. If unspecified, the DatabaseBackup image is used.
+	// +optional
+	Image           Image             `json:"image,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Cron schedule on which to verify the most recent archive. If unspecified, each archive is verified once the
+	// backup that produced it completes.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+	// Tables that must exist in the archive, with the minimum number of rows each is expected to contain. If
+	// unspecified, the core Stroom tables in the `stroom` and `stats` databases are checked.
+	// +optional
+	Tables []BackupTableCheck `json:"tables,omitempty"`
+	// Resources allocated to the temporary MySQL server
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// BackupTableCheck defines a table that is expected to exist in a backup archive
+type BackupTableCheck struct {
+	// +kubebuilder:validation:Pattern=`^[0-9A-Za-z_$]{1,64}$`
+	Database string `json:"database"`
+	// +kubebuilder:validation:Pattern=`^[0-9A-Za-z_$]{1,64}$`
+	Table string `json:"table"`
+	// Minimum number of rows the table is expected to contain
+	// +kubebuilder:validation:Minimum=0
+	MinRows int64 `json:"minRows,omitempty"`
+}
+
+// Condition types reported in DatabaseBackupStatus
+const (
+	// BackupReadyCondition indicates whether the most recent backup Job succeeded
+	BackupReadyCondition = "Ready"
+	// BackupVerifiedCondition indicates whether the most recently verified archive could be restored
+	BackupVerifiedCondition = "Verified"
+)
+
 // DatabaseBackupStatus defines the observed state of DatabaseBackup
 type DatabaseBackupStatus struct {
+	// ObservedGeneration is the most recent DatabaseBackup generation processed by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the outcome of the most recent backup
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LastScheduleTime is when a backup Job was last scheduled by the CronJob
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulTime is when the last successful backup Job completed
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// LastFailureTime is when the last failed backup Job finished
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+	// LastArchivePath is the path of the archive written to the backup volume by the last successful backup
+	LastArchivePath string `json:"lastArchivePath,omitempty"`
+	// LastArchiveSizeBytes is the size of the archive written by the last successful backup
+	LastArchiveSizeBytes int64 `json:"lastArchiveSizeBytes,omitempty"`
+	// LastObjectUrl is the URL of the archive uploaded to object storage by the last successful backup
+	LastObjectUrl string `json:"lastObjectUrl,omitempty"`
+	// ConsecutiveFailures is the number of backup Jobs that have failed since the last successful backup
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+	// Verification reports the outcome of the most recent restore drill
+	Verification BackupVerificationStatus `json:"verification,omitempty"`
+}
+
+// BackupVerificationStatus defines the outcome of verifying backup archives
+type BackupVerificationStatus struct {
+	// LastRunTime is when the last verification Job finished, successfully or not
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+	// LastSuccessfulTime is when an archive was last verified successfully
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// ArchivePath is the path of the archive checked by the last verification Job, relative to the backup volume or
+	// object storage prefix
+	ArchivePath string `json:"archivePath,omitempty"`
+	// VerifiedTables is the number of tables checked by the last successful verification
+	VerifiedTables int `json:"verifiedTables,omitempty"`
+}
+
+// GetLastFinishedTime returns when the most recent backup Job recorded in the status finished, successfully or not
+func (in *DatabaseBackupStatus) GetLastFinishedTime() *metav1.Time {
+	if in.LastFailureTime == nil || (in.LastSuccessfulTime != nil && in.LastSuccessfulTime.After(in.LastFailureTime.Time)) {
+		return in.LastSuccessfulTime
+	}
+
+	return in.LastFailureTime
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Last Success",type="date",JSONPath=`.status.lastSuccessfulTime`
+//+kubebuilder:printcolumn:name="Failures",type=integer,JSONPath=`.status.consecutiveFailures`
+//+kubebuilder:printcolumn:name="Verified",type=string,priority=1,JSONPath=`.status.conditions[?(@.type=="Verified")].status`
+//+kubebuilder:printcolumn:name="Archive",type=string,priority=1,JSONPath=`.status.lastArchivePath`
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 
 // DatabaseBackup is the Schema for the databasebackups API
 type DatabaseBackup struct {
@@ -60,6 +212,21 @@ func (in *DatabaseBackup) GetBaseName() string {
 	return fmt.Sprintf("stroom-%v-db-backup", in.Name)
 }
 
+// GetVerifyCronJobName returns the name of the CronJob that verifies archives on a separate schedule
+func (in *DatabaseBackup) GetVerifyCronJobName() string {
+	return TruncateName(fmt.Sprintf("%v-verify", in.GetBaseName()), CronJobNameMaxLength)
+}
+
+// GetVerifyJobName returns the name of the Job that verifies the archive produced by a backup Job
+func (in *DatabaseBackup) GetVerifyJobName(backupJobName string) string {
+	return TruncateName(fmt.Sprintf("%v-verify", backupJobName), JobNameMaxLength)
+}
+
+// GetScriptsConfigMapName returns the name of the ConfigMap containing the scripts run by backup Jobs
+func (in *DatabaseBackup) GetScriptsConfigMapName() string {
+	return fmt.Sprintf("%v-scripts", in.GetBaseName())
+}
+
 func (in *DatabaseBackup) GetLabels() map[string]string {
 	return map[string]string{
 		"app.kubernetes.io/name":      "stroom",
@@ -68,6 +235,13 @@ func (in *DatabaseBackup) GetLabels() map[string]string {
 	}
 }
 
+// GetVerifyLabels returns the labels of Jobs that verify the archives of this DatabaseBackup
+func (in *DatabaseBackup) GetVerifyLabels() map[string]string {
+	labels := in.GetLabels()
+	labels["app.kubernetes.io/component"] = "database-backup-verify"
+	return labels
+}
+
 //+kubebuilder:object:root=true
 
 // DatabaseBackupList contains a list of DatabaseBackup
@@ -0,0 +1,150 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LatestArchivePath selects the most recent archive produced by a DatabaseBackup
+const LatestArchivePath = "latest"
+
+// DatabaseRestoreSpec defines the desired state of DatabaseRestore
+type DatabaseRestoreSpec struct {
+	// +kubebuilder:validation:Required
+	Image           Image             `json:"image"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// DatabaseServerRef contains either the details of a DatabaseServer resource, or the TCP connection details of
+	// an external MySQL database, to restore the archive to
+	// +kubebuilder:validation:Required
+	DatabaseServerRef DatabaseServerRef `json:"databaseServerRef"`
+	// Name of the DatabaseBackup in the same namespace that produced the archive. Required if `archivePath` is
+	// `latest`, or if `volume` is not specified.
+	BackupName string `json:"backupName,omitempty"`
+	// File system location containing the backup archives. If unspecified, the volume of the DatabaseBackup is used.
+	// +optional
+	SourceVolume *corev1.VolumeSource `json:"volume,omitempty"`
+	// Path of the archive to restore, relative to the root of the volume (e.g. `2026-10/dev_2026-10-17_01-00-00.sql.gz`).
+	// If `latest`, the most recent archive produced by the DatabaseBackup is restored.
+	// +kubebuilder:default:=latest
+	ArchivePath string `json:"archivePath,omitempty"`
+	// Restore the database to its state at this time, by replaying the archived binary logs of the database server
+	// after restoring the archive. If `archivePath` is `latest`, the most recent archive taken before this time is
+	// restored. Requires binary logs to be shipped to the volume of the DatabaseBackup.
+	// +optional
+	PointInTime *metav1.Time `json:"pointInTime,omitempty"`
+}
+
+type DatabaseRestorePhase string
+
+const (
+	// RestorePendingPhase indicates the restore has not yet started
+	RestorePendingPhase DatabaseRestorePhase = "Pending"
+	// RestoreScalingDownPhase indicates the restore is waiting for the nodes of StroomClusters using the database
+	// to shut down
+	RestoreScalingDownPhase DatabaseRestorePhase = "ScalingDown"
+	// RestoreRestoringPhase indicates the restore Job is running
+	RestoreRestoringPhase DatabaseRestorePhase = "Restoring"
+	// RestoreCompletedPhase indicates the archive was restored and StroomClusters scaled back up
+	RestoreCompletedPhase DatabaseRestorePhase = "Completed"
+	// RestoreFailedPhase indicates the restore Job failed. StroomClusters are scaled back up.
+	RestoreFailedPhase DatabaseRestorePhase = "Failed"
+)
+
+// DatabaseRestoreStatus defines the observed state of DatabaseRestore
+type DatabaseRestoreStatus struct {
+	// Phase of the restore
+	Phase DatabaseRestorePhase `json:"phase,omitempty"`
+	// StroomClusters scaled down for the duration of the restore, in the form `namespace/name`
+	StroomClusters []string `json:"stroomClusters,omitempty"`
+	// JobName is the name of the `Job` performing the restore
+	JobName string `json:"jobName,omitempty"`
+	// ArchivePath is the path of the archive restored, relative to the root of the volume
+	ArchivePath string `json:"archivePath,omitempty"`
+	// BinaryLogFiles is the number of archived binary log files replayed for a point-in-time restore
+	BinaryLogFiles int `json:"binaryLogFiles,omitempty"`
+	// Time the restore started
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Time the restore completed or failed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message describes the restore progress, or the reason it failed
+	Message string `json:"message,omitempty"`
+}
+
+// IsFinished returns whether the restore has completed or failed
+func (in *DatabaseRestoreStatus) IsFinished() bool {
+	return in.Phase == RestoreCompletedPhase || in.Phase == RestoreFailedPhase
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Archive",type=string,JSONPath=`.status.archivePath`
+//+kubebuilder:printcolumn:name="Point In Time",type=string,priority=1,JSONPath=`.spec.pointInTime`
+//+kubebuilder:printcolumn:name="Message",type=string,priority=1,JSONPath=`.status.message`
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseRestore is the Schema for the databaserestores API
+type DatabaseRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseRestoreSpec   `json:"spec,omitempty"`
+	Status DatabaseRestoreStatus `json:"status,omitempty"`
+}
+
+func (in *DatabaseRestore) GetBaseName() string {
+	return fmt.Sprintf("stroom-%v-db-restore", in.Name)
+}
+
+// GetJobName returns the name of the Job that restores the archive
+func (in *DatabaseRestore) GetJobName() string {
+	return TruncateName(in.GetBaseName(), JobNameMaxLength)
+}
+
+// GetScriptsConfigMapName returns the name of the ConfigMap containing the scripts run by the restore Job
+func (in *DatabaseRestore) GetScriptsConfigMapName() string {
+	return TruncateName(fmt.Sprintf("%v-scripts", in.GetBaseName()), JobNameMaxLength)
+}
+
+func (in *DatabaseRestore) GetLabels() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":      "stroom",
+		"app.kubernetes.io/component": "database-restore",
+		"app.kubernetes.io/instance":  in.Name,
+	}
+}
+
+func (in *DatabaseRestore) IsBeingDeleted() bool {
+	return !in.ObjectMeta.DeletionTimestamp.IsZero()
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseRestoreList contains a list of DatabaseRestore
+type DatabaseRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseRestore{}, &DatabaseRestoreList{})
+}
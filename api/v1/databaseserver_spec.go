@@ -6,8 +6,27 @@ import corev1 "k8s.io/api/core/v1"
 type DatabaseServerSpec struct {
 	Image           Image             `json:"image"`
 	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
-	// Names of the databases to be created on startup (if they don't already exist)
+	// How the MySQL instances are deployed. Cannot be changed once the DatabaseServer is created.
+	// +kubebuilder:default:=Standalone
+	Topology DatabaseServerTopology `json:"topology,omitempty"`
+	// Number of MySQL instances. Must be 1 for a `Standalone` server, and between 3 and 9 for `GroupReplication`.
+	// +kubebuilder:default:=1
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=9
+	Replicas int32 `json:"replicas,omitempty"`
+	// Names of the databases to be created (if they don't already exist). The Stroom service user is granted all
+	// privileges on each of them. May be empty for a multi-tenant server.
+	// +optional
 	DatabaseNames []string `json:"databaseNames"`
+	// If true, the DatabaseServer may be claimed by multiple StroomClusters. Each is given its own MySQL user and
+	// databases, named after the StroomCluster (e.g. `stroom_<cluster>`). Cannot be changed once the DatabaseServer
+	// is created.
+	// +optional
+	MultiTenant bool `json:"multiTenant,omitempty"`
+	// Names of databases to drop, which must not be listed in `databaseNames`. Databases removed from `databaseNames`
+	// are otherwise retained, with the privileges of the Stroom service user revoked.
+	// +optional
+	DropDatabaseNames []string `json:"dropDatabaseNames,omitempty"`
 	// Any additional configuration lines to append to the MySQL server configuration file `/etc/my.cnf`
 	AdditionalConfig      []string                         `json:"additionalConfig,omitempty"`
 	Resources             corev1.ResourceRequirements      `json:"resources"`
@@ -20,4 +39,77 @@ type DatabaseServerSpec struct {
 	NodeSelector          map[string]string                `json:"nodeSelector,omitempty"`
 	Tolerations           []corev1.Toleration              `json:"tolerations,omitempty"`
 	Affinity              corev1.Affinity                  `json:"affinity,omitempty"`
+	// TLS Secret containing the server certificate/key pair (tls.crt and tls.key) and the CA certificate (ca.crt).
+	// If specified, clients must connect using TLS. The certificate must be valid for the DNS names of the Services
+	// and Pods of the DatabaseServer.
+	// +optional
+	Tls TlsSettings `json:"tls,omitempty"`
+	// When the passwords of the root and Stroom service users are rotated. If unspecified, they are only rotated on
+	// demand, by changing the value of the annotation `stroom.gchq.github.io/rotate-credentials`.
+	// +optional
+	CredentialRotation CredentialRotationPolicy `json:"credentialRotation,omitempty"`
+	// Binary logging, allowing the database to be restored to a point in time. If unspecified, binary logs are not
+	// archived.
+	// +optional
+	BinaryLog *BinaryLogSettings `json:"binaryLog,omitempty"`
+	// Export MySQL server metrics to Prometheus, using a mysqld_exporter sidecar. If unspecified, metrics are not
+	// exported.
+	// +optional
+	Metrics *DatabaseMetricsSettings `json:"metrics,omitempty"`
+}
+
+// DatabaseServerTopology is the way in which the MySQL instances of a DatabaseServer are deployed
+// +kubebuilder:validation:Enum=Standalone;GroupReplication
+type DatabaseServerTopology string
+
+const (
+	// StandaloneTopology deploys a single MySQL instance
+	StandaloneTopology DatabaseServerTopology = "Standalone"
+	// GroupReplicationTopology deploys a MySQL group replication set in single-primary mode. Clients connect to the
+	// primary, which is elected automatically if it fails.
+	GroupReplicationTopology DatabaseServerTopology = "GroupReplication"
+)
+
+// CredentialRotationPolicy defines when database user passwords are rotated
+type CredentialRotationPolicy struct {
+	// Number of days between rotations. If 0, passwords are only rotated on demand.
+	// +kubebuilder:validation:Minimum=0
+	IntervalDays int `json:"intervalDays,omitempty"`
+}
+
+// BinaryLogSettings defines how MySQL binary logs are written and archived
+type BinaryLogSettings struct {
+	// Name of a DatabaseBackup in the same namespace, to whose volume and/or object storage closed binary log files
+	// are shipped. The DatabaseBackup should back up this DatabaseServer.
+	// +kubebuilder:validation:MinLength=1
+	BackupName string `json:"backupName"`
+	// Number of days binary log files are kept on the database server before being purged
+	// +kubebuilder:default:=7
+	// +kubebuilder:validation:Minimum=1
+	ExpireDays int `json:"expireDays,omitempty"`
+	// Size in megabytes at which a binary log file is closed and a new one started. Smaller files are shipped
+	// sooner, reducing the amount of data lost if the database server fails.
+	// +kubebuilder:default:=100
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=1024
+	MaxFileSizeMB int `json:"maxFileSizeMB,omitempty"`
+	// How often to check for closed binary log files to ship
+	// +kubebuilder:default:=30
+	// +kubebuilder:validation:Minimum=1
+	ShipIntervalSeconds int `json:"shipIntervalSeconds,omitempty"`
+	// Number of days archived binary log files are retained. If 0, they are retained indefinitely.
+	// +kubebuilder:validation:Minimum=0
+	ArchiveRetentionDays int `json:"archiveRetentionDays,omitempty"`
+	// Resources allocated to the container shipping binary log files
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// DatabaseMetricsSettings defines how MySQL server metrics are exported
+type DatabaseMetricsSettings struct {
+	// mysqld_exporter image
+	// +kubebuilder:default:={repository: "prom/mysqld-exporter", tag: "v0.17.2"}
+	Image           Image             `json:"image,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Resources allocated to the exporter container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 }
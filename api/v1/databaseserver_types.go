@@ -23,14 +23,73 @@ import (
 
 // DatabaseServerStatus defines the observed state of DatabaseServer
 type DatabaseServerStatus struct {
-	State   string `json:"state"`
+	// Generation of the DatabaseServer spec most recently applied to its child objects
+	// +optional
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	State              string `json:"state"`
+	// Service through which clients connect to the writable primary
 	Address string `json:"address"`
 	Port    int32  `json:"port"`
+	// Progress of the most recent credential rotation
+	// +optional
+	CredentialRotation CredentialRotationStatus `json:"credentialRotation,omitempty"`
+	// Databases that exist and are granted to the Stroom service user
+	// +optional
+	Databases []string `json:"databases,omitempty"`
+	// MySQL users created for the StroomClusters claiming a multi-tenant DatabaseServer
+	// +optional
+	TenantUsers []string `json:"tenantUsers,omitempty"`
+	// Name of the Pod currently acting as the writable primary of the replication group
+	// +optional
+	Primary string `json:"primary,omitempty"`
+	// State of each member of the replication group
+	// +optional
+	Members []DatabaseServerMember `json:"members,omitempty"`
+}
+
+// CredentialRotationStatus describes the progress of credential rotation
+type CredentialRotationStatus struct {
+	// When the passwords were last changed
+	// +optional
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+	// Value of the `stroom.gchq.github.io/rotate-credentials` annotation most recently acted upon
+	// +optional
+	LastRequest string `json:"lastRequest,omitempty"`
+	// Set while Stroom nodes are being restarted with the new passwords. Until they have, the previous passwords
+	// remain valid.
+	// +optional
+	PendingDiscard bool `json:"pendingDiscard,omitempty"`
+}
+
+// DatabaseServerClaim records a StroomCluster sharing a multi-tenant DatabaseServer, and the MySQL user and
+// databases created for it
+type DatabaseServerClaim struct {
+	StroomClusterRef ResourceRef `json:"stroomClusterRef"`
+	// MySQL user created for the StroomCluster
+	UserName string `json:"userName"`
+	// Secret in the namespace of the StroomCluster, containing the password of the user in the key `userName`
+	SecretName string `json:"secretName"`
+	// Databases created for the StroomCluster, on which its user is granted all privileges
+	DatabaseNames []string `json:"databaseNames"`
+}
+
+// DatabaseServerMember describes the state of a MySQL instance within a replication group
+type DatabaseServerMember struct {
+	// Name of the Pod running the MySQL instance
+	Name string `json:"name"`
+	// Group replication member state, e.g. `ONLINE`, `RECOVERING` or `OFFLINE`. `UNREACHABLE` if the instance could
+	// not be queried.
+	State string `json:"state"`
+	// `PRIMARY` or `SECONDARY`, if the member is part of the group
+	// +optional
+	Role string `json:"role,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+//+kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.spec.replicas`
+//+kubebuilder:printcolumn:name="Primary",type=string,JSONPath=`.status.primary`,priority=1
 //+kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 
 // DatabaseServer is the Schema for the databases API
@@ -45,6 +104,11 @@ type DatabaseServer struct {
 	// This is used to prevent the DatabaseServer from being deleted while its paired StroomCluster still exists.
 	// +optional
 	StroomClusterRef ResourceRef `json:"stroomClusterRef,omitempty"`
+
+	// Set by the controller when StroomClusters claim a multi-tenant DatabaseServer. The DatabaseServer is not
+	// deleted until each of the StroomClusters has been.
+	// +optional
+	StroomClusterClaims []DatabaseServerClaim `json:"stroomClusterClaims,omitempty"`
 }
 
 // GetBaseName creates a name incorporating the name of the database. For Example: stroom-prod-db
@@ -60,6 +124,31 @@ func (in *DatabaseServer) GetLabels() map[string]string {
 	}
 }
 
+// GetClaim returns the claim of a StroomCluster on a multi-tenant DatabaseServer, or nil if it has not claimed it
+func (in *DatabaseServer) GetClaim(stroomClusterRef ResourceRef) *DatabaseServerClaim {
+	for i := range in.StroomClusterClaims {
+		if in.StroomClusterClaims[i].StroomClusterRef == stroomClusterRef {
+			return &in.StroomClusterClaims[i]
+		}
+	}
+	return nil
+}
+
+// IsGroupReplicated returns whether the MySQL instances form a replication group
+func (in *DatabaseServer) IsGroupReplicated() bool {
+	return in.Spec.Topology == GroupReplicationTopology
+}
+
+// GetPodName returns the name of the Pod running the MySQL instance with the specified ordinal
+func (in *DatabaseServer) GetPodName(ordinal int32) string {
+	return fmt.Sprintf("%v-%v", in.GetBaseName(), ordinal)
+}
+
+// GetPodFqdn returns the DNS name of the Pod running the MySQL instance with the specified ordinal
+func (in *DatabaseServer) GetPodFqdn(ordinal int32) string {
+	return fmt.Sprintf("%v.%v", in.GetPodName(ordinal), in.GetServiceFqdn())
+}
+
 func (in *DatabaseServer) GetServiceName() string {
 	return fmt.Sprintf("%v-headless", in.GetBaseName())
 }
@@ -68,6 +157,24 @@ func (in *DatabaseServer) GetServiceFqdn() string {
 	return fmt.Sprintf("%v.%v.svc.cluster.local", in.GetServiceName(), in.Namespace)
 }
 
+// GetPrimaryServiceName returns the name of the Service routing connections to the primary of a replication group
+func (in *DatabaseServer) GetPrimaryServiceName() string {
+	return fmt.Sprintf("%v-primary", in.GetBaseName())
+}
+
+// GetClientServiceName returns the name of the Service clients should connect to. Only the primary of a replication
+// group accepts writes.
+func (in *DatabaseServer) GetClientServiceName() string {
+	if in.IsGroupReplicated() {
+		return in.GetPrimaryServiceName()
+	}
+	return in.GetServiceName()
+}
+
+func (in *DatabaseServer) GetClientServiceFqdn() string {
+	return fmt.Sprintf("%v.%v.svc.cluster.local", in.GetClientServiceName(), in.Namespace)
+}
+
 func (in *DatabaseServer) GetSecretName() string {
 	return fmt.Sprintf("%v", in.GetBaseName())
 }
@@ -80,6 +187,11 @@ func (in *DatabaseServer) GetInitConfigMapName() string {
 	return fmt.Sprintf("%v-init", in.GetBaseName())
 }
 
+// GetScriptsConfigMapName returns the name of the ConfigMap containing the scripts run by the binary log shipper
+func (in *DatabaseServer) GetScriptsConfigMapName() string {
+	return fmt.Sprintf("%v-scripts", in.GetBaseName())
+}
+
 func (in *DatabaseServer) IsBeingDeleted() bool {
 	return !in.ObjectMeta.DeletionTimestamp.IsZero()
 }
@@ -18,6 +18,11 @@ type StroomClusterSpec struct {
 	// +kubebuilder:default:="stroom"
 	// +kubebuilder:validation:MinLength=1
 	AppDatabaseName string `json:"appDatabaseName"`
+	// StatsDatabaseServerRef contains either the details of a DatabaseServer resource, or the TCP connection details of
+	// an external MySQL database, hosting the statistics database. If unspecified, the statistics database is hosted
+	// by the server referenced by DatabaseServerRef.
+	// +optional
+	StatsDatabaseServerRef *DatabaseServerRef `json:"statsDatabaseServerRef,omitempty"`
 	// Name of the statistics database, usually `stats`
 	// +kubebuilder:default:="stats"
 	// +kubebuilder:validation:MinLength=1
@@ -25,6 +30,10 @@ type StroomClusterSpec struct {
 	// Override the Stroom configuration provided to each node, by providing the name of an existing `ConfigMap`
 	// in the same namespace as the `StroomCluster`
 	ConfigMapRef ConfigMapRef `json:"configMapRef,omitempty"`
+	// If `true`, Stroom nodes are restarted by a rolling update when their configuration, scripts or referenced
+	// Secrets change. Set to `false` if configuration changes are hot-reloaded by Stroom or applied manually.
+	// +kubebuilder:default:=true
+	RolloutOnConfigChange bool `json:"rolloutOnConfigChange"`
 	// Configures OpenID to enable operator components to query the Stroom API
 	OpenId OpenIdConfiguration `json:"openId"`
 	// HTTPS settings. Omit to use plain-text (HTTP)
@@ -37,8 +46,19 @@ type StroomClusterSpec struct {
 	// Amount of time granted to nodes to drain their active tasks before being terminated
 	// +kubebuilder:default:=60
 	NodeTerminationPeriodSecs int64 `json:"nodeTerminationPeriodSecs"`
+	// Maximum time (in minutes) to wait for nodes being removed by a scale-down to finish their tasks. Once exceeded,
+	// the nodes are stopped regardless.
+	// +kubebuilder:default:=60
+	// +kubebuilder:validation:Minimum:=1
+	ScaleDownDrainTimeoutMins int `json:"scaleDownDrainTimeoutMins,omitempty"`
+	// Decommission Stroom nodes removed from the cluster, so other nodes stop trying to contact them
+	// +kubebuilder:default:={}
+	NodeDecommission NodeDecommissionSettings `json:"nodeDecommission,omitempty"`
 	// Delete Stroom node `PersistentVolumeClaim`s in accordance with this policy
 	VolumeClaimDeletePolicy VolumeClaimDeletePolicy `json:"volumeClaimDeletePolicy,omitempty"`
+	// Upgrade controls how a change to the Stroom image is rolled out across NodeSets
+	// +kubebuilder:default:={}
+	Upgrade UpgradeSettings `json:"upgrade,omitempty"`
 
 	// Each NodeSet is a functional grouping of Stroom nodes with a particular role, within the cluster.
 	// It is recommended two NodeSets should be provided: one for storing and processing data and a separate one for
@@ -58,6 +78,19 @@ type StroomClusterSpec struct {
 	LogSender LogSenderSettings `json:"logSender,omitempty"`
 }
 
+type NodeDecommissionSettings struct {
+	// If `true`, Stroom nodes that no longer have a Pod or a place in a NodeSet are disabled
+	// +kubebuilder:default:=false
+	Enabled bool `json:"enabled,omitempty"`
+	// Time (in minutes) a node must have been removed before it is decommissioned
+	// +kubebuilder:default:=10
+	// +kubebuilder:validation:Minimum:=0
+	GracePeriodMins int `json:"gracePeriodMins"`
+	// If `true`, the job assignments of decommissioned nodes are deleted. They are recreated if the node starts again.
+	// +kubebuilder:default:=false
+	PurgeJobs bool `json:"purgeJobs,omitempty"`
+}
+
 type ConfigMapRef struct {
 	// Name of the `ConfigMap`
 	Name string `json:"name,omitempty"`
@@ -26,13 +26,94 @@ const (
 	NodeSetLabel       = "stroom/nodeSet"
 )
 
+// Condition types reported in StroomClusterStatus
+const (
+	// DatabaseReadyCondition indicates whether the Stroom database server is resolved and accepting connections
+	DatabaseReadyCondition = "DatabaseReady"
+	// ConfigReadyCondition indicates whether the Stroom configuration and lifecycle script ConfigMaps are reconciled
+	ConfigReadyCondition = "ConfigReady"
+	// NodeSetsReadyCondition indicates whether every NodeSet has its desired number of ready replicas
+	NodeSetsReadyCondition = "NodeSetsReady"
+	// IngressReadyCondition indicates whether the Stroom Ingress resources are reconciled
+	IngressReadyCondition = "IngressReady"
+	// DrainingCondition is true while Stroom nodes are being drained of tasks prior to shutdown
+	DrainingCondition = "Draining"
+	// UpgradingCondition is true while a new Stroom image is being rolled out
+	UpgradingCondition = "Upgrading"
+)
+
 // StroomClusterStatus defines the observed state of StroomCluster
 type StroomClusterStatus struct {
+	// ObservedGeneration is the most recent StroomCluster generation processed by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the current state of the StroomCluster and its dependencies
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// NodeSets reports the replica counts of each NodeSet StatefulSet
+	NodeSets []NodeSetStatus `json:"nodeSets,omitempty"`
+	// ReadyNodes summarises the number of ready Stroom nodes vs. the desired number (e.g. `3/4`)
+	ReadyNodes string `json:"readyNodes,omitempty"`
+	// Nodes lists the names of all Stroom nodes in the cluster
 	Nodes []string `json:"nodes,omitempty"`
+	// Image is the Stroom image that all NodeSets were last successfully deployed with
+	Image string `json:"image,omitempty"`
+	// Upgrade reports the progress of the most recent Stroom version upgrade
+	Upgrade UpgradeStatus `json:"upgrade,omitempty"`
+	// RemovedNodeSets reports the NodeSets removed from the spec, whose nodes are being drained before they are deleted
+	RemovedNodeSets []NodeSetStatus `json:"removedNodeSets,omitempty"`
+	// DepartedNodes lists Stroom nodes removed from the cluster that are awaiting decommissioning
+	DepartedNodes []DepartedNode `json:"departedNodes,omitempty"`
+}
+
+type DepartedNode struct {
+	// Name of the Stroom node
+	Name string `json:"name"`
+	// Time the node was first found to have been removed. Used to enforce the decommissioning grace period.
+	DepartedTime metav1.Time `json:"departedTime"`
+}
+
+type NodeSetStatus struct {
+	// Name of the NodeSet
+	Name string `json:"name"`
+	// DesiredReplicas is the number of nodes requested by the NodeSet `count`
+	DesiredReplicas int32 `json:"desiredReplicas"`
+	// Replicas is the number of Pods created by the NodeSet StatefulSet
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of NodeSet Pods with a Ready condition
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// UpdatedReplicas is the number of NodeSet Pods running the current StatefulSet revision
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+	// ScaleDown reports the progress of draining the nodes being removed from the NodeSet
+	ScaleDown *NodeSetScaleDownStatus `json:"scaleDown,omitempty"`
+}
+
+type NodeSetScaleDownStatus struct {
+	// TargetReplicas is the number of nodes the NodeSet is being scaled down to
+	TargetReplicas int32 `json:"targetReplicas"`
+	// DrainingNodes lists the nodes being drained before they are removed
+	DrainingNodes []string `json:"drainingNodes,omitempty"`
+	// RemainingTasks is the number of tasks still running on the draining nodes
+	RemainingTasks int `json:"remainingTasks"`
+	// Time the nodes started draining. Used to enforce the drain timeout.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Message describes the drain progress
+	Message string `json:"message,omitempty"`
+}
+
+func (in *NodeSetStatus) IsReady() bool {
+	return in.ReadyReplicas == in.DesiredReplicas && in.UpdatedReplicas == in.DesiredReplicas
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="NodeSetsReady")].status`
+//+kubebuilder:printcolumn:name="Nodes",type=string,JSONPath=`.status.readyNodes`
+//+kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.spec.image.tag`
+//+kubebuilder:printcolumn:name="Database",type=string,priority=1,JSONPath=`.status.conditions[?(@.type=="DatabaseReady")].status`
+//+kubebuilder:printcolumn:name="Draining",type=string,priority=1,JSONPath=`.status.conditions[?(@.type=="Draining")].status`
+//+kubebuilder:printcolumn:name="Upgrade",type=string,priority=1,JSONPath=`.status.upgrade.phase`
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 
 // StroomCluster is the Schema for the stroomclusters API
 type StroomCluster struct {
@@ -47,6 +128,21 @@ func (in *StroomCluster) GetBaseName() string {
 	return fmt.Sprintf("stroom-%v", in.Name)
 }
 
+// GetStatsDatabaseServerRef returns the reference to the server hosting the statistics database, which defaults to
+// that hosting the app database
+func (in *StroomCluster) GetStatsDatabaseServerRef() *DatabaseServerRef {
+	if in.Spec.StatsDatabaseServerRef != nil {
+		return in.Spec.StatsDatabaseServerRef
+	}
+	return &in.Spec.DatabaseServerRef
+}
+
+// GetDatabaseSecretName returns the name of the Secret containing the password of the MySQL user created for the
+// StroomCluster on a multi-tenant DatabaseServer
+func (in *StroomCluster) GetDatabaseSecretName(dbServerName string) string {
+	return fmt.Sprintf("%v-%v-db", in.GetBaseName(), dbServerName)
+}
+
 func (in *StroomCluster) GetStaticContentConfigMapName() string {
 	return fmt.Sprintf("%v-static-content", in.GetBaseName())
 }
@@ -63,6 +159,12 @@ func (in *StroomCluster) GetCliJobName(name string) string {
 	return fmt.Sprintf("%v-cli-%v", in.GetBaseName(), name)
 }
 
+// GetPreUpgradeBackupJobName returns the name of the one-off backup Job for an upgrade started by the current
+// generation of the StroomCluster. The name is the same on each reconcile, so the Job is only created once.
+func (in *StroomCluster) GetPreUpgradeBackupJobName() string {
+	return TruncateName(fmt.Sprintf("%v-pre-upgrade-%v", in.GetBaseName(), in.Generation), JobNameMaxLength)
+}
+
 func (in *StroomCluster) GetLabels() map[string]string {
 	return map[string]string{
 		"app.kubernetes.io/name":      "stroom",
@@ -71,6 +173,18 @@ func (in *StroomCluster) GetLabels() map[string]string {
 	}
 }
 
+// GetNodeName returns the Stroom node name of the NodeSet Pod with the specified ordinal
+func (in *StroomCluster) GetNodeName(nodeSet *NodeSet, ordinal int32) string {
+	return fmt.Sprintf("%v-%v", in.GetNodeSetName(nodeSet), ordinal)
+}
+
+// GetNodeSelectorLabels returns the labels selecting the Pods of every NodeSet
+func (in *StroomCluster) GetNodeSelectorLabels() map[string]string {
+	return map[string]string{
+		StroomClusterLabel: in.Name,
+	}
+}
+
 func (in *StroomCluster) GetNodeSetSelectorLabels(nodeSet *NodeSet) map[string]string {
 	return map[string]string{
 		StroomClusterLabel: in.Name,
@@ -94,6 +208,12 @@ func (in *StroomCluster) IsBeingDeleted() bool {
 	return !in.ObjectMeta.DeletionTimestamp.IsZero()
 }
 
+// IsRestoreInProgress returns whether a DatabaseRestore has scaled down the StroomCluster
+func (in *StroomCluster) IsRestoreInProgress() bool {
+	_, exists := in.Annotations[RestoreInProgressAnnotation]
+	return exists
+}
+
 //+kubebuilder:object:root=true
 
 // StroomClusterList contains a list of StroomCluster
@@ -0,0 +1,85 @@
+package v1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+type UpgradeSettings struct {
+	// Name of a `DatabaseBackup` in the same namespace as the `StroomCluster`. If specified, a one-off backup is
+	// performed using the settings of the `DatabaseBackup` before any NodeSets are upgraded.
+	PreUpgradeBackupName string `json:"preUpgradeBackupName,omitempty"`
+	// Names of NodeSets in the order they are to be upgraded. Any NodeSets not listed are upgraded afterwards,
+	// in the order they are defined.
+	NodeSetOrder []string `json:"nodeSetOrder,omitempty"`
+	// Maximum time (in minutes) to wait for the pre-upgrade backup to complete
+	// +kubebuilder:default:=60
+	// +kubebuilder:validation:Minimum:=1
+	BackupTimeoutMins int `json:"backupTimeoutMins,omitempty"`
+	// Maximum time (in minutes) to wait for each NodeSet to become ready once upgraded. If exceeded, the upgrade
+	// is halted and remaining NodeSets continue running the previous version.
+	// +kubebuilder:default:=30
+	// +kubebuilder:validation:Minimum:=1
+	NodeSetReadyTimeoutMins int `json:"nodeSetReadyTimeoutMins,omitempty"`
+}
+
+type UpgradePhase string
+
+const (
+	// UpgradeBackingUpPhase indicates the pre-upgrade database backup is running
+	UpgradeBackingUpPhase UpgradePhase = "BackingUp"
+	// UpgradeRollingOutPhase indicates NodeSets are being upgraded one at a time
+	UpgradeRollingOutPhase UpgradePhase = "RollingOut"
+	// UpgradeCompletePhase indicates all NodeSets are running the target image
+	UpgradeCompletePhase UpgradePhase = "Complete"
+	// UpgradeFailedPhase indicates the upgrade was halted because the backup failed or a NodeSet did not become ready
+	UpgradeFailedPhase UpgradePhase = "Failed"
+	// UpgradeCancelledPhase indicates the image was reverted before the upgrade completed
+	UpgradeCancelledPhase UpgradePhase = "Cancelled"
+)
+
+type UpgradeStatus struct {
+	// Phase of the most recent upgrade
+	Phase UpgradePhase `json:"phase,omitempty"`
+	// FromImage is the image the cluster was running before the upgrade started
+	FromImage string `json:"fromImage,omitempty"`
+	// TargetImage is the image being rolled out
+	TargetImage string `json:"targetImage,omitempty"`
+	// BackupJobName is the name of the `Job` performing the pre-upgrade database backup
+	BackupJobName string `json:"backupJobName,omitempty"`
+	// CurrentNodeSet is the NodeSet currently being upgraded
+	CurrentNodeSet string `json:"currentNodeSet,omitempty"`
+	// CompletedNodeSets lists NodeSets running the target image, with all replicas ready
+	CompletedNodeSets []string `json:"completedNodeSets,omitempty"`
+	// Time the current phase or NodeSet rollout started. Used to enforce timeouts.
+	StepStartTime *metav1.Time `json:"stepStartTime,omitempty"`
+	// Time the upgrade started
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Time the upgrade completed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message describes the upgrade progress, or the reason it failed
+	Message string `json:"message,omitempty"`
+}
+
+// IsInProgress returns whether an upgrade has been started and not yet completed or cancelled.
+// A failed upgrade is still in progress, as it resumes if the cause of the failure is resolved.
+func (in *UpgradeStatus) IsInProgress() bool {
+	return in.Phase == UpgradeBackingUpPhase || in.Phase == UpgradeRollingOutPhase || in.Phase == UpgradeFailedPhase
+}
+
+// IsBackupPending returns whether the pre-upgrade backup is running, or has failed
+func (in *UpgradeStatus) IsBackupPending() bool {
+	return in.Phase == UpgradeBackingUpPhase ||
+		(in.Phase == UpgradeFailedPhase && in.BackupJobName != "" && in.CurrentNodeSet == "" && len(in.CompletedNodeSets) == 0)
+}
+
+// IsNodeSetUpgraded returns whether the named NodeSet is being, or has been, upgraded to the target image
+func (in *UpgradeStatus) IsNodeSetUpgraded(nodeSetName string) bool {
+	if in.CurrentNodeSet == nodeSetName {
+		return true
+	}
+	for _, name := range in.CompletedNodeSets {
+		if name == nodeSetName {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,10 +1,33 @@
 package v1
 
-import "github.com/sethvargo/go-password/password"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/sethvargo/go-password/password"
+)
 
 const passwordSizeBytes = 24
 
+const (
+	// JobNameMaxLength is the longest name of a Job whose Pods are labelled with it
+	JobNameMaxLength = 63
+	// CronJobNameMaxLength is the longest name of a CronJob, leaving room for the suffix of the Jobs it spawns
+	CronJobNameMaxLength = 52
+)
+
 // GeneratePassword creates a password consisting of a random array of bytes
 func GeneratePassword() []byte {
 	return []byte(password.MustGenerate(passwordSizeBytes, 10, 0, false, true))
 }
+
+// TruncateName shortens a name exceeding the maximum length, replacing its end with a digest of the full name, so
+// names sharing a prefix remain distinct
+func TruncateName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	hash := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(hash[:])[:8]
+	return name[:maxLength-len(suffix)] + suffix
+}
@@ -22,9 +22,117 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupObjectStorage) DeepCopyInto(out *BackupObjectStorage) {
+	*out = *in
+	out.Image = in.Image
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupObjectStorage.
+func (in *BackupObjectStorage) DeepCopy() *BackupObjectStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupObjectStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupRetention) DeepCopyInto(out *BackupRetention) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupRetention.
+func (in *BackupRetention) DeepCopy() *BackupRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupTableCheck) DeepCopyInto(out *BackupTableCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupTableCheck.
+func (in *BackupTableCheck) DeepCopy() *BackupTableCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupTableCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupVerification) DeepCopyInto(out *BackupVerification) {
+	*out = *in
+	out.Image = in.Image
+	if in.Tables != nil {
+		in, out := &in.Tables, &out.Tables
+		*out = make([]BackupTableCheck, len(*in))
+		copy(*out, *in)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupVerification.
+func (in *BackupVerification) DeepCopy() *BackupVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupVerificationStatus) DeepCopyInto(out *BackupVerificationStatus) {
+	*out = *in
+	if in.LastRunTime != nil {
+		in, out := &in.LastRunTime, &out.LastRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupVerificationStatus.
+func (in *BackupVerificationStatus) DeepCopy() *BackupVerificationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupVerificationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BinaryLogSettings) DeepCopyInto(out *BinaryLogSettings) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BinaryLogSettings.
+func (in *BinaryLogSettings) DeepCopy() *BinaryLogSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(BinaryLogSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigMapRef) DeepCopyInto(out *ConfigMapRef) {
 	*out = *in
@@ -40,13 +148,47 @@ func (in *ConfigMapRef) DeepCopy() *ConfigMapRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRotationPolicy) DeepCopyInto(out *CredentialRotationPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRotationPolicy.
+func (in *CredentialRotationPolicy) DeepCopy() *CredentialRotationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRotationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRotationStatus) DeepCopyInto(out *CredentialRotationStatus) {
+	*out = *in
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRotationStatus.
+func (in *CredentialRotationStatus) DeepCopy() *CredentialRotationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRotationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseBackup) DeepCopyInto(out *DatabaseBackup) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseBackup.
@@ -103,13 +245,28 @@ func (in *DatabaseBackupList) DeepCopyObject() runtime.Object {
 func (in *DatabaseBackupSpec) DeepCopyInto(out *DatabaseBackupSpec) {
 	*out = *in
 	out.Image = in.Image
-	out.DatabaseServerRef = in.DatabaseServerRef
+	in.DatabaseServerRef.DeepCopyInto(&out.DatabaseServerRef)
 	if in.DatabaseNames != nil {
 		in, out := &in.DatabaseNames, &out.DatabaseNames
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
-	in.TargetVolume.DeepCopyInto(&out.TargetVolume)
+	if in.TargetVolume != nil {
+		in, out := &in.TargetVolume, &out.TargetVolume
+		*out = new(corev1.VolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ObjectStorage != nil {
+		in, out := &in.ObjectStorage, &out.ObjectStorage
+		*out = new(BackupObjectStorage)
+		**out = **in
+	}
+	out.Retention = in.Retention
+	if in.Verify != nil {
+		in, out := &in.Verify, &out.Verify
+		*out = new(BackupVerification)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseBackupSpec.
@@ -125,6 +282,26 @@ func (in *DatabaseBackupSpec) DeepCopy() *DatabaseBackupSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseBackupStatus) DeepCopyInto(out *DatabaseBackupStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+	in.Verification.DeepCopyInto(&out.Verification)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseBackupStatus.
@@ -137,14 +314,151 @@ func (in *DatabaseBackupStatus) DeepCopy() *DatabaseBackupStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseMetricsSettings) DeepCopyInto(out *DatabaseMetricsSettings) {
+	*out = *in
+	out.Image = in.Image
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseMetricsSettings.
+func (in *DatabaseMetricsSettings) DeepCopy() *DatabaseMetricsSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseMetricsSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseRestore) DeepCopyInto(out *DatabaseRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseRestore.
+func (in *DatabaseRestore) DeepCopy() *DatabaseRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DatabaseRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseRestoreList) DeepCopyInto(out *DatabaseRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DatabaseRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseRestoreList.
+func (in *DatabaseRestoreList) DeepCopy() *DatabaseRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DatabaseRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseRestoreSpec) DeepCopyInto(out *DatabaseRestoreSpec) {
+	*out = *in
+	out.Image = in.Image
+	in.DatabaseServerRef.DeepCopyInto(&out.DatabaseServerRef)
+	if in.SourceVolume != nil {
+		in, out := &in.SourceVolume, &out.SourceVolume
+		*out = new(corev1.VolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PointInTime != nil {
+		in, out := &in.PointInTime, &out.PointInTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseRestoreSpec.
+func (in *DatabaseRestoreSpec) DeepCopy() *DatabaseRestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseRestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseRestoreStatus) DeepCopyInto(out *DatabaseRestoreStatus) {
+	*out = *in
+	if in.StroomClusters != nil {
+		in, out := &in.StroomClusters, &out.StroomClusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseRestoreStatus.
+func (in *DatabaseRestoreStatus) DeepCopy() *DatabaseRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseServer) DeepCopyInto(out *DatabaseServer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	out.StroomClusterRef = in.StroomClusterRef
+	if in.StroomClusterClaims != nil {
+		in, out := &in.StroomClusterClaims, &out.StroomClusterClaims
+		*out = make([]DatabaseServerClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServer.
@@ -165,6 +479,27 @@ func (in *DatabaseServer) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseServerClaim) DeepCopyInto(out *DatabaseServerClaim) {
+	*out = *in
+	out.StroomClusterRef = in.StroomClusterRef
+	if in.DatabaseNames != nil {
+		in, out := &in.DatabaseNames, &out.DatabaseNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServerClaim.
+func (in *DatabaseServerClaim) DeepCopy() *DatabaseServerClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseServerClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseServerList) DeepCopyInto(out *DatabaseServerList) {
 	*out = *in
@@ -197,11 +532,26 @@ func (in *DatabaseServerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseServerMember) DeepCopyInto(out *DatabaseServerMember) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServerMember.
+func (in *DatabaseServerMember) DeepCopy() *DatabaseServerMember {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseServerMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseServerRef) DeepCopyInto(out *DatabaseServerRef) {
 	*out = *in
 	out.ServerRef = in.ServerRef
-	out.ServerAddress = in.ServerAddress
+	in.ServerAddress.DeepCopyInto(&out.ServerAddress)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServerRef.
@@ -223,6 +573,11 @@ func (in *DatabaseServerSpec) DeepCopyInto(out *DatabaseServerSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DropDatabaseNames != nil {
+		in, out := &in.DropDatabaseNames, &out.DropDatabaseNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.AdditionalConfig != nil {
 		in, out := &in.AdditionalConfig, &out.AdditionalConfig
 		*out = make([]string, len(*in))
@@ -256,6 +611,18 @@ func (in *DatabaseServerSpec) DeepCopyInto(out *DatabaseServerSpec) {
 		}
 	}
 	in.Affinity.DeepCopyInto(&out.Affinity)
+	out.Tls = in.Tls
+	out.CredentialRotation = in.CredentialRotation
+	if in.BinaryLog != nil {
+		in, out := &in.BinaryLog, &out.BinaryLog
+		*out = new(BinaryLogSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = new(DatabaseMetricsSettings)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServerSpec.
@@ -271,6 +638,22 @@ func (in *DatabaseServerSpec) DeepCopy() *DatabaseServerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseServerStatus) DeepCopyInto(out *DatabaseServerStatus) {
 	*out = *in
+	in.CredentialRotation.DeepCopyInto(&out.CredentialRotation)
+	if in.Databases != nil {
+		in, out := &in.Databases, &out.Databases
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TenantUsers != nil {
+		in, out := &in.TenantUsers, &out.TenantUsers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]DatabaseServerMember, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServerStatus.
@@ -283,6 +666,22 @@ func (in *DatabaseServerStatus) DeepCopy() *DatabaseServerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DepartedNode) DeepCopyInto(out *DepartedNode) {
+	*out = *in
+	in.DepartedTime.DeepCopyInto(&out.DepartedTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DepartedNode.
+func (in *DepartedNode) DeepCopy() *DepartedNode {
+	if in == nil {
+		return nil
+	}
+	out := new(DepartedNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HttpsSettings) DeepCopyInto(out *HttpsSettings) {
 	*out = *in
@@ -363,6 +762,21 @@ func (in *LogSenderSettings) DeepCopy() *LogSenderSettings {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeDecommissionSettings) DeepCopyInto(out *NodeDecommissionSettings) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeDecommissionSettings.
+func (in *NodeDecommissionSettings) DeepCopy() *NodeDecommissionSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeDecommissionSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeSet) DeepCopyInto(out *NodeSet) {
 	*out = *in
@@ -439,6 +853,50 @@ func (in *NodeSet) DeepCopy() *NodeSet {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeSetScaleDownStatus) DeepCopyInto(out *NodeSetScaleDownStatus) {
+	*out = *in
+	if in.DrainingNodes != nil {
+		in, out := &in.DrainingNodes, &out.DrainingNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeSetScaleDownStatus.
+func (in *NodeSetScaleDownStatus) DeepCopy() *NodeSetScaleDownStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeSetScaleDownStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeSetStatus) DeepCopyInto(out *NodeSetStatus) {
+	*out = *in
+	if in.ScaleDown != nil {
+		in, out := &in.ScaleDown, &out.ScaleDown
+		*out = new(NodeSetScaleDownStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeSetStatus.
+func (in *NodeSetStatus) DeepCopy() *NodeSetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeSetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpenIdConfiguration) DeepCopyInto(out *OpenIdConfiguration) {
 	*out = *in
@@ -455,6 +913,22 @@ func (in *OpenIdConfiguration) DeepCopy() *OpenIdConfiguration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PasswordFileSource) DeepCopyInto(out *PasswordFileSource) {
+	*out = *in
+	in.Volume.DeepCopyInto(&out.Volume)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PasswordFileSource.
+func (in *PasswordFileSource) DeepCopy() *PasswordFileSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PasswordFileSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProbeTimings) DeepCopyInto(out *ProbeTimings) {
 	*out = *in
@@ -503,6 +977,16 @@ func (in *SecretItem) DeepCopy() *SecretItem {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServerAddress) DeepCopyInto(out *ServerAddress) {
 	*out = *in
+	if in.PasswordSecretKeyRef != nil {
+		in, out := &in.PasswordSecretKeyRef, &out.PasswordSecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PasswordFile != nil {
+		in, out := &in.PasswordFile, &out.PasswordFile
+		*out = new(PasswordFileSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerAddress.
@@ -578,11 +1062,18 @@ func (in *StroomClusterList) DeepCopyObject() runtime.Object {
 func (in *StroomClusterSpec) DeepCopyInto(out *StroomClusterSpec) {
 	*out = *in
 	out.Image = in.Image
-	out.DatabaseServerRef = in.DatabaseServerRef
+	in.DatabaseServerRef.DeepCopyInto(&out.DatabaseServerRef)
+	if in.StatsDatabaseServerRef != nil {
+		in, out := &in.StatsDatabaseServerRef, &out.StatsDatabaseServerRef
+		*out = new(DatabaseServerRef)
+		(*in).DeepCopyInto(*out)
+	}
 	out.ConfigMapRef = in.ConfigMapRef
 	out.OpenId = in.OpenId
 	out.Https = in.Https
 	out.Ingress = in.Ingress
+	out.NodeDecommission = in.NodeDecommission
+	in.Upgrade.DeepCopyInto(&out.Upgrade)
 	if in.NodeSets != nil {
 		in, out := &in.NodeSets, &out.NodeSets
 		*out = make([]NodeSet, len(*in))
@@ -632,11 +1123,40 @@ func (in *StroomClusterSpec) DeepCopy() *StroomClusterSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StroomClusterStatus) DeepCopyInto(out *StroomClusterStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NodeSets != nil {
+		in, out := &in.NodeSets, &out.NodeSets
+		*out = make([]NodeSetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Nodes != nil {
 		in, out := &in.Nodes, &out.Nodes
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	in.Upgrade.DeepCopyInto(&out.Upgrade)
+	if in.RemovedNodeSets != nil {
+		in, out := &in.RemovedNodeSets, &out.RemovedNodeSets
+		*out = make([]NodeSetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DepartedNodes != nil {
+		in, out := &in.DepartedNodes, &out.DepartedNodes
+		*out = make([]DepartedNode, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StroomClusterStatus.
@@ -753,3 +1273,55 @@ func (in *TlsSettings) DeepCopy() *TlsSettings {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeSettings) DeepCopyInto(out *UpgradeSettings) {
+	*out = *in
+	if in.NodeSetOrder != nil {
+		in, out := &in.NodeSetOrder, &out.NodeSetOrder
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeSettings.
+func (in *UpgradeSettings) DeepCopy() *UpgradeSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeStatus) DeepCopyInto(out *UpgradeStatus) {
+	*out = *in
+	if in.CompletedNodeSets != nil {
+		in, out := &in.CompletedNodeSets, &out.CompletedNodeSets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StepStartTime != nil {
+		in, out := &in.StepStartTime, &out.StepStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeStatus.
+func (in *UpgradeStatus) DeepCopy() *UpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
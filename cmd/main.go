@@ -21,6 +21,7 @@ import (
 	"os"
 
 	controllers2 "github.com/gradata-systems/stroom-k8s-operator/internal/controller"
+	webhookv1 "github.com/gradata-systems/stroom-k8s-operator/internal/webhook/v1"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -34,6 +35,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -54,7 +56,15 @@ func init() {
 func main() {
 	var enableLeaderElection bool
 	var probeAddr string
+	var enableWebhooks bool
+	var webhookCertPath string
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the validating and defaulting admission webhooks. "+
+			"Requires a TLS certificate and key in the webhook certificate path.")
+	flag.StringVar(&webhookCertPath, "webhook-cert-path", "",
+		"The directory containing the webhook server certificate (tls.crt) and key (tls.key). "+
+			"Defaults to the controller-runtime serving certificate directory.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -71,6 +81,9 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "81fe7dea.gchq.github.io",
+		WebhookServer: webhook.NewServer(webhook.Options{
+			CertDir: webhookCertPath,
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -85,8 +98,9 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers2.DatabaseServerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("databaseserver-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DatabaseServer")
 		os.Exit(1)
@@ -99,12 +113,43 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers2.DatabaseBackupReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("databasebackup-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DatabaseBackup")
 		os.Exit(1)
 	}
+	if err = (&controllers2.DatabaseRestoreReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("databaserestore-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseRestore")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		if err = webhookv1.SetupStroomClusterWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "StroomCluster")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupDatabaseServerWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DatabaseServer")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupStroomTaskAutoscalerWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "StroomTaskAutoscaler")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupDatabaseBackupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DatabaseBackup")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupDatabaseRestoreWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DatabaseRestore")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
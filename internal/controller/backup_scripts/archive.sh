@@ -0,0 +1,41 @@
+#!/bin/bash
+#
+# Locates an archive of the DatabaseBackup ${BACKUP_NAME} within ${BACKUP_DIR}. Sourced by restore.sh and verify.sh.
+#
+
+#
+# Filters the archive paths read from stdin, printing those created at or before the time $1, which has the form
+# `YYYY-MM-DD_HH-MM-SS`. All paths are printed if $1 is empty.
+#
+function archives_not_after() {
+  local file timestamp
+  while IFS= read -r file; do
+    timestamp=$(basename "${file}" .sql.gz)
+    timestamp="${timestamp#"${BACKUP_NAME}_"}"
+    if [ -z "$1" ] || [[ ! "${timestamp}" > "$1" ]]; then
+      echo "${file}"
+    fi
+  done
+}
+
+#
+# Sets archive_path to the archive identified by ${ARCHIVE_PATH}, which is either a path relative to ${BACKUP_DIR} or
+# `latest` for the most recent archive. If $1 is specified, `latest` selects the most recent archive created at or
+# before that time, in the form `YYYY-MM-DD_HH-MM-SS`. Returns failure if the archive does not exist.
+#
+function find_archive() {
+  if [ "${ARCHIVE_PATH}" = "latest" ]; then
+    archive_path=$(find "${BACKUP_DIR}" -mindepth 2 -maxdepth 2 -type f -name "${BACKUP_NAME}_*.sql.gz" | sort |
+      archives_not_after "$1" | tail -n 1)
+    if [ -z "${archive_path}" ]; then
+      echo "No archives of DatabaseBackup '${BACKUP_NAME}' were found${1:+" created before ${1}"}"
+      return 1
+    fi
+  else
+    archive_path="${BACKUP_DIR}/${ARCHIVE_PATH}"
+    if [ ! -f "${archive_path}" ]; then
+      echo "Archive '${ARCHIVE_PATH}' does not exist"
+      return 1
+    fi
+  fi
+}
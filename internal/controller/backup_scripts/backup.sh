@@ -0,0 +1,122 @@
+#!/bin/bash
+#
+# Dumps the configured databases to a compressed archive in a YYYY-MM subdirectory of ${BACKUP_DIR}, then prunes
+# archives in accordance with the retention policy. If ${UPLOAD_DIR} is set, the archive is also streamed to a named
+# pipe within it, to be read by upload.sh.
+#
+
+# Fail the Job if mysqldump fails, rather than reporting the success of gzip
+set -eo pipefail
+
+source "$(dirname "$0")/client.sh"
+source "$(dirname "$0")/retention.sh"
+
+archive_name="$(date +'%Y-%m')/${BACKUP_NAME}_$(date +'%Y-%m-%d_%H-%M-%S').sql.gz"
+archive_path="${BACKUP_DIR}/${archive_name}"
+partial_path="${archive_path}.partial"
+upload_pipe="${UPLOAD_DIR}/archive.sql.gz"
+termination_log='/dev/termination-log'
+
+if [ -n "${UPLOAD_DIR}" ]; then
+  # Report the outcome to upload.sh, so it only retains the upload if the dump succeeded
+  trap 'echo $? > "${UPLOAD_DIR}/exit-code.tmp" && mv "${UPLOAD_DIR}/exit-code.tmp" "${UPLOAD_DIR}/exit-code"' EXIT
+  echo "${archive_name}" > "${UPLOAD_DIR}/archive-name"
+  mkfifo "${upload_pipe}"
+fi
+
+#
+# Writes the compressed dump read from stdin to the backup volume and/or the upload pipe. The archive is written
+# under a temporary name, so an incomplete archive is never restored or counted towards retention.
+#
+function write_archive() {
+  if [ -n "${BACKUP_DIR}" ] && [ -n "${UPLOAD_DIR}" ]; then
+    tee "${partial_path}" > "${upload_pipe}"
+  elif [ -n "${UPLOAD_DIR}" ]; then
+    cat > "${upload_pipe}"
+  else
+    cat > "${partial_path}"
+  fi
+}
+
+#
+# Runs a query against the database server, printing the result without column names
+#
+function query() {
+  mysql "${client_args[@]}" --skip-column-names --execute="$1"
+}
+
+# If binary logging is enabled, record the binary log position and server UUID in the archive, so the archived binary
+# logs can be replayed for a point-in-time restore
+source_data_args=()
+archive_header=''
+if [ "$(query 'SELECT @@log_bin')" = "1" ]; then
+  if mysqldump --help | grep -q -- '--source-data'; then
+    source_data_args=(--source-data=2)
+  else
+    source_data_args=(--master-data=2)
+  fi
+  archive_header="-- Server UUID: $(query 'SELECT @@server_uuid')"
+  echo "Binary logging is enabled, recording the binary log position"
+fi
+
+# With GTIDs enabled (as they are for group replication), mysqldump sets GTID_PURGED by default. This cannot be applied
+# to a server that has already executed transactions, such as a member of the same group, so it is left out
+gtid_args=()
+if [ "$(query 'SELECT @@gtid_mode')" = "ON" ]; then
+  gtid_args=(--set-gtid-purged=OFF)
+  echo "GTIDs are enabled, omitting GTID_PURGED from the archive"
+fi
+
+#
+# Writes the archive header (if any), followed by the dump
+#
+function dump() {
+  if [ -n "${archive_header}" ]; then
+    echo "${archive_header}"
+  fi
+  # shellcheck disable=SC2086
+  mysqldump "${client_args[@]}" --single-transaction --no-tablespaces "${source_data_args[@]}" "${gtid_args[@]}" ${database_args}
+}
+
+if [ -n "${DATABASE_NAMES}" ]; then
+  database_args="--databases ${DATABASE_NAMES}"
+  echo "Backing up databases (${DATABASE_NAMES// /,})"
+else
+  database_args="--all-databases"
+  echo "Backing up all databases"
+fi
+
+if [ -n "${BACKUP_DIR}" ]; then
+  echo "Writing archive to: ${archive_path}"
+  mkdir -p "$(dirname "${archive_path}")"
+fi
+dump | gzip | write_archive || {
+  rm -f "${partial_path}"
+  exit 1
+}
+
+if [ -z "${BACKUP_DIR}" ]; then
+  echo "Backup successful"
+  exit 0
+fi
+
+mv "${partial_path}" "${archive_path}"
+chmod 444 "${archive_path}"
+archive_size=$(stat -c '%s' "${archive_path}")
+echo "Backup successful (${archive_size} bytes)"
+
+pruned_count=0
+if retention_enabled; then
+  while IFS= read -r file; do
+    echo "Pruning archive: ${file}"
+    rm -f "${file}"
+    pruned_count=$((pruned_count + 1))
+  done < <(find "${BACKUP_DIR}" -mindepth 2 -maxdepth 2 -type f -name "${BACKUP_NAME}_*.sql.gz" | sort -r | list_expired_archives)
+
+  # Remove any monthly subdirectories left empty
+  find "${BACKUP_DIR}" -mindepth 1 -maxdepth 1 -type d -name '[0-9][0-9][0-9][0-9]-[0-9][0-9]' -empty -delete
+  echo "Pruned ${pruned_count} archive(s)"
+fi
+
+# Report the outcome to the operator
+printf '{"archivePath":"%s","archiveSizeBytes":%s,"prunedCount":%s}' "${archive_path}" "${archive_size}" "${pruned_count}" > "${termination_log}" || true
@@ -0,0 +1,15 @@
+#!/bin/bash
+#
+# Connection arguments of the mysql client tools, shared by backup.sh and restore.sh. If ${MYSQL_PASSWORD_FILE} is set,
+# the password is read from that file. If ${MYSQL_SSL_CA} is set, the connection is encrypted and the identity of the
+# server is verified against that CA certificate.
+#
+
+if [ -n "${MYSQL_PASSWORD_FILE}" ]; then
+  MYSQL_PASSWORD=$(< "${MYSQL_PASSWORD_FILE}")
+fi
+
+client_args=(--user="${MYSQL_USER}" --password="${MYSQL_PASSWORD}" --host="${MYSQL_HOST}" --port="${MYSQL_PORT}")
+if [ -n "${MYSQL_SSL_CA}" ]; then
+  client_args+=(--ssl-mode=VERIFY_IDENTITY --ssl-ca="${MYSQL_SSL_CA}")
+fi
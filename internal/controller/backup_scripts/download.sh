@@ -0,0 +1,26 @@
+#!/bin/bash
+#
+# Downloads an archive of the DatabaseBackup ${BACKUP_NAME} from an S3-compatible object store to ${BACKUP_DIR},
+# preserving its path relative to the key prefix. If ${ARCHIVE_PATH} is `latest`, the most recent archive is
+# downloaded.
+#
+
+set -eo pipefail
+
+source "$(dirname "$0")/s3.sh"
+
+if [ "${ARCHIVE_PATH}" = "latest" ]; then
+  object_key=$(list_archive_keys | tail -n 1 || true)
+  if [ -z "${object_key}" ]; then
+    echo "No archives of DatabaseBackup '${BACKUP_NAME}' were found in s3://${S3_BUCKET}/${prefix}"
+    exit 1
+  fi
+else
+  object_key="${prefix}${ARCHIVE_PATH}"
+fi
+
+archive_path="${BACKUP_DIR}/${object_key#"${prefix}"}"
+echo "Downloading archive: s3://${S3_BUCKET}/${object_key}"
+mkdir -p "$(dirname "${archive_path}")"
+aws "${s3_args[@]}" s3 cp "s3://${S3_BUCKET}/${object_key}" "${archive_path}" --only-show-errors
+echo "Download successful"
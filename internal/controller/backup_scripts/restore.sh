@@ -0,0 +1,56 @@
+#!/bin/bash
+#
+# Restores a compressed archive produced by backup.sh to the database server. If ${ARCHIVE_PATH} is `latest`, the most
+# recent archive of the DatabaseBackup ${BACKUP_NAME} is restored.
+#
+# If ${POINT_IN_TIME} is set (in the form `YYYY-MM-DD HH:MM:SS`), the most recent archive created before that time is
+# selected, and the binary logs archived in ${BACKUP_DIR}/binlog are replayed from the position recorded in the
+# archive, up to that time.
+#
+
+# Fail the Job if the mysql client fails, rather than reporting the success of gunzip
+set -eo pipefail
+
+source "$(dirname "$0")/archive.sh"
+source "$(dirname "$0")/client.sh"
+
+termination_log='/dev/termination-log'
+
+find_archive "$(tr ' :' '_-' <<< "${POINT_IN_TIME}")" || exit 1
+
+binlog_files=()
+if [ -n "${POINT_IN_TIME}" ]; then
+  # Read the server UUID and binary log position recorded by backup.sh. gunzip is stopped early by head.
+  archive_header=$(gunzip -c "${archive_path}" 2> /dev/null | head -n 100 || true)
+  server_uuid=$(sed -n 's/^-- Server UUID: //p' <<< "${archive_header}")
+  binlog_position=$(grep -m 1 -oE "(SOURCE|MASTER)_LOG_FILE='[^']+', *(SOURCE|MASTER)_LOG_POS=[0-9]+" <<< "${archive_header}" || true)
+  if [ -z "${server_uuid}" ] || [ -z "${binlog_position}" ]; then
+    echo "Archive ${archive_path} does not record a binary log position. Binary logging must be enabled when the backup is taken."
+    exit 1
+  fi
+  start_file=$(sed -E "s/.*_LOG_FILE='([^']+)'.*/\1/" <<< "${binlog_position}")
+  start_position="${binlog_position##*=}"
+
+  binlog_dir="${BACKUP_DIR}/binlog/${server_uuid}"
+  mapfile -t binlog_files < <(find "${binlog_dir}" -mindepth 1 -maxdepth 1 -type f -name 'binlog.[0-9]*' 2> /dev/null | sort |
+    awk -v start="${binlog_dir}/${start_file}" '$0 >= start')
+  if [ "${#binlog_files[@]}" -eq 0 ] || [ "${binlog_files[0]}" != "${binlog_dir}/${start_file}" ]; then
+    echo "Binary log ${start_file} of server ${server_uuid} has not been archived"
+    exit 1
+  fi
+fi
+
+echo "Restoring archive: ${archive_path}"
+gunzip -c "${archive_path}" | mysql "${client_args[@]}"
+
+if [ "${#binlog_files[@]}" -gt 0 ]; then
+  echo "Replaying ${#binlog_files[@]} binary log file(s) from ${start_file}:${start_position} up to ${POINT_IN_TIME}"
+  # Transactions are replayed without their GTIDs, otherwise a server that has already executed them (e.g. the server
+  # the backup was taken from) skips them
+  mysqlbinlog --skip-gtids --start-position="${start_position}" --stop-datetime="${POINT_IN_TIME}" "${binlog_files[@]}" |
+    mysql "${client_args[@]}"
+fi
+echo "Restore successful"
+
+# Report the outcome to the operator
+printf '{"archivePath":"%s","binaryLogFiles":%s}' "${archive_path#"${BACKUP_DIR}/"}" "${#binlog_files[@]}" > "${termination_log}" || true
@@ -0,0 +1,72 @@
+#!/bin/bash
+#
+# Retention rules shared by the backup scripts. A value of zero disables the rule.
+#
+
+: "${KEEP_LAST:=0}" "${MAX_AGE_DAYS:=0}" "${KEEP_DAILY:=0}" "${KEEP_WEEKLY:=0}" "${KEEP_MONTHLY:=0}"
+
+#
+# Returns success if any retention rule is specified
+#
+function retention_enabled() {
+  [ "${KEEP_LAST}" -gt 0 ] || [ "${MAX_AGE_DAYS}" -gt 0 ] || [ "${KEEP_DAILY}" -gt 0 ] ||
+    [ "${KEEP_WEEKLY}" -gt 0 ] || [ "${KEEP_MONTHLY}" -gt 0 ]
+}
+
+#
+# Reads archive paths from stdin, newest first, and prints those that do not satisfy any of the retention rules.
+# The first archive encountered in a given day, week or month is the most recent of that period. The most recent
+# archive is never printed.
+#
+function list_expired_archives() {
+  local now index=0 days=0 weeks=0 months=0
+  local -A seen_days seen_weeks seen_months
+  now=$(date +%s)
+
+  while IFS= read -r file; do
+    local timestamp day week month created keep=0
+    timestamp=$(basename "${file}" .sql.gz)
+    timestamp=${timestamp#"${BACKUP_NAME}_"} # YYYY-MM-DD_HH-MM-SS
+    day=${timestamp:0:10}
+    month=${timestamp:0:7}
+    if ! week=$(date -d "${day}" +'%G-%V' 2>/dev/null); then
+      echo "Skipping archive with unrecognised name: ${file}" >&2
+      index=$((index + 1))
+      continue
+    fi
+    created=$(date -d "${day} ${timestamp:11:2}:${timestamp:14:2}:${timestamp:17:2}" +%s)
+
+    if [ "${index}" -eq 0 ] || [ "${index}" -lt "${KEEP_LAST}" ]; then
+      keep=1
+    fi
+    if [ "${MAX_AGE_DAYS}" -gt 0 ] && [ $((now - created)) -le $((MAX_AGE_DAYS * 86400)) ]; then
+      keep=1
+    fi
+    if [ -z "${seen_days[${day}]}" ]; then
+      seen_days[${day}]=1
+      days=$((days + 1))
+      if [ "${days}" -le "${KEEP_DAILY}" ]; then
+        keep=1
+      fi
+    fi
+    if [ -z "${seen_weeks[${week}]}" ]; then
+      seen_weeks[${week}]=1
+      weeks=$((weeks + 1))
+      if [ "${weeks}" -le "${KEEP_WEEKLY}" ]; then
+        keep=1
+      fi
+    fi
+    if [ -z "${seen_months[${month}]}" ]; then
+      seen_months[${month}]=1
+      months=$((months + 1))
+      if [ "${months}" -le "${KEEP_MONTHLY}" ]; then
+        keep=1
+      fi
+    fi
+
+    if [ "${keep}" -eq 0 ]; then
+      echo "${file}"
+    fi
+    index=$((index + 1))
+  done
+}
@@ -0,0 +1,34 @@
+#!/bin/bash
+#
+# Common settings for scripts accessing the S3-compatible object store. Sourced by upload.sh and download.sh.
+#
+
+s3_args=()
+if [ -n "${S3_ENDPOINT}" ]; then
+  s3_args+=(--endpoint-url "${S3_ENDPOINT}")
+
+  # S3-compatible stores such as MinIO generally require path-style addressing
+  export AWS_CONFIG_FILE=/tmp/aws-config
+  printf '[default]\ns3 =\n  addressing_style = path\n' > "${AWS_CONFIG_FILE}"
+fi
+sse_args=()
+if [ -n "${S3_SSE}" ]; then
+  sse_args+=(--sse "${S3_SSE}")
+fi
+if [ -n "${S3_SSE_KMS_KEY_ID}" ]; then
+  sse_args+=(--sse-kms-key-id "${S3_SSE_KMS_KEY_ID}")
+fi
+
+prefix="${S3_PREFIX%/}"
+if [ -n "${prefix}" ]; then
+  prefix="${prefix}/"
+fi
+prefix_pattern=$(printf '%s' "${prefix}" | sed 's/[][\.*^$()+?{}|]/\\&/g')
+
+#
+# Lists the keys of all archives of the DatabaseBackup ${BACKUP_NAME}, oldest first
+#
+function list_archive_keys() {
+  aws "${s3_args[@]}" s3api list-objects-v2 --bucket "${S3_BUCKET}" --prefix "${prefix}" --query 'Contents[].Key' --output text |
+    tr '\t' '\n' | grep -E "^${prefix_pattern}[0-9]{4}-[0-9]{2}/${BACKUP_NAME}_[^/]+\.sql\.gz$" | sort
+}
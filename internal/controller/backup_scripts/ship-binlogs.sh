@@ -0,0 +1,121 @@
+#!/bin/bash
+#
+# Ships closed MySQL binary log files from ${MYSQL_DATA_DIR} to ${BINLOG_DIR} and/or an S3-compatible object store,
+# under a subdirectory named after the UUID of the database server. Archived files are pruned after
+# ${ARCHIVE_RETENTION_DAYS} days, if set. Runs until the container is stopped.
+#
+# Errors are logged and retried on the next iteration, rather than stopping the container, as the database server Pod
+# is not ready while any of its containers are failing.
+#
+
+if [ -n "${S3_BUCKET}" ]; then
+  source "$(dirname "$0")/s3.sh"
+fi
+
+index_file="${MYSQL_DATA_DIR}/binlog.index"
+shipped_file="${STATE_DIR}/shipped"
+prune_interval_secs=3600
+last_pruned=0
+
+touch "${shipped_file}"
+
+#
+# Copies a binary log file to the archive volume, unless it was archived previously
+#
+function ship_to_volume() {
+  local dest_dir="${BINLOG_DIR}/${server_uuid}"
+  local dest_path="${dest_dir}/$1"
+  if [ -f "${dest_path}" ]; then
+    return 0
+  fi
+
+  mkdir -p "${dest_dir}" &&
+    cp "${MYSQL_DATA_DIR}/$1" "${dest_path}.partial" &&
+    mv "${dest_path}.partial" "${dest_path}"
+}
+
+#
+# Uploads a binary log file to object storage, unless it was uploaded previously
+#
+function ship_to_object_storage() {
+  local object_key="${prefix}binlog/${server_uuid}/$1"
+  if aws "${s3_args[@]}" s3api head-object --bucket "${S3_BUCKET}" --key "${object_key}" > /dev/null 2>&1; then
+    return 0
+  fi
+
+  aws "${s3_args[@]}" s3 cp "${MYSQL_DATA_DIR}/$1" "s3://${S3_BUCKET}/${object_key}" "${sse_args[@]}" --only-show-errors
+}
+
+#
+# Ships each binary log file that has been closed since the last iteration
+#
+function ship_closed_logs() {
+  if [ ! -f "${index_file}" ] || [ ! -f "${MYSQL_DATA_DIR}/auto.cnf" ]; then
+    return 0
+  fi
+  server_uuid=$(sed -n 's/^server-uuid=//p' "${MYSQL_DATA_DIR}/auto.cnf")
+
+  local logs
+  mapfile -t logs < "${index_file}"
+  if [ "${#logs[@]}" -lt 2 ]; then
+    return 0
+  fi
+
+  # The last file in the index is still being written to
+  local log name
+  for log in "${logs[@]:0:${#logs[@]}-1}"; do
+    name=$(basename "${log}")
+    if grep -qxF "${name}" "${shipped_file}" || [ ! -f "${MYSQL_DATA_DIR}/${name}" ]; then
+      continue
+    fi
+
+    if [ -n "${BINLOG_DIR}" ] && ! ship_to_volume "${name}"; then
+      echo "Failed to ship binary log ${name} to the backup volume"
+      return 1
+    fi
+    if [ -n "${S3_BUCKET}" ] && ! ship_to_object_storage "${name}"; then
+      echo "Failed to ship binary log ${name} to object storage"
+      return 1
+    fi
+    echo "Shipped binary log: ${name}"
+    echo "${name}" >> "${shipped_file}"
+  done
+}
+
+#
+# Removes archived binary log files older than the retention period
+#
+function prune_archived_logs() {
+  if [ "${ARCHIVE_RETENTION_DAYS:-0}" -eq 0 ]; then
+    return 0
+  fi
+
+  if [ -n "${BINLOG_DIR}" ] && [ -d "${BINLOG_DIR}" ]; then
+    find "${BINLOG_DIR}" -mindepth 2 -maxdepth 2 -type f -name 'binlog.[0-9]*' -mtime +"${ARCHIVE_RETENTION_DAYS}" -print -delete
+  fi
+  if [ -n "${S3_BUCKET}" ]; then
+    local cutoff key
+    cutoff=$(date -u -d "-${ARCHIVE_RETENTION_DAYS} days" +'%Y-%m-%dT%H:%M:%S')
+    aws "${s3_args[@]}" s3api list-objects-v2 --bucket "${S3_BUCKET}" --prefix "${prefix}binlog/" \
+      --query "Contents[?LastModified<'${cutoff}'].Key" --output text | tr '\t' '\n' | grep -v '^None$' |
+      while IFS= read -r key; do
+        if [ -n "${key}" ]; then
+          echo "Pruning binary log: s3://${S3_BUCKET}/${key}"
+          aws "${s3_args[@]}" s3 rm "s3://${S3_BUCKET}/${key}" --only-show-errors
+        fi
+      done
+  fi
+}
+
+echo "Shipping binary logs every ${SHIP_INTERVAL_SECS} seconds"
+while true; do
+  ship_closed_logs
+
+  now=$(date +%s)
+  if [ $((now - last_pruned)) -ge "${prune_interval_secs}" ]; then
+    prune_archived_logs || echo "Failed to prune archived binary logs"
+    last_pruned=${now}
+  fi
+
+  sleep "${SHIP_INTERVAL_SECS}"
+done
@@ -0,0 +1,68 @@
+#!/bin/bash
+#
+# Streams the archive written by backup.sh to the named pipe in ${UPLOAD_DIR}, to an S3-compatible object store.
+# The object is uploaded under a temporary key and only renamed once backup.sh reports success. Objects are then
+# pruned in accordance with the retention policy.
+#
+
+set -eo pipefail
+
+source "$(dirname "$0")/retention.sh"
+source "$(dirname "$0")/s3.sh"
+
+upload_pipe="${UPLOAD_DIR}/archive.sql.gz"
+exit_code_file="${UPLOAD_DIR}/exit-code"
+termination_log='/dev/termination-log'
+wait_timeout_secs=300
+
+#
+# Waits for backup.sh to create the named pipe or exit. Returns failure if neither happens within the timeout.
+#
+function wait_for() {
+  local waited=0
+  until [ -e "$1" ] || [ -f "${exit_code_file}" ]; do
+    if [ "${waited}" -ge "${wait_timeout_secs}" ]; then
+      return 1
+    fi
+    sleep 1
+    waited=$((waited + 1))
+  done
+}
+
+if ! wait_for "${upload_pipe}"; then
+  echo "Timed out waiting for the backup to start"
+  exit 1
+elif [ ! -p "${upload_pipe}" ]; then
+  echo "Backup failed before the upload started"
+  exit 1
+fi
+
+object_key="${prefix}$(cat "${UPLOAD_DIR}/archive-name")"
+object_url="s3://${S3_BUCKET}/${object_key}"
+partial_url="${object_url}.partial"
+
+echo "Uploading archive to: ${object_url}"
+aws "${s3_args[@]}" s3 cp - "${partial_url}" "${sse_args[@]}" --only-show-errors < "${upload_pipe}"
+
+# Only retain the upload if the dump succeeded
+if ! wait_for "${exit_code_file}" || [ "$(cat "${exit_code_file}")" != "0" ]; then
+  echo "Backup failed, removing partial upload"
+  aws "${s3_args[@]}" s3 rm "${partial_url}" --only-show-errors || true
+  exit 1
+fi
+aws "${s3_args[@]}" s3 mv "${partial_url}" "${object_url}" "${sse_args[@]}" --only-show-errors
+object_size=$(aws "${s3_args[@]}" s3api head-object --bucket "${S3_BUCKET}" --key "${object_key}" --query ContentLength --output text)
+echo "Upload successful (${object_size} bytes)"
+
+pruned_count=0
+if retention_enabled; then
+  while IFS= read -r key; do
+    echo "Pruning object: s3://${S3_BUCKET}/${key}"
+    aws "${s3_args[@]}" s3 rm "s3://${S3_BUCKET}/${key}" --only-show-errors
+    pruned_count=$((pruned_count + 1))
+  done < <(list_archive_keys | sort -r | list_expired_archives)
+  echo "Pruned ${pruned_count} object(s)"
+fi
+
+# Report the outcome to the operator
+printf '{"objectUrl":"%s","objectSizeBytes":%s,"objectPrunedCount":%s}' "${object_url}" "${object_size}" "${pruned_count}" > "${termination_log}" || true
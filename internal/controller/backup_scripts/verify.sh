@@ -0,0 +1,66 @@
+#!/bin/bash
+#
+# Verifies that an archive produced by backup.sh can be restored, by loading it into a temporary MySQL server and
+# checking that each table listed in ${TABLE_CHECKS} exists and contains the minimum number of rows. Each check has
+# the form `<database>.<table>:<min rows>`.
+#
+
+# Fail the Job if the archive cannot be loaded, rather than reporting the success of gunzip
+set -eo pipefail
+
+source "$(dirname "$0")/archive.sh"
+
+data_dir="${VERIFY_DIR}/data"
+socket="${VERIFY_DIR}/mysqld.sock"
+termination_log='/dev/termination-log'
+startup_timeout_secs=300
+
+find_archive || exit 1
+
+echo "Starting temporary MySQL server"
+mysqld --initialize-insecure --user=mysql --datadir="${data_dir}" --log-error="${VERIFY_DIR}/init.log"
+mysqld --user=mysql --datadir="${data_dir}" --socket="${socket}" --skip-networking --mysqlx=OFF \
+  --pid-file="${VERIFY_DIR}/mysqld.pid" --log-error="${VERIFY_DIR}/mysqld.log" &
+mysqld_pid=$!
+trap 'kill "${mysqld_pid}" 2> /dev/null || true' EXIT
+
+waited=0
+until mysqladmin --user=root --socket="${socket}" ping --silent 2> /dev/null; do
+  if ! kill -0 "${mysqld_pid}" 2> /dev/null || [ "${waited}" -ge "${startup_timeout_secs}" ]; then
+    tail -n 20 "${VERIFY_DIR}/mysqld.log" || true
+    echo "Temporary MySQL server failed to start"
+    exit 1
+  fi
+  sleep 1
+  waited=$((waited + 1))
+done
+
+echo "Loading archive: ${archive_path}"
+gunzip -c "${archive_path}" | mysql --user=root --socket="${socket}"
+
+failed_count=0
+verified_count=0
+for check in ${TABLE_CHECKS}; do
+  table="${check%:*}"
+  min_rows="${check##*:}"
+  if ! row_count=$(mysql --user=root --socket="${socket}" --skip-column-names \
+    --execute="SELECT COUNT(*) FROM \`${table%%.*}\`.\`${table#*.}\`" 2> /dev/null); then
+    echo "Table ${table} does not exist"
+    failed_count=$((failed_count + 1))
+  elif [ "${row_count}" -lt "${min_rows}" ]; then
+    echo "Table ${table} contains ${row_count} row(s), expected at least ${min_rows}"
+    failed_count=$((failed_count + 1))
+  else
+    echo "Table ${table} contains ${row_count} row(s)"
+    verified_count=$((verified_count + 1))
+  fi
+done
+
+if [ "${failed_count}" -gt 0 ]; then
+  echo "Verification of ${archive_path#"${BACKUP_DIR}/"} failed: ${failed_count} table check(s) failed"
+  exit 1
+fi
+echo "Verification successful"
+
+# Report the outcome to the operator
+printf '{"archivePath":"%s","verifiedTables":%s}' "${archive_path#"${BACKUP_DIR}/"}" "${verified_count}" > "${termination_log}" || true
@@ -1 +1,26 @@
 package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// HashConfigData returns a digest of the specified ConfigMap data. Setting it as a Pod template annotation causes the
+// Pods to be restarted whenever the configuration changes.
+func HashConfigData(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(data[key]))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
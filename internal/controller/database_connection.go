@@ -2,10 +2,17 @@ package controller
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -14,6 +21,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// DatabaseQueryTimeout bounds the queries run by the operator to manage a DatabaseServer
+const DatabaseQueryTimeout = time.Second * 30
+
 func GetDatabaseConnectionInfo(client client.Client, ctx context.Context, dbRef *stroomv1.DatabaseServerRef, ownerNamespace string, dbConnectionInfo *DatabaseConnectionInfo) error {
 	logger := log.FromContext(ctx)
 
@@ -23,6 +33,9 @@ func GetDatabaseConnectionInfo(client client.Client, ctx context.Context, dbRef
 		dbConnectionInfo.Host = dbRef.ServerAddress.Host
 		dbConnectionInfo.Port = dbRef.ServerAddress.Port
 		dbConnectionInfo.SecretName = dbRef.ServerAddress.SecretName
+		dbConnectionInfo.PasswordSecretKeyRef = dbRef.ServerAddress.PasswordSecretKeyRef
+		dbConnectionInfo.PasswordFile = dbRef.ServerAddress.PasswordFile
+		dbConnectionInfo.CaSecretName = dbRef.ServerAddress.CaSecretName
 		dbConnectionInfo.UserName = dbRef.UserName
 	} else {
 		// If the ServerRef namespace is empty, try to find the DatabaseServer in the same namespace as the owner
@@ -43,9 +56,10 @@ func GetDatabaseConnectionInfo(client client.Client, ctx context.Context, dbRef
 			return err
 		} else {
 			dbConnectionInfo.DatabaseServer = &dbServer
-			dbConnectionInfo.Host = dbServer.GetServiceFqdn()
+			dbConnectionInfo.Host = dbServer.GetClientServiceFqdn()
 			dbConnectionInfo.Port = DatabasePort
 			dbConnectionInfo.SecretName = dbServer.GetSecretName()
+			dbConnectionInfo.CaSecretName = dbServer.Spec.Tls.SecretName
 			dbConnectionInfo.UserName = dbRef.UserName
 		}
 	}
@@ -53,24 +67,109 @@ func GetDatabaseConnectionInfo(client client.Client, ctx context.Context, dbRef
 	return nil
 }
 
+// GetStroomDatabaseConnectionInfo resolves the servers hosting the app and statistics databases of a StroomCluster.
+// If the StroomCluster does not reference a separate statistics database server, both refer to the same server.
+// On a multi-tenant DatabaseServer, the StroomCluster connects as its own user.
+func GetStroomDatabaseConnectionInfo(client client.Client, ctx context.Context, stroomCluster *stroomv1.StroomCluster, appDbInfo *DatabaseConnectionInfo, statsDbInfo *DatabaseConnectionInfo) error {
+	appDbRef := stroomCluster.Spec.DatabaseServerRef
+	if err := GetDatabaseConnectionInfo(client, ctx, &appDbRef, stroomCluster.Namespace, appDbInfo); err != nil {
+		return err
+	}
+	appDbInfo.useTenant(stroomCluster)
+
+	if stroomCluster.Spec.StatsDatabaseServerRef == nil {
+		*statsDbInfo = *appDbInfo
+		return nil
+	}
+	statsDbRef := *stroomCluster.Spec.StatsDatabaseServerRef
+	if err := GetDatabaseConnectionInfo(client, ctx, &statsDbRef, stroomCluster.Namespace, statsDbInfo); err != nil {
+		return err
+	}
+	if appDbInfo.DatabaseServer != nil && isDatabaseServer(statsDbInfo.DatabaseServer, appDbInfo.DatabaseServer) {
+		// Share the DatabaseServer, so claiming it for one database is seen by the other
+		statsDbInfo.DatabaseServer = appDbInfo.DatabaseServer
+	}
+	statsDbInfo.useTenant(stroomCluster)
+	return nil
+}
+
 func OpenDatabase(client client.Reader, ctx context.Context, dbInfo *DatabaseConnectionInfo, secretNamespace string, databaseName string) (*sql.DB, error) {
+	password, err := GetDatabasePassword(client, ctx, dbInfo, secretNamespace)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := GetDatabaseTlsConfig(client, ctx, dbInfo, secretNamespace)
+	if err != nil {
+		return nil, err
+	}
+	return OpenDatabaseWithPassword(ctx, dbInfo, password, tlsConfig, databaseName)
+}
+
+// GetDatabasePassword returns the password of the database user, from either its Secret key or password file
+func GetDatabasePassword(client client.Reader, ctx context.Context, dbInfo *DatabaseConnectionInfo, secretNamespace string) (string, error) {
 	logger := log.FromContext(ctx)
 
-	// Get password from secret
+	secretKeyRef := dbInfo.getPasswordSecretKeyRef()
+	if secretKeyRef == nil {
+		// The password file volume is mounted in the operator container
+		data, err := os.ReadFile(dbInfo.PasswordFile.OperatorPath)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("Could not read database password from file '%v'", dbInfo.PasswordFile.OperatorPath))
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
 	dbSecret := v1.Secret{}
-	if err := client.Get(ctx, types.NamespacedName{Namespace: secretNamespace, Name: dbInfo.SecretName}, &dbSecret); err != nil {
-		logger.Error(err, fmt.Sprintf("Could not retrieve database password from Secret '%v'", dbInfo.SecretName))
-		return nil, err
+	if err := client.Get(ctx, types.NamespacedName{Namespace: secretNamespace, Name: secretKeyRef.Name}, &dbSecret); err != nil {
+		logger.Error(err, fmt.Sprintf("Could not retrieve database password from Secret '%v'", secretKeyRef.Name))
+		return "", err
+	}
+	password, exists := dbSecret.Data[secretKeyRef.Key]
+	if !exists {
+		return "", fmt.Errorf("secret '%v' does not contain the key '%v'", secretKeyRef.Name, secretKeyRef.Key)
 	}
+	return string(password), nil
+}
+
+// OpenDatabaseWithPassword connects to a database using the specified password, rather than that in the Secret.
+// If tlsConfig is nil, the connection is not encrypted.
+func OpenDatabaseWithPassword(ctx context.Context, dbInfo *DatabaseConnectionInfo, password string, tlsConfig *tls.Config, databaseName string) (*sql.DB, error) {
+	config := mysql.NewConfig()
+	config.User = dbInfo.UserName
+	config.Passwd = password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(dbInfo.Host, strconv.Itoa(int(dbInfo.Port)))
+	config.DBName = databaseName
+	config.TLS = tlsConfig
 
-	password := string(dbSecret.Data[dbInfo.UserName])
-	dataSourceName := fmt.Sprintf("%v:%v@tcp(%v:%v)/%v", dbInfo.UserName, password, dbInfo.Host, dbInfo.Port, databaseName)
-	if db, err := sql.Open("mysql", dataSourceName); err != nil {
-		logger.Error(err, "Could not connect to database", "HostName", dbInfo.Host, "Database", databaseName, "User", dbInfo.UserName)
+	if connector, err := mysql.NewConnector(config); err != nil {
+		log.FromContext(ctx).Error(err, "Could not connect to database", "HostName", dbInfo.Host, "Database", databaseName, "User", dbInfo.UserName)
 		return nil, err
 	} else {
-		return db, nil
+		return sql.OpenDB(connector), nil
+	}
+}
+
+// GetDatabaseTlsConfig returns the TLS configuration used to connect to a database server, trusting the CA
+// certificate in its CA Secret. Returns nil if the server does not use TLS.
+func GetDatabaseTlsConfig(client client.Reader, ctx context.Context, dbInfo *DatabaseConnectionInfo, secretNamespace string) (*tls.Config, error) {
+	if !dbInfo.IsTlsEnabled() {
+		return nil, nil
+	}
+
+	caSecret := v1.Secret{}
+	if err := client.Get(ctx, types.NamespacedName{Namespace: secretNamespace, Name: dbInfo.CaSecretName}, &caSecret); err != nil {
+		log.FromContext(ctx).Error(err, fmt.Sprintf("Could not retrieve database CA certificate from Secret '%v'", dbInfo.CaSecretName))
+		return nil, err
+	}
+
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caSecret.Data[DatabaseCaCertKey]) {
+		return nil, fmt.Errorf("secret '%v' does not contain a valid CA certificate in '%v'", dbInfo.CaSecretName, DatabaseCaCertKey)
 	}
+	// The server name is set by the driver to the host being connected to
+	return &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}, nil
 }
 
 func CloseDatabase(database *sql.DB) {
@@ -78,3 +177,27 @@ func CloseDatabase(database *sql.DB) {
 		// Handle silently
 	}
 }
+
+// queryStrings returns the first column of each row returned by a query
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// quoteString quotes a MySQL string literal, such as a password
+func quoteString(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+}
@@ -2,17 +2,155 @@ package controller
 
 import (
 	"fmt"
+	"path"
 
 	v1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DatabaseCaCertKey is the key of the CA certificate within a TLS Secret
+	DatabaseCaCertKey            = "ca.crt"
+	DatabaseCaVolumeName         = "database-ca"
+	DatabaseCaMountPath          = "/etc/stroom/database-ca"
+	DatabaseTruststoreVolumeName = "database-truststore"
+	DatabaseTruststoreMountPath  = "/stroom/pki/database"
+	DatabasePasswordVolumeName   = "database-password"
+	DatabasePasswordMountPath    = "/etc/stroom/database-password"
+	// Volumes of the statistics database server, where it differs from the app database server
+	StatsDatabaseCaVolumeName       = "stats-database-ca"
+	StatsDatabasePasswordVolumeName = "stats-database-password"
+	StatsDatabasePasswordMountPath  = "/etc/stroom/stats-database-password"
+	// DatabaseTruststorePassword protects the truststore generated from the CA certificate for Stroom. As the
+	// truststore only contains a public certificate, the password is not secret.
+	DatabaseTruststorePassword = "changeit"
 )
 
 type DatabaseConnectionInfo struct {
 	DatabaseServer *v1.DatabaseServer
 	v1.ServerAddress
 	UserName string
+	// Set when connecting to the databases created for a StroomCluster on a multi-tenant DatabaseServer
+	TenantName string
+}
+
+// GetDatabaseName returns the name of a database on the server. The databases of a tenant are suffixed with its name.
+func (dbInfo *DatabaseConnectionInfo) GetDatabaseName(name string) string {
+	if dbInfo.TenantName == "" {
+		return name
+	}
+	return fmt.Sprintf("%v_%v", name, dbInfo.TenantName)
+}
+
+// IsTlsEnabled returns whether connections to the database server use TLS
+func (dbInfo *DatabaseConnectionInfo) IsTlsEnabled() bool {
+	return dbInfo.CaSecretName != ""
 }
 
 func (dbInfo *DatabaseConnectionInfo) ToJdbcConnectionString(databaseName string) string {
-	return fmt.Sprintf("jdbc:mysql://%v:%v/%v?serverTimezone=UTC&useUnicode=yes&characterEncoding=UTF-8",
+	connectionString := fmt.Sprintf("jdbc:mysql://%v:%v/%v?serverTimezone=UTC&useUnicode=yes&characterEncoding=UTF-8",
 		dbInfo.Host, dbInfo.Port, databaseName)
+
+	if dbInfo.IsTlsEnabled() {
+		connectionString += fmt.Sprintf("&sslMode=VERIFY_IDENTITY&trustCertificateKeyStoreUrl=file:%v/truststore.p12"+
+			"&trustCertificateKeyStoreType=PKCS12&trustCertificateKeyStorePassword=%v",
+			DatabaseTruststoreMountPath, DatabaseTruststorePassword)
+	}
+
+	return connectionString
+}
+
+// createCaVolume creates a volume containing the CA certificate used to verify the database server
+func (dbInfo *DatabaseConnectionInfo) createCaVolume(volumeName string) corev1.Volume {
+	return corev1.Volume{
+		Name: volumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: dbInfo.CaSecretName,
+				Items: []corev1.KeyToPath{{
+					Key:  DatabaseCaCertKey,
+					Path: DatabaseCaCertKey,
+				}},
+			},
+		},
+	}
+}
+
+// appendClientTls configures a container running the mysql client tools to connect to the database server using
+// TLS, if enabled. The scripts verify the identity of the server when `MYSQL_SSL_CA` is set.
+func (dbInfo *DatabaseConnectionInfo) appendClientTls(container *corev1.Container, volumes *[]corev1.Volume) {
+	if !dbInfo.IsTlsEnabled() {
+		return
+	}
+
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  "MYSQL_SSL_CA",
+		Value: fmt.Sprintf("%v/%v", DatabaseCaMountPath, DatabaseCaCertKey),
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      DatabaseCaVolumeName,
+		MountPath: DatabaseCaMountPath,
+		ReadOnly:  true,
+	})
+	*volumes = append(*volumes, dbInfo.createCaVolume(DatabaseCaVolumeName))
+}
+
+// getPasswordSecretKeyRef returns the Secret key containing the password of the database user, or nil if the
+// password is read from a file
+func (dbInfo *DatabaseConnectionInfo) getPasswordSecretKeyRef() *corev1.SecretKeySelector {
+	if dbInfo.PasswordSecretKeyRef != nil {
+		return dbInfo.PasswordSecretKeyRef
+	} else if dbInfo.PasswordFile != nil {
+		return nil
+	}
+
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{
+			Name: dbInfo.SecretName,
+		},
+		Key: dbInfo.UserName,
+	}
+}
+
+// getPasswordFilePath returns the path of the password file, where the password file volume is mounted at mountPath
+func (dbInfo *DatabaseConnectionInfo) getPasswordFilePath(mountPath string) string {
+	return path.Join(mountPath, dbInfo.PasswordFile.Path)
+}
+
+// createPasswordVolume creates a volume containing the password file of the database user
+func (dbInfo *DatabaseConnectionInfo) createPasswordVolume(volumeName string) corev1.Volume {
+	return corev1.Volume{
+		Name:         volumeName,
+		VolumeSource: dbInfo.PasswordFile.Volume,
+	}
+}
+
+// createPasswordVolumeMount mounts the password file volume of the database user
+func createPasswordVolumeMount(volumeName string, mountPath string) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      volumeName,
+		MountPath: mountPath,
+		ReadOnly:  true,
+	}
+}
+
+// appendClientPassword provides the password of the database user to a container running the mysql client tools,
+// either in `MYSQL_PASSWORD`, or in the file named by `MYSQL_PASSWORD_FILE`
+func (dbInfo *DatabaseConnectionInfo) appendClientPassword(container *corev1.Container, volumes *[]corev1.Volume) {
+	if secretKeyRef := dbInfo.getPasswordSecretKeyRef(); secretKeyRef != nil {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name: "MYSQL_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: secretKeyRef,
+			},
+		})
+		return
+	}
+
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  "MYSQL_PASSWORD_FILE",
+		Value: dbInfo.getPasswordFilePath(DatabasePasswordMountPath),
+	})
+	container.VolumeMounts = append(container.VolumeMounts, createPasswordVolumeMount(DatabasePasswordVolumeName, DatabasePasswordMountPath))
+	*volumes = append(*volumes, dbInfo.createPasswordVolume(DatabasePasswordVolumeName))
 }
@@ -3,6 +3,7 @@ package controller
 import (
 	"fmt"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -14,27 +15,6 @@ import (
 )
 
 func (r *DatabaseBackupReconciler) createCronJob(dbBackup *stroomv1.DatabaseBackup, dbInfo *DatabaseConnectionInfo) *batchv1.CronJob {
-	const targetDirectory = "/var/lib/mysql/backup"
-	const fileDatePattern = "%Y-%m-%d_%H-%M-%S"
-
-	archiveFileName := fmt.Sprintf("$(date +'%v_%v.sql.gz')", dbBackup.Name, fileDatePattern)
-	backupDirectory := path.Join(targetDirectory, "$(date +'%Y-%m')") // Subdirectory in the format YYYY-MM
-	archivePath := path.Join(backupDirectory, archiveFileName)
-
-	mysqlDumpCommand := "mysqldump --user=${MYSQL_USER} --password=${MYSQL_PASSWORD} --host=${MYSQL_HOST} --port=${MYSQL_PORT} --single-transaction --no-tablespaces"
-	plainTextDatabaseList := ""
-	databaseNames := dbBackup.Spec.DatabaseNames
-	if len(databaseNames) > 0 {
-		mysqlDumpCommand += " --databases " + strings.Join(databaseNames, " ")
-		plainTextDatabaseList = fmt.Sprintf("databases (%v)", strings.Join(databaseNames, ","))
-	} else {
-		mysqlDumpCommand += " --all-databases"
-		plainTextDatabaseList = "all databases"
-	}
-
-	// Retain the CronJob for 5 minutes after it completes
-	var ttlSecondsAfterFinished int32 = 300
-
 	cronJob := &batchv1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      dbBackup.GetBaseName(),
@@ -45,59 +25,35 @@ func (r *DatabaseBackupReconciler) createCronJob(dbBackup *stroomv1.DatabaseBack
 			Schedule:          dbBackup.Spec.Schedule,
 			ConcurrencyPolicy: batchv1.ForbidConcurrent,
 			JobTemplate: batchv1.JobTemplateSpec{
-				Spec: batchv1.JobSpec{
-					TTLSecondsAfterFinished: &ttlSecondsAfterFinished,
-					Template: corev1.PodTemplateSpec{
-						Spec: corev1.PodSpec{
-							RestartPolicy: corev1.RestartPolicyOnFailure,
-							Containers: []corev1.Container{{
-								Name:            "backup-job",
-								Image:           dbBackup.Spec.Image.String(),
-								ImagePullPolicy: dbBackup.Spec.ImagePullPolicy,
-								Command: []string{
-									"bash",
-									"-c",
-									fmt.Sprintf("archivePath=\"%v\"", archivePath) + "\n" +
-										fmt.Sprintf("echo \"Backing up %v to: $archivePath\"", plainTextDatabaseList) + "\n" +
-										fmt.Sprintf("mkdir -p %v", backupDirectory) + "\n" +
-										fmt.Sprintf("%v | gzip > \"$archivePath\"", mysqlDumpCommand) + "\n" +
-										"if [ -f \"$archivePath\" ]; then\n" +
-										"  chmod 444 \"$archivePath\"\n" +
-										"  echo \"Backup successful\"\n" +
-										"fi",
-								},
-								Env: []corev1.EnvVar{{
-									Name:  "MYSQL_HOST",
-									Value: dbInfo.Host,
-								}, {
-									Name:  "MYSQL_PORT",
-									Value: strconv.Itoa(int(dbInfo.Port)),
-								}, {
-									Name:  "MYSQL_USER",
-									Value: dbInfo.UserName,
-								}, {
-									Name: "MYSQL_PASSWORD",
-									ValueFrom: &corev1.EnvVarSource{
-										SecretKeyRef: &corev1.SecretKeySelector{
-											LocalObjectReference: corev1.LocalObjectReference{
-												Name: dbInfo.SecretName,
-											},
-											Key: dbInfo.UserName,
-										},
-									},
-								}},
-								VolumeMounts: []corev1.VolumeMount{{
-									Name:      "data",
-									MountPath: "/var/lib/mysql/backup",
-								}},
-							}},
-							Volumes: []corev1.Volume{{
-								Name:         "data",
-								VolumeSource: dbBackup.Spec.TargetVolume,
-							}},
-						},
-					},
+				// Labels allow the controller to find the Jobs spawned for this DatabaseBackup
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: dbBackup.GetLabels(),
+				},
+				Spec: createBackupJobSpec(dbBackup, dbInfo),
+			},
+		},
+	}
+
+	ctrl.SetControllerReference(dbBackup, cronJob, r.Scheme)
+	return cronJob
+}
+
+// createVerifyCronJob creates a CronJob that verifies the most recent archive on the verification schedule
+func (r *DatabaseBackupReconciler) createVerifyCronJob(dbBackup *stroomv1.DatabaseBackup) *batchv1.CronJob {
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dbBackup.GetVerifyCronJobName(),
+			Namespace: dbBackup.Namespace,
+			Labels:    dbBackup.GetVerifyLabels(),
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:          dbBackup.Spec.Verify.Schedule,
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: dbBackup.GetVerifyLabels(),
 				},
+				Spec: createVerifyJobSpec(dbBackup, stroomv1.LatestArchivePath),
 			},
 		},
 	}
@@ -105,3 +61,387 @@ func (r *DatabaseBackupReconciler) createCronJob(dbBackup *stroomv1.DatabaseBack
 	ctrl.SetControllerReference(dbBackup, cronJob, r.Scheme)
 	return cronJob
 }
+
+// createVerifyJob creates a Job that verifies the archive produced by a backup Job
+func (r *DatabaseBackupReconciler) createVerifyJob(dbBackup *stroomv1.DatabaseBackup, backupJob *batchv1.Job, archivePath string) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dbBackup.GetVerifyJobName(backupJob.Name),
+			Namespace: dbBackup.Namespace,
+			Labels:    dbBackup.GetVerifyLabels(),
+		},
+		Spec: createVerifyJobSpec(dbBackup, archivePath),
+	}
+
+	ctrl.SetControllerReference(dbBackup, job, r.Scheme)
+	return job
+}
+
+func (r *DatabaseBackupReconciler) createScriptsConfigMap(dbBackup *stroomv1.DatabaseBackup, data map[string]string) *corev1.ConfigMap {
+	configMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dbBackup.GetScriptsConfigMapName(),
+			Namespace: dbBackup.Namespace,
+			Labels:    dbBackup.GetLabels(),
+		},
+		Data: data,
+	}
+
+	ctrl.SetControllerReference(dbBackup, &configMap, r.Scheme)
+	return &configMap
+}
+
+// readBackupScripts returns the contents of each embedded backup script, keyed by file name
+func readBackupScripts() (map[string]string, error) {
+	files, err := BackupScripts.ReadDir(BackupScriptsDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	allFileData := make(map[string]string)
+	for _, file := range files {
+		if data, err := BackupScripts.ReadFile(path.Join(BackupScriptsDirectory, file.Name())); err != nil {
+			return nil, err
+		} else {
+			allFileData[file.Name()] = string(data)
+		}
+	}
+
+	return allFileData, nil
+}
+
+// createBackupJobSpec creates the specification of a Job that dumps the databases of a DatabaseBackup to its target
+// volume and/or object storage, then prunes archives according to the retention policy. This is used both for
+// scheduled backups and one-off backups (e.g. prior to a Stroom upgrade).
+func createBackupJobSpec(dbBackup *stroomv1.DatabaseBackup, dbInfo *DatabaseConnectionInfo) batchv1.JobSpec {
+	const targetDirectory = "/var/lib/mysql/backup"
+	const scriptsPath = "/stroom-backup/scripts"
+	const uploadDirectory = "/stroom-backup/upload"
+	retention := dbBackup.Spec.Retention
+
+	// Retain the CronJob for 5 minutes after it completes
+	var ttlSecondsAfterFinished int32 = 300
+
+	// Scripts need execute permissions
+	var scriptFileMode int32 = 0555
+
+	commonEnv := []corev1.EnvVar{{
+		Name:  "BACKUP_NAME",
+		Value: dbBackup.Name,
+	}, {
+		// Archives are named with the time in UTC, so they can be selected for a point-in-time restore
+		Name:  "TZ",
+		Value: "UTC",
+	}, {
+		Name:  "KEEP_LAST",
+		Value: strconv.Itoa(retention.KeepLast),
+	}, {
+		Name:  "MAX_AGE_DAYS",
+		Value: strconv.Itoa(retention.MaxAgeDays),
+	}, {
+		Name:  "KEEP_DAILY",
+		Value: strconv.Itoa(retention.KeepDaily),
+	}, {
+		Name:  "KEEP_WEEKLY",
+		Value: strconv.Itoa(retention.KeepWeekly),
+	}, {
+		Name:  "KEEP_MONTHLY",
+		Value: strconv.Itoa(retention.KeepMonthly),
+	}}
+	scriptsVolumeMount := corev1.VolumeMount{
+		Name:      "scripts",
+		MountPath: scriptsPath,
+		ReadOnly:  true,
+	}
+
+	backupContainer := corev1.Container{
+		Name:            "backup-job",
+		Image:           dbBackup.Spec.Image.String(),
+		ImagePullPolicy: dbBackup.Spec.ImagePullPolicy,
+		Command:         []string{path.Join(scriptsPath, "backup.sh")},
+		// Report the tail of the log as the reason for a failure
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		Env: append([]corev1.EnvVar{{
+			Name:  "MYSQL_HOST",
+			Value: dbInfo.Host,
+		}, {
+			Name:  "MYSQL_PORT",
+			Value: strconv.Itoa(int(dbInfo.Port)),
+		}, {
+			Name:  "MYSQL_USER",
+			Value: dbInfo.UserName,
+		}, {
+			Name:  "DATABASE_NAMES",
+			Value: strings.Join(dbBackup.Spec.DatabaseNames, " "),
+		}}, commonEnv...),
+		VolumeMounts: []corev1.VolumeMount{scriptsVolumeMount},
+	}
+	volumes := []corev1.Volume{{
+		Name: "scripts",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: dbBackup.GetScriptsConfigMapName(),
+				},
+				DefaultMode: &scriptFileMode,
+			},
+		},
+	}}
+	dbInfo.appendClientPassword(&backupContainer, &volumes)
+	dbInfo.appendClientTls(&backupContainer, &volumes)
+	restartPolicy := corev1.RestartPolicyOnFailure
+
+	if dbBackup.Spec.TargetVolume != nil {
+		backupContainer.Env = append(backupContainer.Env, corev1.EnvVar{Name: "BACKUP_DIR", Value: targetDirectory})
+		backupContainer.VolumeMounts = append(backupContainer.VolumeMounts, corev1.VolumeMount{
+			Name:      "data",
+			MountPath: targetDirectory,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name:         "data",
+			VolumeSource: *dbBackup.Spec.TargetVolume,
+		})
+	}
+
+	var uploadContainer *corev1.Container
+	if objectStorage := dbBackup.Spec.ObjectStorage; objectStorage != nil {
+		// The dump is streamed to the upload container via a named pipe in a shared volume
+		uploadVolumeMount := corev1.VolumeMount{
+			Name:      "upload",
+			MountPath: uploadDirectory,
+		}
+		backupContainer.Env = append(backupContainer.Env, corev1.EnvVar{Name: "UPLOAD_DIR", Value: uploadDirectory})
+		backupContainer.VolumeMounts = append(backupContainer.VolumeMounts, uploadVolumeMount)
+		volumes = append(volumes, corev1.Volume{
+			Name: "upload",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		uploadContainer = createObjectStorageContainer("upload", objectStorage, append(commonEnv, corev1.EnvVar{Name: "UPLOAD_DIR", Value: uploadDirectory}),
+			[]corev1.VolumeMount{scriptsVolumeMount, uploadVolumeMount}, path.Join(scriptsPath, "upload.sh"))
+
+		// Containers cannot be restarted individually, as they coordinate via the shared volume. Retry the Pod instead.
+		restartPolicy = corev1.RestartPolicyNever
+	}
+
+	containers := []corev1.Container{backupContainer}
+	if uploadContainer != nil {
+		containers = append(containers, *uploadContainer)
+	}
+
+	return batchv1.JobSpec{
+		TTLSecondsAfterFinished: &ttlSecondsAfterFinished,
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				RestartPolicy: restartPolicy,
+				Containers:    containers,
+				Volumes:       volumes,
+			},
+		},
+	}
+}
+
+// createObjectStorageContainer creates a container that runs a script transferring archives to or from object storage
+func createObjectStorageContainer(name string, objectStorage *stroomv1.BackupObjectStorage, env []corev1.EnvVar, volumeMounts []corev1.VolumeMount, scriptPath string) *corev1.Container {
+	credentialsRef := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: objectStorage.CredentialsSecretName,
+				},
+				Key: key,
+			},
+		}
+	}
+
+	return &corev1.Container{
+		Name:                     name,
+		Image:                    objectStorage.Image.String(),
+		ImagePullPolicy:          objectStorage.ImagePullPolicy,
+		Command:                  []string{scriptPath},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		Env: append([]corev1.EnvVar{{
+			Name:      "AWS_ACCESS_KEY_ID",
+			ValueFrom: credentialsRef("accessKeyId"),
+		}, {
+			Name:      "AWS_SECRET_ACCESS_KEY",
+			ValueFrom: credentialsRef("secretAccessKey"),
+		}, {
+			Name:  "AWS_DEFAULT_REGION",
+			Value: objectStorage.Region,
+		}, {
+			Name:  "S3_BUCKET",
+			Value: objectStorage.Bucket,
+		}, {
+			Name:  "S3_PREFIX",
+			Value: objectStorage.Prefix,
+		}, {
+			Name:  "S3_ENDPOINT",
+			Value: objectStorage.Endpoint,
+		}, {
+			Name:  "S3_SSE",
+			Value: objectStorage.ServerSideEncryption,
+		}, {
+			Name:  "S3_SSE_KMS_KEY_ID",
+			Value: objectStorage.KmsKeyId,
+		}}, env...),
+		VolumeMounts: volumeMounts,
+	}
+}
+
+// defaultVerificationTables are the core Stroom tables expected to exist in an archive of a Stroom database server
+var defaultVerificationTables = []stroomv1.BackupTableCheck{
+	{Database: "stroom", Table: "node", MinRows: 1},
+	{Database: "stroom", Table: "explorer_node", MinRows: 1},
+	{Database: "stroom", Table: "doc"},
+	{Database: "stroom", Table: "meta"},
+	{Database: "stroom", Table: "processor"},
+	{Database: "stats", Table: "SQL_STAT_KEY"},
+	{Database: "stats", Table: "SQL_STAT_VAL"},
+}
+
+// getVerificationTableChecks returns the tables checked when verifying an archive, in the form expected by verify.sh.
+// The default tables are only checked if their database is included in the backup.
+func getVerificationTableChecks(dbBackup *stroomv1.DatabaseBackup) string {
+	tables := dbBackup.Spec.Verify.Tables
+	if len(tables) == 0 {
+		for _, table := range defaultVerificationTables {
+			if len(dbBackup.Spec.DatabaseNames) == 0 || slices.Contains(dbBackup.Spec.DatabaseNames, table.Database) {
+				tables = append(tables, table)
+			}
+		}
+	}
+
+	checks := make([]string, 0, len(tables))
+	for _, table := range tables {
+		checks = append(checks, fmt.Sprintf("%v.%v:%v", table.Database, table.Table, table.MinRows))
+	}
+	return strings.Join(checks, " ")
+}
+
+// getArchiveName returns the path of an archive relative to the backup volume or object storage prefix, which has
+// the form `YYYY-MM/<name>_<date>.sql.gz`
+func getArchiveName(result *JobResult) string {
+	archivePath := result.ArchivePath
+	if archivePath == "" {
+		archivePath = result.ObjectUrl
+	}
+	if archivePath == "" {
+		return ""
+	}
+
+	return path.Join(path.Base(path.Dir(archivePath)), path.Base(archivePath))
+}
+
+// createVerifyJobSpec creates the specification of a Job that loads an archive into a temporary MySQL server and
+// checks it contains the expected tables. archivePath is relative to the backup volume or object storage prefix, or
+// `latest` to verify the most recent archive.
+func createVerifyJobSpec(dbBackup *stroomv1.DatabaseBackup, archivePath string) batchv1.JobSpec {
+	const backupDirectory = "/var/lib/mysql/backup"
+	const scriptsPath = "/stroom-backup/scripts"
+	const verifyDirectory = "/stroom-backup/verify"
+	verify := dbBackup.Spec.Verify
+
+	// Retain the Job for 5 minutes after it completes
+	var ttlSecondsAfterFinished int32 = 300
+
+	// A failed check is not transient, so the Job is not retried
+	var backoffLimit int32 = 0
+
+	// Scripts need execute permissions
+	var scriptFileMode int32 = 0555
+
+	image := verify.Image
+	imagePullPolicy := verify.ImagePullPolicy
+	if image.IsZero() {
+		image = dbBackup.Spec.Image
+		imagePullPolicy = dbBackup.Spec.ImagePullPolicy
+	}
+
+	env := []corev1.EnvVar{{
+		Name:  "BACKUP_NAME",
+		Value: dbBackup.Name,
+	}, {
+		Name:  "BACKUP_DIR",
+		Value: backupDirectory,
+	}, {
+		Name:  "ARCHIVE_PATH",
+		Value: archivePath,
+	}}
+	scriptsVolumeMount := corev1.VolumeMount{
+		Name:      "scripts",
+		MountPath: scriptsPath,
+		ReadOnly:  true,
+	}
+	dataVolumeMount := corev1.VolumeMount{
+		Name:      "data",
+		MountPath: backupDirectory,
+	}
+	volumes := []corev1.Volume{{
+		Name: "scripts",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: dbBackup.GetScriptsConfigMapName(),
+				},
+				DefaultMode: &scriptFileMode,
+			},
+		},
+	}, {
+		Name: "verify",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}}
+
+	var initContainers []corev1.Container
+	if dbBackup.Spec.TargetVolume != nil {
+		dataVolumeMount.ReadOnly = true
+		volumes = append(volumes, corev1.Volume{
+			Name:         "data",
+			VolumeSource: *dbBackup.Spec.TargetVolume,
+		})
+	} else {
+		// Download the archive from object storage before loading it
+		volumes = append(volumes, corev1.Volume{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		initContainers = append(initContainers, *createObjectStorageContainer("download", dbBackup.Spec.ObjectStorage, env,
+			[]corev1.VolumeMount{scriptsVolumeMount, dataVolumeMount}, path.Join(scriptsPath, "download.sh")))
+	}
+
+	return batchv1.JobSpec{
+		TTLSecondsAfterFinished: &ttlSecondsAfterFinished,
+		BackoffLimit:            &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				RestartPolicy:  corev1.RestartPolicyNever,
+				InitContainers: initContainers,
+				Containers: []corev1.Container{{
+					Name:                     "verify",
+					Image:                    image.String(),
+					ImagePullPolicy:          imagePullPolicy,
+					Command:                  []string{path.Join(scriptsPath, "verify.sh")},
+					TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+					Env: append([]corev1.EnvVar{{
+						Name:  "VERIFY_DIR",
+						Value: verifyDirectory,
+					}, {
+						Name:  "TABLE_CHECKS",
+						Value: getVerificationTableChecks(dbBackup),
+					}}, env...),
+					VolumeMounts: []corev1.VolumeMount{scriptsVolumeMount, dataVolumeMount, {
+						Name:      "verify",
+						MountPath: verifyDirectory,
+					}},
+					Resources: verify.Resources,
+				}},
+				Volumes: volumes,
+			},
+		},
+	}
+}
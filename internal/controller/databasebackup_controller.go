@@ -18,31 +18,44 @@ package controller
 
 import (
 	"context"
-	"fmt"
+	"embed"
 
-	"k8s.io/api/batch/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
 )
 
+const BackupScriptsDirectory = "backup_scripts"
+
+//go:embed backup_scripts
+var BackupScripts embed.FS
+
 // DatabaseBackupReconciler reconciles a DatabaseBackup object
 type DatabaseBackupReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databasebackups,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databasebackups/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databasebackups/finalizers,verbs=update
 //+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -55,10 +68,17 @@ func (r *DatabaseBackupReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	dbBackup := stroomv1.DatabaseBackup{}
 	if err := r.Get(ctx, req.NamespacedName, &dbBackup); err != nil {
 		if errors.IsNotFound(err) {
+			databaseBackupLastSuccess.DeleteLabelValues(req.Namespace, req.Name)
 			return ctrl.Result{}, nil
 		}
 
 		logger.Error(err, "Unable to fetch DatabaseBackup", "Namespace", req.Namespace, "Name", req.Name)
+		return ctrl.Result{}, err
+	}
+
+	// Record the outcome of any backup Jobs that finished since the last reconciliation
+	if err := r.updateBackupStatus(ctx, &dbBackup); err != nil {
+		return ctrl.Result{}, err
 	}
 
 	// Get connection information on the target database instance
@@ -67,42 +87,79 @@ func (r *DatabaseBackupReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
-	foundCronJob := v1beta1.CronJob{}
-	result, err := r.getOrCreateObject(ctx, dbBackup.GetBaseName(), dbBackup.Namespace, "CronJob", &foundCronJob, func() error {
-		// Create a CronJob for performing scheduled database backups
-		resource := r.createCronJob(&dbBackup, &dbInfo)
-		logger.Info("Creating a new CronJob", "Namespace", resource.Namespace, "Name", resource.Name)
-		return r.Create(ctx, resource)
+	// Create a ConfigMap containing the scripts run by backup Jobs
+	scripts, err := readBackupScripts()
+	if err != nil {
+		logger.Error(err, "Could not read backup scripts to populate ConfigMap", "DatabaseBackup", dbBackup.Name)
+		return ctrl.Result{}, err
+	}
+	newConfigMap := r.createScriptsConfigMap(&dbBackup, scripts)
+	existingConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newConfigMap.Name,
+			Namespace: newConfigMap.Namespace,
+		},
+	}
+	operationResult, err := controllerutil.CreateOrUpdate(ctx, r.Client, &existingConfigMap, func() error {
+		existingConfigMap.Labels = newConfigMap.Labels
+		existingConfigMap.OwnerReferences = newConfigMap.OwnerReferences
+		existingConfigMap.Data = newConfigMap.Data
+		return nil
 	})
 	if err != nil {
-		return result, err
-	} else if !result.IsZero() {
-		return result, nil
+		return ctrl.Result{}, err
 	}
-
-	return ctrl.Result{}, nil
-}
-
-func (r *DatabaseBackupReconciler) getOrCreateObject(ctx context.Context, name string, namespace string, objectType string, foundObject client.Object, onCreate func() error) (reconcile.Result, error) {
-	logger := log.FromContext(ctx)
-
-	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, foundObject); err != nil && errors.IsNotFound(err) {
-		// Attempt to create the object, as it doesn't exist
-		err = onCreate()
-
+	logger.Info("Backup scripts ConfigMap reconciled", "Result", operationResult, "Namespace", existingConfigMap.Namespace, "Name", existingConfigMap.Name)
+
+	// Create a CronJob for performing scheduled database backups, correcting any drift from the desired spec
+	newCronJob := r.createCronJob(&dbBackup, &dbInfo)
+	existingCronJob := batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newCronJob.Name,
+			Namespace: newCronJob.Namespace,
+		},
+	}
+	operationResult, err = controllerutil.CreateOrUpdate(ctx, r.Client, &existingCronJob, func() error {
+		existingCronJob.Labels = newCronJob.Labels
+		existingCronJob.OwnerReferences = newCronJob.OwnerReferences
+		existingCronJob.Spec = newCronJob.Spec
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "Failed to reconcile CronJob", "Namespace", existingCronJob.Namespace, "Name", existingCronJob.Name)
+		return ctrl.Result{}, err
+	}
+	logger.Info("Backup CronJob reconciled", "Result", operationResult, "Namespace", existingCronJob.Namespace, "Name", existingCronJob.Name)
+
+	// Create a CronJob for verifying archives on a separate schedule, or remove it if no longer required
+	existingVerifyCronJob := batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dbBackup.GetVerifyCronJobName(),
+			Namespace: dbBackup.Namespace,
+		},
+	}
+	if verify := dbBackup.Spec.Verify; verify != nil && verify.Schedule != "" {
+		newVerifyCronJob := r.createVerifyCronJob(&dbBackup)
+		operationResult, err = controllerutil.CreateOrUpdate(ctx, r.Client, &existingVerifyCronJob, func() error {
+			existingVerifyCronJob.Labels = newVerifyCronJob.Labels
+			existingVerifyCronJob.OwnerReferences = newVerifyCronJob.OwnerReferences
+			existingVerifyCronJob.Spec = newVerifyCronJob.Spec
+			return nil
+		})
 		if err != nil {
-			logger.Error(err, fmt.Sprintf("Failed to create new %v: '%v/%v'", objectType, namespace, name))
+			logger.Error(err, "Failed to reconcile verification CronJob", "Namespace", existingVerifyCronJob.Namespace, "Name", existingVerifyCronJob.Name)
 			return ctrl.Result{}, err
 		}
-
-		// Object created successfully, so return and requeue
-		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		logger.Error(err, fmt.Sprintf("Failed to get %v", objectType))
+		logger.Info("Verification CronJob reconciled", "Result", operationResult, "Namespace", existingVerifyCronJob.Namespace, "Name", existingVerifyCronJob.Name)
+	} else if err := r.Get(ctx, client.ObjectKeyFromObject(&existingVerifyCronJob), &existingVerifyCronJob); err == nil {
+		logger.Info("Deleting verification CronJob", "Namespace", existingVerifyCronJob.Namespace, "Name", existingVerifyCronJob.Name)
+		if err := r.Delete(ctx, &existingVerifyCronJob); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+	} else if !errors.IsNotFound(err) {
 		return ctrl.Result{}, err
 	}
 
-	// Object exists and was successfully retrieved
 	return ctrl.Result{}, nil
 }
 
@@ -110,5 +167,8 @@ func (r *DatabaseBackupReconciler) getOrCreateObject(ctx context.Context, name s
 func (r *DatabaseBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&stroomv1.DatabaseBackup{}).
-		Complete(r)
+		Owns(&corev1.ConfigMap{}).
+		Owns(&batchv1.CronJob{}).
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(mapBackupJobToDatabaseBackup)).
+		Complete(instrumentReconciler("DatabaseBackup", r))
 }
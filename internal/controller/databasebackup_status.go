@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// setCondition records a DatabaseBackup status condition against the current generation
+func (r *DatabaseBackupReconciler) setCondition(dbBackup *stroomv1.DatabaseBackup, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&dbBackup.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: dbBackup.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// updateBackupStatus records the outcome of each backup and verification Job that finished since the status was last
+// updated, raising an Event for any that failed. Archives are verified once the backup that produced them completes,
+// unless verification is scheduled separately.
+func (r *DatabaseBackupReconciler) updateBackupStatus(ctx context.Context, dbBackup *stroomv1.DatabaseBackup) error {
+	logger := log.FromContext(ctx)
+	originalStatus := dbBackup.Status.DeepCopy()
+	status := &dbBackup.Status
+
+	cronJob := batchv1.CronJob{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: dbBackup.Namespace, Name: dbBackup.GetBaseName()}, &cronJob); err == nil {
+		status.LastScheduleTime = cronJob.Status.LastScheduleTime
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	jobs := batchv1.JobList{}
+	if err := r.List(ctx, &jobs, client.InNamespace(dbBackup.Namespace), client.MatchingLabels(dbBackup.GetLabels())); err != nil {
+		return err
+	}
+
+	for _, job := range getUnrecordedJobs(jobs.Items, status.GetLastFinishedTime()) {
+		condition := getJobFinishedCondition(&job)
+		finishedTime := condition.LastTransitionTime
+
+		if condition.Type == batchv1.JobComplete {
+			status.LastSuccessfulTime = &finishedTime
+			status.ConsecutiveFailures = 0
+
+			if result, err := getJobResult(ctx, r.Client, &job); err != nil {
+				logger.Error(err, "Could not read the result of the backup Job", "Name", job.Name)
+			} else if result != nil {
+				status.LastArchivePath = result.ArchivePath
+				status.LastArchiveSizeBytes = result.ArchiveSizeBytes
+				status.LastObjectUrl = result.ObjectUrl
+				if result.ArchivePath == "" {
+					// The archive was only uploaded to object storage
+					status.LastArchiveSizeBytes = result.ObjectSizeBytes
+				}
+
+				if verify := dbBackup.Spec.Verify; verify != nil && verify.Schedule == "" {
+					if err := r.verifyArchive(ctx, dbBackup, &job, getArchiveName(result)); err != nil {
+						return err
+					}
+				}
+			}
+			r.setCondition(dbBackup, stroomv1.BackupReadyCondition, metav1.ConditionTrue, "BackupSucceeded", fmt.Sprintf("Backup Job '%v' succeeded", job.Name))
+		} else {
+			status.LastFailureTime = &finishedTime
+			status.ConsecutiveFailures++
+
+			reason := condition.Message
+			if message, err := getJobFailureMessage(ctx, r.Client, &job); err != nil {
+				logger.Error(err, "Could not read the failure message of the backup Job", "Name", job.Name)
+			} else if message != "" {
+				reason = message
+			}
+			message := fmt.Sprintf("Backup Job '%v' failed: %v", job.Name, reason)
+			r.setCondition(dbBackup, stroomv1.BackupReadyCondition, metav1.ConditionFalse, "BackupFailed", message)
+			r.Recorder.Eventf(dbBackup, &job, corev1.EventTypeWarning, "BackupFailed", "Backup", message)
+			logger.Info("Database backup failed", "DatabaseBackup", dbBackup.Name, "Job", job.Name, "Reason", reason)
+		}
+	}
+
+	recordBackupSuccess(dbBackup)
+
+	if err := r.updateVerificationStatus(ctx, dbBackup); err != nil {
+		return err
+	}
+
+	if meta.FindStatusCondition(status.Conditions, stroomv1.BackupReadyCondition) == nil {
+		r.setCondition(dbBackup, stroomv1.BackupReadyCondition, metav1.ConditionUnknown, "Pending", "No backup has completed yet")
+	}
+
+	status.ObservedGeneration = dbBackup.Generation
+	if equality.Semantic.DeepEqual(originalStatus, status) {
+		return nil
+	}
+	if err := r.Status().Update(ctx, dbBackup); err != nil {
+		logger.Error(err, "Failed to update DatabaseBackup status", "Namespace", dbBackup.Namespace, "Name", dbBackup.Name)
+		return err
+	}
+
+	return nil
+}
+
+// updateVerificationStatus records the outcome of each verification Job that finished since the status was last updated
+func (r *DatabaseBackupReconciler) updateVerificationStatus(ctx context.Context, dbBackup *stroomv1.DatabaseBackup) error {
+	logger := log.FromContext(ctx)
+	verification := &dbBackup.Status.Verification
+
+	if dbBackup.Spec.Verify == nil {
+		meta.RemoveStatusCondition(&dbBackup.Status.Conditions, stroomv1.BackupVerifiedCondition)
+		return nil
+	}
+
+	jobs := batchv1.JobList{}
+	if err := r.List(ctx, &jobs, client.InNamespace(dbBackup.Namespace), client.MatchingLabels(dbBackup.GetVerifyLabels())); err != nil {
+		return err
+	}
+
+	for _, job := range getUnrecordedJobs(jobs.Items, verification.LastRunTime) {
+		condition := getJobFinishedCondition(&job)
+		finishedTime := condition.LastTransitionTime
+		verification.LastRunTime = &finishedTime
+
+		if condition.Type == batchv1.JobComplete {
+			verification.LastSuccessfulTime = &finishedTime
+			if result, err := getJobResult(ctx, r.Client, &job); err != nil {
+				logger.Error(err, "Could not read the result of the verification Job", "Name", job.Name)
+			} else if result != nil {
+				verification.ArchivePath = result.ArchivePath
+				verification.VerifiedTables = result.VerifiedTables
+			}
+			r.setCondition(dbBackup, stroomv1.BackupVerifiedCondition, metav1.ConditionTrue, "VerificationSucceeded",
+				fmt.Sprintf("Archive '%v' was restored and %v table(s) verified", verification.ArchivePath, verification.VerifiedTables))
+		} else {
+			reason := condition.Message
+			if message, err := getJobFailureMessage(ctx, r.Client, &job); err != nil {
+				logger.Error(err, "Could not read the failure message of the verification Job", "Name", job.Name)
+			} else if message != "" {
+				reason = message
+			}
+			message := fmt.Sprintf("Verification Job '%v' failed: %v", job.Name, reason)
+			r.setCondition(dbBackup, stroomv1.BackupVerifiedCondition, metav1.ConditionFalse, "VerificationFailed", message)
+			r.Recorder.Eventf(dbBackup, &job, corev1.EventTypeWarning, "VerificationFailed", "Verify", message)
+			logger.Info("Database backup verification failed", "DatabaseBackup", dbBackup.Name, "Job", job.Name, "Reason", reason)
+		}
+	}
+
+	if meta.FindStatusCondition(dbBackup.Status.Conditions, stroomv1.BackupVerifiedCondition) == nil {
+		r.setCondition(dbBackup, stroomv1.BackupVerifiedCondition, metav1.ConditionUnknown, "Pending", "No archive has been verified yet")
+	}
+
+	return nil
+}
+
+// verifyArchive creates a Job to verify the archive produced by a backup Job, unless one already exists
+func (r *DatabaseBackupReconciler) verifyArchive(ctx context.Context, dbBackup *stroomv1.DatabaseBackup, backupJob *batchv1.Job, archivePath string) error {
+	if archivePath == "" {
+		log.FromContext(ctx).Info("Backup Job did not report an archive to verify", "Name", backupJob.Name)
+		return nil
+	}
+
+	job := r.createVerifyJob(dbBackup, backupJob, archivePath)
+	if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+		log.FromContext(ctx).Error(err, "Failed to create verification Job", "Namespace", job.Namespace, "Name", job.Name)
+		return err
+	}
+
+	return nil
+}
+
+// getUnrecordedJobs returns the Jobs that finished after the specified time, in the order they finished
+func getUnrecordedJobs(jobs []batchv1.Job, since *metav1.Time) []batchv1.Job {
+	var finishedJobs []batchv1.Job
+	for _, job := range jobs {
+		condition := getJobFinishedCondition(&job)
+		if condition == nil || (since != nil && !condition.LastTransitionTime.After(since.Time)) {
+			continue
+		}
+		finishedJobs = append(finishedJobs, job)
+	}
+
+	sort.SliceStable(finishedJobs, func(i, j int) bool {
+		return getJobFinishedCondition(&finishedJobs[i]).LastTransitionTime.Before(&getJobFinishedCondition(&finishedJobs[j]).LastTransitionTime)
+	})
+	return finishedJobs
+}
+
+// mapBackupJobToDatabaseBackup enqueues the DatabaseBackup that spawned a backup or verification Job. Jobs spawned by a
+// CronJob are not owned by the DatabaseBackup, so they are matched by label.
+func mapBackupJobToDatabaseBackup(_ context.Context, job client.Object) []reconcile.Request {
+	labels := job.GetLabels()
+	if component := labels["app.kubernetes.io/component"]; (component != "database-backup" && component != "database-backup-verify") ||
+		labels["app.kubernetes.io/instance"] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Namespace: job.GetNamespace(), Name: labels["app.kubernetes.io/instance"]},
+	}}
+}
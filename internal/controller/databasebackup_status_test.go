@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("DatabaseBackup status", func() {
+
+	now := time.Now()
+	finishedJob := func(name string, conditionType batchv1.JobConditionType, finishedAt time.Time) batchv1.Job {
+		return batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{
+					Type:               conditionType,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(finishedAt),
+				}},
+			},
+		}
+	}
+
+	Context("getUnrecordedJobs()", func() {
+		jobs := []batchv1.Job{
+			finishedJob("backup-3", batchv1.JobFailed, now.Add(-time.Hour)),
+			finishedJob("backup-1", batchv1.JobComplete, now.Add(-3*time.Hour)),
+			{ObjectMeta: metav1.ObjectMeta{Name: "backup-4"}},
+			finishedJob("backup-2", batchv1.JobComplete, now.Add(-2*time.Hour)),
+		}
+		jobNames := func(jobs []batchv1.Job) []string {
+			var names []string
+			for _, job := range jobs {
+				names = append(names, job.Name)
+			}
+			return names
+		}
+
+		It("should return finished Jobs in the order they finished", func() {
+			Expect(jobNames(getUnrecordedJobs(jobs, nil))).Should(Equal([]string{"backup-1", "backup-2", "backup-3"}))
+		})
+		It("should skip Jobs that were already recorded", func() {
+			since := metav1.NewTime(now.Add(-2 * time.Hour))
+			Expect(jobNames(getUnrecordedJobs(jobs, &since))).Should(Equal([]string{"backup-3"}))
+		})
+	})
+
+	Context("GetLastFinishedTime()", func() {
+		It("should return the latest of the last success and failure", func() {
+			success := metav1.NewTime(now.Add(-time.Hour))
+			failure := metav1.NewTime(now.Add(-2 * time.Hour))
+			status := stroomv1.DatabaseBackupStatus{LastSuccessfulTime: &success}
+			Expect(status.GetLastFinishedTime()).Should(Equal(&success))
+
+			status.LastFailureTime = &failure
+			Expect(status.GetLastFinishedTime()).Should(Equal(&success))
+
+			failure = metav1.NewTime(now)
+			Expect(status.GetLastFinishedTime()).Should(Equal(&failure))
+		})
+	})
+
+	Context("mapBackupJobToDatabaseBackup()", func() {
+		It("should enqueue the DatabaseBackup that spawned the Job", func() {
+			dbBackup := stroomv1.DatabaseBackup{ObjectMeta: metav1.ObjectMeta{Name: "dev"}}
+			job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "stroom", Labels: dbBackup.GetLabels()}}
+			requests := mapBackupJobToDatabaseBackup(context.Background(), &job)
+			Expect(requests).Should(HaveLen(1))
+			Expect(requests[0].NamespacedName).Should(Equal(types.NamespacedName{Namespace: "stroom", Name: "dev"}))
+		})
+		It("should ignore Jobs spawned by other resources", func() {
+			job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app.kubernetes.io/component": "pre-upgrade-backup"}}}
+			Expect(mapBackupJobToDatabaseBackup(context.Background(), &job)).Should(BeEmpty())
+		})
+	})
+})
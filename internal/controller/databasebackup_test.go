@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("DatabaseBackup", func() {
+
+	var dbBackup stroomv1.DatabaseBackup
+	var dbInfo DatabaseConnectionInfo
+
+	BeforeEach(func() {
+		dbBackup = stroomv1.DatabaseBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.DatabaseBackupSpec{
+				Image:         stroomv1.Image{Repository: "mysql/mysql-server", Tag: "8.0.26"},
+				DatabaseNames: []string{"stroom", "stats"},
+				Schedule:      "0 0 * * *",
+				Retention:     stroomv1.BackupRetention{KeepLast: 3, KeepDaily: 7},
+			},
+		}
+		dbInfo = DatabaseConnectionInfo{
+			ServerAddress: stroomv1.ServerAddress{Host: "mysql", Port: 3306, SecretName: "stroom-dev-db"},
+			UserName:      "root",
+		}
+	})
+
+	Context("readBackupScripts()", func() {
+		It("should include the backup script", func() {
+			scripts, err := readBackupScripts()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(scripts).Should(HaveKey("backup.sh"))
+		})
+	})
+
+	Context("createBackupJobSpec()", func() {
+		It("should pass the retention policy to the backup script", func() {
+			container := createBackupJobSpec(&dbBackup, &dbInfo).Template.Spec.Containers[0]
+			Expect(container.Env).Should(ContainElements(
+				corev1.EnvVar{Name: "DATABASE_NAMES", Value: "stroom stats"},
+				corev1.EnvVar{Name: "KEEP_LAST", Value: "3"},
+				corev1.EnvVar{Name: "KEEP_DAILY", Value: "7"},
+				corev1.EnvVar{Name: "KEEP_WEEKLY", Value: "0"},
+			))
+		})
+		It("should stream the archive to object storage", func() {
+			dbBackup.Spec.ObjectStorage = &stroomv1.BackupObjectStorage{
+				Image:                 stroomv1.Image{Repository: "amazon/aws-cli"},
+				Bucket:                "backups",
+				Endpoint:              "http://minio:9000",
+				CredentialsSecretName: "minio-credentials",
+			}
+			podSpec := createBackupJobSpec(&dbBackup, &dbInfo).Template.Spec
+			Expect(podSpec.Containers).Should(HaveLen(2))
+			Expect(podSpec.Containers[1].Env).Should(ContainElement(corev1.EnvVar{Name: "S3_ENDPOINT", Value: "http://minio:9000"}))
+			Expect(podSpec.RestartPolicy).Should(Equal(corev1.RestartPolicyNever))
+			Expect(podSpec.Volumes).ShouldNot(ContainElement(HaveField("Name", "data")))
+		})
+		It("should verify the identity of a database server using TLS", func() {
+			Expect(createBackupJobSpec(&dbBackup, &dbInfo).Template.Spec.Containers[0].Env).ShouldNot(ContainElement(HaveField("Name", "MYSQL_SSL_CA")))
+
+			dbInfo.CaSecretName = "stroom-dev-db-tls"
+			podSpec := createBackupJobSpec(&dbBackup, &dbInfo).Template.Spec
+			Expect(podSpec.Containers[0].Env).Should(ContainElement(corev1.EnvVar{Name: "MYSQL_SSL_CA", Value: "/etc/stroom/database-ca/ca.crt"}))
+			Expect(podSpec.Volumes).Should(ContainElement(HaveField("VolumeSource.Secret.SecretName", "stroom-dev-db-tls")))
+		})
+		It("should read the password from the selected source", func() {
+			Expect(createBackupJobSpec(&dbBackup, &dbInfo).Template.Spec.Containers[0].Env).Should(ContainElement(And(
+				HaveField("Name", "MYSQL_PASSWORD"),
+				HaveField("ValueFrom.SecretKeyRef.Key", "root"),
+			)))
+
+			dbInfo.PasswordSecretKeyRef = &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "managed-db"}, Key: "password"}
+			Expect(createBackupJobSpec(&dbBackup, &dbInfo).Template.Spec.Containers[0].Env).Should(ContainElement(And(
+				HaveField("Name", "MYSQL_PASSWORD"),
+				HaveField("ValueFrom.SecretKeyRef.Key", "password"),
+			)))
+
+			dbInfo.PasswordSecretKeyRef = nil
+			dbInfo.PasswordFile = &stroomv1.PasswordFileSource{
+				Volume: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "secrets-store.csi.k8s.io"}},
+				Path:   "db/password",
+			}
+			podSpec := createBackupJobSpec(&dbBackup, &dbInfo).Template.Spec
+			Expect(podSpec.Containers[0].Env).ShouldNot(ContainElement(HaveField("Name", "MYSQL_PASSWORD")))
+			Expect(podSpec.Containers[0].Env).Should(ContainElement(corev1.EnvVar{Name: "MYSQL_PASSWORD_FILE", Value: "/etc/stroom/database-password/db/password"}))
+			Expect(podSpec.Volumes).Should(ContainElement(HaveField("VolumeSource.CSI.Driver", "secrets-store.csi.k8s.io")))
+		})
+		It("should mount the scripts ConfigMap", func() {
+			volumes := createBackupJobSpec(&dbBackup, &dbInfo).Template.Spec.Volumes
+			Expect(volumes).Should(ContainElement(HaveField("VolumeSource.ConfigMap.Name", dbBackup.GetScriptsConfigMapName())))
+		})
+	})
+
+	Context("createCronJob()", func() {
+		It("should reflect the current schedule and label the Jobs it spawns", func() {
+			scheme := runtime.NewScheme()
+			Expect(stroomv1.AddToScheme(scheme)).Should(Succeed())
+			reconciler := DatabaseBackupReconciler{Scheme: scheme}
+
+			dbBackup.Spec.Schedule = "30 2 * * *"
+			cronJob := reconciler.createCronJob(&dbBackup, &dbInfo)
+			Expect(cronJob.Spec.Schedule).Should(Equal("30 2 * * *"))
+			Expect(cronJob.Spec.JobTemplate.Labels).Should(Equal(dbBackup.GetLabels()))
+			Expect(cronJob.OwnerReferences).Should(ContainElement(HaveField("Name", "dev")))
+		})
+	})
+
+	Context("createVerifyJobSpec()", func() {
+		BeforeEach(func() {
+			dbBackup.Spec.Verify = &stroomv1.BackupVerification{}
+		})
+
+		It("should check the default tables of the databases that are backed up", func() {
+			dbBackup.Spec.DatabaseNames = []string{"stats"}
+			Expect(getVerificationTableChecks(&dbBackup)).Should(Equal("stats.SQL_STAT_KEY:0 stats.SQL_STAT_VAL:0"))
+		})
+		It("should load the archive from the backup volume", func() {
+			dbBackup.Spec.TargetVolume = &corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+			podSpec := createVerifyJobSpec(&dbBackup, "2026-10/dev_2026-10-17_00-00-00.sql.gz").Template.Spec
+			Expect(podSpec.InitContainers).Should(BeEmpty())
+			Expect(podSpec.Containers[0].Image).Should(Equal("mysql/mysql-server:8.0.26"))
+			Expect(podSpec.Containers[0].Env).Should(ContainElement(corev1.EnvVar{Name: "ARCHIVE_PATH", Value: "2026-10/dev_2026-10-17_00-00-00.sql.gz"}))
+			Expect(podSpec.Containers[0].VolumeMounts).Should(ContainElement(And(HaveField("Name", "data"), HaveField("ReadOnly", true))))
+		})
+		It("should download the archive from object storage if there is no backup volume", func() {
+			dbBackup.Spec.ObjectStorage = &stroomv1.BackupObjectStorage{
+				Image:                 stroomv1.Image{Repository: "amazon/aws-cli"},
+				Bucket:                "backups",
+				CredentialsSecretName: "s3-credentials",
+			}
+			podSpec := createVerifyJobSpec(&dbBackup, stroomv1.LatestArchivePath).Template.Spec
+			Expect(podSpec.InitContainers).Should(HaveLen(1))
+			Expect(podSpec.InitContainers[0].Command).Should(Equal([]string{"/stroom-backup/scripts/download.sh"}))
+		})
+	})
+
+	Context("createVerifyJob()", func() {
+		It("should keep the names of verification Jobs and CronJobs within their limits", func() {
+			reconciler := DatabaseBackupReconciler{Scheme: runtime.NewScheme()}
+			dbBackup.Name = "stroom-production-cluster-backup-1"
+			dbBackup.Spec.Verify = &stroomv1.BackupVerification{}
+			dbBackup.Spec.TargetVolume = &corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+			backupJobName := fmt.Sprintf("%v-29171520", dbBackup.GetBaseName())
+
+			job := reconciler.createVerifyJob(&dbBackup, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: backupJobName}}, "latest")
+			Expect(job.Name).Should(HaveLen(stroomv1.JobNameMaxLength))
+			Expect(job.Name).Should(HavePrefix(backupJobName[:40]))
+			Expect(dbBackup.GetVerifyJobName(backupJobName + "0")).ShouldNot(Equal(job.Name))
+			Expect(dbBackup.GetVerifyCronJobName()).Should(HaveLen(stroomv1.CronJobNameMaxLength))
+
+			dbBackup.Name = "dev"
+			Expect(dbBackup.GetVerifyJobName("stroom-dev-db-backup-29171520")).Should(Equal("stroom-dev-db-backup-29171520-verify"))
+		})
+	})
+
+	Context("backup.sh", func() {
+		// Runs the backup script against stubs of the mysql client tools, returning the arguments passed to mysqldump
+		runBackup := func(gtidMode string) []string {
+			if _, err := exec.LookPath("bash"); err != nil {
+				Skip("bash is not available")
+			}
+			tempDir := GinkgoT().TempDir()
+			scripts, err := readBackupScripts()
+			Expect(err).ShouldNot(HaveOccurred())
+			for name, data := range scripts {
+				Expect(os.WriteFile(filepath.Join(tempDir, name), []byte(data), 0o755)).Should(Succeed())
+			}
+			stubs := map[string]string{
+				"mysql": `case "$*" in
+  *@@log_bin*) echo 1 ;;
+  *@@gtid_mode*) echo "${GTID_MODE}" ;;
+  *@@server_uuid*) echo 3e11fa47-71ca-11e1-9e33-c80aa9429562 ;;
+esac`,
+				"mysqldump": `if [ "$1" = --help ]; then echo --source-data; else printf '%s\n' "$@"; fi`,
+			}
+			binDir := filepath.Join(tempDir, "bin")
+			Expect(os.Mkdir(binDir, 0o755)).Should(Succeed())
+			for name, script := range stubs {
+				Expect(os.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/bash\n"+script+"\n"), 0o755)).Should(Succeed())
+			}
+
+			backupDir := filepath.Join(tempDir, "backup")
+			cmd := exec.Command("bash", filepath.Join(tempDir, "backup.sh"))
+			cmd.Env = append(os.Environ(), "PATH="+binDir+":"+os.Getenv("PATH"), "GTID_MODE="+gtidMode,
+				"BACKUP_DIR="+backupDir, "BACKUP_NAME=dev", "DATABASE_NAMES=stroom")
+			output, err := cmd.CombinedOutput()
+			Expect(err).ShouldNot(HaveOccurred(), string(output))
+
+			archives, err := filepath.Glob(filepath.Join(backupDir, "*", "dev_*.sql.gz"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(archives).Should(HaveLen(1))
+			archive, err := os.Open(archives[0])
+			Expect(err).ShouldNot(HaveOccurred())
+			defer archive.Close()
+			reader, err := gzip.NewReader(archive)
+			Expect(err).ShouldNot(HaveOccurred())
+			dump, err := io.ReadAll(reader)
+			Expect(err).ShouldNot(HaveOccurred())
+			return strings.Split(strings.TrimSpace(string(dump)), "\n")
+		}
+
+		It("should not set GTID_PURGED when GTIDs are enabled", func() {
+			Expect(runBackup("ON")).Should(ContainElements("--source-data=2", "--set-gtid-purged=OFF", "stroom"))
+			Expect(runBackup("OFF")).ShouldNot(ContainElement(HavePrefix("--set-gtid-purged")))
+		})
+	})
+
+	Context("getArchiveName()", func() {
+		It("should return the archive path relative to the volume or object storage prefix", func() {
+			Expect(getArchiveName(&JobResult{ArchivePath: "/var/lib/mysql/backup/2026-10/dev_2026-10-17_00-00-00.sql.gz"})).
+				Should(Equal("2026-10/dev_2026-10-17_00-00-00.sql.gz"))
+			Expect(getArchiveName(&JobResult{ObjectUrl: "s3://backups/prod/2026-10/dev_2026-10-17_00-00-00.sql.gz"})).
+				Should(Equal("2026-10/dev_2026-10-17_00-00-00.sql.gz"))
+			Expect(getArchiveName(&JobResult{})).Should(BeEmpty())
+		})
+	})
+})
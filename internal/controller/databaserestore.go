@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"path"
+	"strconv"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func (r *DatabaseRestoreReconciler) createScriptsConfigMap(dbRestore *stroomv1.DatabaseRestore, data map[string]string) *corev1.ConfigMap {
+	configMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dbRestore.GetScriptsConfigMapName(),
+			Namespace: dbRestore.Namespace,
+			Labels:    dbRestore.GetLabels(),
+		},
+		Data: data,
+	}
+
+	ctrl.SetControllerReference(dbRestore, &configMap, r.Scheme)
+	return &configMap
+}
+
+// createRestoreJob creates a Job that restores an archive from the source volume to the target database server
+func (r *DatabaseRestoreReconciler) createRestoreJob(dbRestore *stroomv1.DatabaseRestore, dbInfo *DatabaseConnectionInfo, sourceVolume *corev1.VolumeSource, backupName string) *batchv1.Job {
+	const sourceDirectory = "/var/lib/mysql/backup"
+	const scriptsPath = "/stroom-backup/scripts"
+
+	// Retry transient failures, but do not retry indefinitely, so StroomClusters are not left scaled down
+	var backoffLimit int32 = 2
+
+	// Scripts need execute permissions
+	var scriptFileMode int32 = 0555
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dbRestore.GetJobName(),
+			Namespace: dbRestore.Namespace,
+			Labels:    dbRestore.GetLabels(),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					Containers: []corev1.Container{{
+						Name:            "restore-job",
+						Image:           dbRestore.Spec.Image.String(),
+						ImagePullPolicy: dbRestore.Spec.ImagePullPolicy,
+						Command:         []string{path.Join(scriptsPath, "restore.sh")},
+						// Report the tail of the log as the reason for a failure
+						TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+						Env: []corev1.EnvVar{{
+							Name:  "MYSQL_HOST",
+							Value: dbInfo.Host,
+						}, {
+							Name:  "MYSQL_PORT",
+							Value: strconv.Itoa(int(dbInfo.Port)),
+						}, {
+							Name:  "MYSQL_USER",
+							Value: dbInfo.UserName,
+						}, {
+							Name:  "BACKUP_NAME",
+							Value: backupName,
+						}, {
+							Name:  "BACKUP_DIR",
+							Value: sourceDirectory,
+						}, {
+							Name:  "ARCHIVE_PATH",
+							Value: dbRestore.Spec.ArchivePath,
+						}, {
+							Name:  "POINT_IN_TIME",
+							Value: formatPointInTime(dbRestore.Spec.PointInTime),
+						}, {
+							// Archive names and binary log timestamps are compared in UTC
+							Name:  "TZ",
+							Value: "UTC",
+						}},
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      "data",
+							MountPath: sourceDirectory,
+							ReadOnly:  true,
+						}, {
+							Name:      "scripts",
+							MountPath: scriptsPath,
+							ReadOnly:  true,
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name:         "data",
+						VolumeSource: *sourceVolume,
+					}, {
+						Name: "scripts",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: dbRestore.GetScriptsConfigMapName(),
+								},
+								DefaultMode: &scriptFileMode,
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	podSpec := &job.Spec.Template.Spec
+	dbInfo.appendClientPassword(&podSpec.Containers[0], &podSpec.Volumes)
+	dbInfo.appendClientTls(&podSpec.Containers[0], &podSpec.Volumes)
+
+	ctrl.SetControllerReference(dbRestore, job, r.Scheme)
+	return job
+}
+
+// isSameDatabaseServer returns whether two references, resolved relative to the namespaces of their owners, point
+// to the same database server
+func isSameDatabaseServer(ref *stroomv1.DatabaseServerRef, namespace string, otherRef *stroomv1.DatabaseServerRef, otherNamespace string) bool {
+	if !ref.ServerRef.IsZero() || !otherRef.ServerRef.IsZero() {
+		if ref.ServerRef.Namespace != "" {
+			namespace = ref.ServerRef.Namespace
+		}
+		if otherRef.ServerRef.Namespace != "" {
+			otherNamespace = otherRef.ServerRef.Namespace
+		}
+		return ref.ServerRef.Name == otherRef.ServerRef.Name && namespace == otherNamespace
+	}
+
+	return ref.ServerAddress.Host == otherRef.ServerAddress.Host && ref.ServerAddress.Port == otherRef.ServerAddress.Port
+}
+
+// formatPointInTime formats the time to restore to in the form accepted by mysqlbinlog. Returns an empty string if
+// the archive is to be restored without replaying binary logs.
+func formatPointInTime(pointInTime *metav1.Time) string {
+	if pointInTime == nil {
+		return ""
+	}
+
+	return pointInTime.UTC().Format(time.DateTime)
+}
+
+// usesDatabaseServer returns whether a StroomCluster hosts either its app or statistics database on the referenced
+// database server
+func usesDatabaseServer(stroomCluster *stroomv1.StroomCluster, ref *stroomv1.DatabaseServerRef, namespace string) bool {
+	return isSameDatabaseServer(&stroomCluster.Spec.DatabaseServerRef, stroomCluster.Namespace, ref, namespace) ||
+		isSameDatabaseServer(stroomCluster.GetStatsDatabaseServerRef(), stroomCluster.Namespace, ref, namespace)
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// RestorePollInterval is how often to check whether StroomCluster nodes have stopped
+	RestorePollInterval = 15 * time.Second
+)
+
+// DatabaseRestoreReconciler reconciles a DatabaseRestore object
+type DatabaseRestoreReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databaserestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databaserestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databaserestores/finalizers,verbs=update
+//+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=stroomclusters,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databasebackups,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+
+// Reconcile scales down the StroomClusters using the target database, runs a Job to restore the archive, then scales
+// the StroomClusters back up. A DatabaseRestore runs once and is not repeated once completed or failed.
+func (r *DatabaseRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	dbRestore := stroomv1.DatabaseRestore{}
+	if err := r.Get(ctx, req.NamespacedName, &dbRestore); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		logger.Error(err, "Unable to fetch DatabaseRestore", "Namespace", req.Namespace, "Name", req.Name)
+		return ctrl.Result{}, err
+	}
+
+	// Ensure StroomClusters are not left scaled down if the DatabaseRestore is deleted
+	if dbRestore.IsBeingDeleted() {
+		if err := r.releaseStroomClusters(ctx, &dbRestore); err != nil {
+			return ctrl.Result{}, err
+		}
+		if controllerutil.ContainsFinalizer(&dbRestore, stroomv1.DatabaseRestoreFinalizerName) {
+			controllerutil.RemoveFinalizer(&dbRestore, stroomv1.DatabaseRestoreFinalizerName)
+			return ctrl.Result{}, r.Update(ctx, &dbRestore)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if dbRestore.Status.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(&dbRestore, stroomv1.DatabaseRestoreFinalizerName) {
+		controllerutil.AddFinalizer(&dbRestore, stroomv1.DatabaseRestoreFinalizerName)
+		if err := r.Update(ctx, &dbRestore); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	status := &dbRestore.Status
+	if status.Phase == "" {
+		now := metav1.Now()
+		status.StartTime = &now
+		r.setPhase(&dbRestore, stroomv1.RestorePendingPhase, "Restore pending")
+		r.Recorder.Eventf(&dbRestore, nil, corev1.EventTypeNormal, "Started", "Restore",
+			"Restore of archive '%v' started", dbRestore.Spec.ArchivePath)
+	}
+
+	// Resolve the volume containing the archive
+	backupName := dbRestore.Spec.BackupName
+	sourceVolume := dbRestore.Spec.SourceVolume
+	if backupName != "" {
+		dbBackup := stroomv1.DatabaseBackup{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: dbRestore.Namespace, Name: backupName}, &dbBackup); err != nil {
+			if errors.IsNotFound(err) {
+				return r.fail(ctx, &dbRestore, fmt.Sprintf("DatabaseBackup '%v' not found", backupName))
+			}
+			return ctrl.Result{}, err
+		}
+		if sourceVolume == nil {
+			sourceVolume = dbBackup.Spec.TargetVolume
+		}
+	}
+	if sourceVolume == nil {
+		return r.fail(ctx, &dbRestore, "Either a volume, or the name of a DatabaseBackup with a volume, must be specified")
+	}
+
+	dbInfo := DatabaseConnectionInfo{}
+	if err := GetDatabaseConnectionInfo(r.Client, ctx, &dbRestore.Spec.DatabaseServerRef, dbRestore.Namespace, &dbInfo); err != nil {
+		r.setPhase(&dbRestore, status.Phase, fmt.Sprintf("Database server could not be resolved: %v", err))
+		_ = r.updateStatus(ctx, &dbRestore)
+		return ctrl.Result{}, err
+	}
+
+	if status.Phase == stroomv1.RestorePendingPhase || status.Phase == stroomv1.RestoreScalingDownPhase {
+		if stopped, err := r.scaleDownStroomClusters(ctx, &dbRestore); err != nil {
+			return ctrl.Result{}, err
+		} else if !stopped {
+			if err := r.updateStatus(ctx, &dbRestore); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: RestorePollInterval}, nil
+		}
+
+		r.setPhase(&dbRestore, stroomv1.RestoreRestoringPhase, "Restoring the database")
+		r.Recorder.Eventf(&dbRestore, nil, corev1.EventTypeNormal, "Restoring", "Restore",
+			"Stroom nodes stopped, restoring archive '%v'", dbRestore.Spec.ArchivePath)
+	}
+
+	// Create a ConfigMap containing the restore script
+	scripts, err := readBackupScripts()
+	if err != nil {
+		logger.Error(err, "Could not read backup scripts to populate ConfigMap", "DatabaseRestore", dbRestore.Name)
+		return ctrl.Result{}, err
+	}
+	newConfigMap := r.createScriptsConfigMap(&dbRestore, scripts)
+	existingConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newConfigMap.Name,
+			Namespace: newConfigMap.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, &existingConfigMap, func() error {
+		existingConfigMap.Labels = newConfigMap.Labels
+		existingConfigMap.OwnerReferences = newConfigMap.OwnerReferences
+		existingConfigMap.Data = newConfigMap.Data
+		return nil
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	existingJob := batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: dbRestore.Namespace, Name: dbRestore.GetJobName()}, &existingJob); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		job := r.createRestoreJob(&dbRestore, &dbInfo, sourceVolume, backupName)
+		logger.Info("Creating restore Job", "Namespace", job.Namespace, "Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create restore Job", "Namespace", job.Namespace, "Name", job.Name)
+			return ctrl.Result{}, err
+		}
+		status.JobName = job.Name
+		return ctrl.Result{}, r.updateStatus(ctx, &dbRestore)
+	}
+
+	condition := getJobFinishedCondition(&existingJob)
+	if condition == nil {
+		// Job is still running
+		return ctrl.Result{}, r.updateStatus(ctx, &dbRestore)
+	} else if condition.Type == batchv1.JobFailed {
+		reason := condition.Message
+		if message, err := getJobFailureMessage(ctx, r.Client, &existingJob); err != nil {
+			logger.Error(err, "Could not read the failure message of the restore Job", "Name", existingJob.Name)
+		} else if message != "" {
+			reason = message
+		}
+		return r.fail(ctx, &dbRestore, fmt.Sprintf("Restore Job '%v' failed: %v", existingJob.Name, reason))
+	}
+
+	if result, err := getJobResult(ctx, r.Client, &existingJob); err != nil {
+		logger.Error(err, "Could not read the result of the restore Job", "Name", existingJob.Name)
+	} else if result != nil {
+		status.ArchivePath = result.ArchivePath
+		status.BinaryLogFiles = result.BinaryLogFiles
+	}
+
+	// Scale the StroomClusters back up
+	if err := r.releaseStroomClusters(ctx, &dbRestore); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	status.CompletionTime = &now
+	message := fmt.Sprintf("Archive '%v' restored", status.ArchivePath)
+	if pointInTime := dbRestore.Spec.PointInTime; pointInTime != nil {
+		message = fmt.Sprintf("Archive '%v' restored and %v binary log file(s) replayed up to %v", status.ArchivePath,
+			status.BinaryLogFiles, formatPointInTime(pointInTime))
+	}
+	r.setPhase(&dbRestore, stroomv1.RestoreCompletedPhase, message)
+	r.Recorder.Eventf(&dbRestore, nil, corev1.EventTypeNormal, "Completed", "Restore",
+		"%v. StroomClusters scaled up: %v", message, status.StroomClusters)
+	logger.Info("Database restore completed", "DatabaseRestore", dbRestore.Name, "Archive", status.ArchivePath)
+
+	return ctrl.Result{}, r.updateStatus(ctx, &dbRestore)
+}
+
+// scaleDownStroomClusters annotates each StroomCluster using the target database, which causes its NodeSets to be
+// scaled to zero. Returns true once all Stroom nodes have stopped.
+func (r *DatabaseRestoreReconciler) scaleDownStroomClusters(ctx context.Context, dbRestore *stroomv1.DatabaseRestore) (bool, error) {
+	logger := log.FromContext(ctx)
+	restoreName := types.NamespacedName{Namespace: dbRestore.Namespace, Name: dbRestore.Name}.String()
+
+	stroomClusters := stroomv1.StroomClusterList{}
+	if err := r.List(ctx, &stroomClusters); err != nil {
+		return false, err
+	}
+
+	runningNodes := 0
+	for i := range stroomClusters.Items {
+		stroomCluster := &stroomClusters.Items[i]
+		if !usesDatabaseServer(stroomCluster, &dbRestore.Spec.DatabaseServerRef, dbRestore.Namespace) {
+			continue
+		}
+
+		clusterName := types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.Name}.String()
+		if owner, exists := stroomCluster.Annotations[stroomv1.RestoreInProgressAnnotation]; exists && owner != restoreName {
+			r.setPhase(dbRestore, dbRestore.Status.Phase, fmt.Sprintf("Waiting for DatabaseRestore '%v' to release StroomCluster '%v'", owner, clusterName))
+			return false, nil
+		} else if !exists {
+			if stroomCluster.Annotations == nil {
+				stroomCluster.Annotations = make(map[string]string)
+			}
+			stroomCluster.Annotations[stroomv1.RestoreInProgressAnnotation] = restoreName
+			if err := r.Update(ctx, stroomCluster); err != nil {
+				return false, err
+			}
+			logger.Info("Scaling down StroomCluster for database restore", "StroomCluster", clusterName)
+			r.Recorder.Eventf(dbRestore, stroomCluster, corev1.EventTypeNormal, "ScalingDown", "Restore",
+				"Scaling down StroomCluster '%v'", clusterName)
+		}
+
+		if !slices.Contains(dbRestore.Status.StroomClusters, clusterName) {
+			dbRestore.Status.StroomClusters = append(dbRestore.Status.StroomClusters, clusterName)
+		}
+
+		pods := corev1.PodList{}
+		if err := r.List(ctx, &pods, client.InNamespace(stroomCluster.Namespace), client.MatchingLabels{stroomv1.StroomClusterLabel: stroomCluster.Name}); err != nil {
+			return false, err
+		}
+		runningNodes += len(pods.Items)
+	}
+
+	if runningNodes > 0 {
+		r.setPhase(dbRestore, stroomv1.RestoreScalingDownPhase, fmt.Sprintf("Waiting for %v Stroom nodes to stop", runningNodes))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// releaseStroomClusters removes the restore annotation from StroomClusters scaled down by the DatabaseRestore, so
+// their NodeSets are scaled back up
+func (r *DatabaseRestoreReconciler) releaseStroomClusters(ctx context.Context, dbRestore *stroomv1.DatabaseRestore) error {
+	logger := log.FromContext(ctx)
+	restoreName := types.NamespacedName{Namespace: dbRestore.Namespace, Name: dbRestore.Name}.String()
+
+	for _, clusterName := range dbRestore.Status.StroomClusters {
+		namespace, name, _ := strings.Cut(clusterName, "/")
+		stroomCluster := stroomv1.StroomCluster{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &stroomCluster); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		if stroomCluster.Annotations[stroomv1.RestoreInProgressAnnotation] == restoreName {
+			delete(stroomCluster.Annotations, stroomv1.RestoreInProgressAnnotation)
+			if err := r.Update(ctx, &stroomCluster); err != nil {
+				return err
+			}
+			logger.Info("Scaling up StroomCluster following database restore", "StroomCluster", clusterName)
+		}
+	}
+
+	return nil
+}
+
+// fail halts the restore, scaling any StroomClusters back up
+func (r *DatabaseRestoreReconciler) fail(ctx context.Context, dbRestore *stroomv1.DatabaseRestore, message string) (ctrl.Result, error) {
+	if err := r.releaseStroomClusters(ctx, dbRestore); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	dbRestore.Status.CompletionTime = &now
+	r.setPhase(dbRestore, stroomv1.RestoreFailedPhase, message)
+	r.Recorder.Eventf(dbRestore, nil, corev1.EventTypeWarning, "Failed", "Restore", message)
+	log.FromContext(ctx).Info("Database restore failed", "DatabaseRestore", dbRestore.Name, "Reason", message)
+
+	return ctrl.Result{}, r.updateStatus(ctx, dbRestore)
+}
+
+func (r *DatabaseRestoreReconciler) setPhase(dbRestore *stroomv1.DatabaseRestore, phase stroomv1.DatabaseRestorePhase, message string) {
+	dbRestore.Status.Phase = phase
+	dbRestore.Status.Message = message
+}
+
+func (r *DatabaseRestoreReconciler) updateStatus(ctx context.Context, dbRestore *stroomv1.DatabaseRestore) error {
+	if err := r.Status().Update(ctx, dbRestore); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update DatabaseRestore status", "Namespace", dbRestore.Namespace, "Name", dbRestore.Name)
+		return err
+	}
+
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&stroomv1.DatabaseRestore{}).
+		Owns(&batchv1.Job{}).
+		Complete(instrumentReconciler("DatabaseRestore", r))
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"strings"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("DatabaseRestore", func() {
+
+	Context("isSameDatabaseServer()", func() {
+		It("should resolve DatabaseServer references relative to the owner namespace", func() {
+			ref := stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev"}}
+			otherRef := stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev", Namespace: "stroom"}}
+			Expect(isSameDatabaseServer(&ref, "stroom", &otherRef, "other")).Should(BeTrue())
+			Expect(isSameDatabaseServer(&ref, "other", &otherRef, "other")).Should(BeFalse())
+		})
+		It("should match external servers by address", func() {
+			ref := stroomv1.DatabaseServerRef{ServerAddress: stroomv1.ServerAddress{Host: "mysql", Port: 3306}}
+			otherRef := stroomv1.DatabaseServerRef{ServerAddress: stroomv1.ServerAddress{Host: "mysql", Port: 3306, SecretName: "db"}}
+			Expect(isSameDatabaseServer(&ref, "stroom", &otherRef, "other")).Should(BeTrue())
+
+			otherRef.ServerAddress.Port = 3307
+			Expect(isSameDatabaseServer(&ref, "stroom", &otherRef, "other")).Should(BeFalse())
+		})
+		It("should not match a DatabaseServer to an external server", func() {
+			ref := stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev"}}
+			otherRef := stroomv1.DatabaseServerRef{ServerAddress: stroomv1.ServerAddress{Host: "mysql", Port: 3306}}
+			Expect(isSameDatabaseServer(&ref, "stroom", &otherRef, "stroom")).Should(BeFalse())
+		})
+	})
+
+	Context("usesDatabaseServer()", func() {
+		It("should match the app or statistics database server", func() {
+			stroomCluster := stroomv1.StroomCluster{}
+			stroomCluster.Namespace = "stroom"
+			stroomCluster.Spec.DatabaseServerRef = stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev"}}
+			appRef := stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev"}}
+			statsRef := stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "stats"}}
+			Expect(usesDatabaseServer(&stroomCluster, &appRef, "stroom")).Should(BeTrue())
+			Expect(usesDatabaseServer(&stroomCluster, &statsRef, "stroom")).Should(BeFalse())
+
+			stroomCluster.Spec.StatsDatabaseServerRef = &stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "stats"}}
+			Expect(usesDatabaseServer(&stroomCluster, &statsRef, "stroom")).Should(BeTrue())
+		})
+	})
+
+	Context("createRestoreJob()", func() {
+		It("should keep the names of the restore Job and its scripts ConfigMap within their limits", func() {
+			reconciler := DatabaseRestoreReconciler{Scheme: runtime.NewScheme()}
+			dbRestore := stroomv1.DatabaseRestore{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 60), Namespace: "stroom"}}
+			job := reconciler.createRestoreJob(&dbRestore, &DatabaseConnectionInfo{}, &corev1.VolumeSource{}, "dev")
+			Expect(job.Name).Should(HaveLen(stroomv1.JobNameMaxLength))
+			Expect(job.Spec.Template.Spec.Volumes).Should(ContainElement(HaveField("VolumeSource.ConfigMap.Name", dbRestore.GetScriptsConfigMapName())))
+			Expect(dbRestore.GetScriptsConfigMapName()).Should(HaveLen(stroomv1.JobNameMaxLength))
+			Expect(dbRestore.GetScriptsConfigMapName()).ShouldNot(Equal(job.Name))
+
+			dbRestore.Name = "dev"
+			Expect(dbRestore.GetJobName()).Should(Equal("stroom-dev-db-restore"))
+		})
+	})
+})
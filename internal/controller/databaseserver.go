@@ -2,6 +2,7 @@ package controller
 
 import (
 	"fmt"
+	"path"
 	"strconv"
 	"strings"
 
@@ -9,13 +10,17 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 const (
-	DatabaseRootUserName          = "root"
-	DatabaseServiceUserName       = "stroomuser"
-	DatabasePort            int32 = 3306
+	DatabaseRootUserName               = "root"
+	DatabaseServiceUserName            = "stroomuser"
+	DatabaseReplicationUserName        = "replication"
+	DatabasePort                 int32 = 3306
+	DatabaseGroupReplicationPort int32 = 33061
+	DatabaseTlsMountPath               = "/etc/mysql/tls"
 )
 
 func (r *DatabaseServerReconciler) getInitConfigName(dbServer *stroomv1.DatabaseServer) string {
@@ -33,6 +38,10 @@ func (r *DatabaseServerReconciler) createSecret(dbServer *stroomv1.DatabaseServe
 		Data: map[string][]byte{
 			DatabaseRootUserName:    stroomv1.GeneratePassword(),
 			DatabaseServiceUserName: stroomv1.GeneratePassword(),
+			// Used by members of a replication group to recover missing transactions from one another
+			DatabaseReplicationUserName: stroomv1.GeneratePassword(),
+			// Used by the metrics exporter, if enabled
+			DatabaseMonitoringUserName: stroomv1.GeneratePassword(),
 		},
 	}
 
@@ -47,6 +56,54 @@ func (r *DatabaseServerReconciler) createConfigMap(dbServer *stroomv1.DatabaseSe
 		additionalConfig = strings.Join(dbServer.Spec.AdditionalConfig, "\n")
 	}
 
+	// Binary log files are named `binlog.NNNNNN`, as expected by the binary log shipper and restore scripts
+	binaryLogConfig := ""
+	if dbServer.Spec.BinaryLog != nil || dbServer.IsGroupReplicated() {
+		binaryLogConfig = "" +
+			"log_bin=binlog\n" +
+			"binlog_format=ROW\n" +
+			"sync_binlog=1\n"
+	}
+	if binaryLog := dbServer.Spec.BinaryLog; binaryLog != nil {
+		binaryLogConfig += "" +
+			"binlog_expire_logs_seconds=" + strconv.Itoa(binaryLog.ExpireDays*24*60*60) + "\n" +
+			"max_binlog_size=" + strconv.Itoa(binaryLog.MaxFileSizeMB) + "M\n"
+	}
+
+	// Members are started and joined to the group by the operator. Once a member has joined, the operator persists
+	// `group_replication_start_on_boot`, so it rejoins after a restart. Until it does, the member is read-only.
+	groupReplicationConfig := ""
+	if dbServer.IsGroupReplicated() {
+		groupReplicationConfig = "" +
+			"gtid_mode=ON\n" +
+			"enforce_gtid_consistency=ON\n" +
+			"plugin_load_add=group_replication.so\n" +
+			"plugin_load_add=mysql_clone.so\n" +
+			"loose_group_replication_group_name=" + string(dbServer.UID) + "\n" +
+			"loose_group_replication_single_primary_mode=ON\n" +
+			"loose_group_replication_start_on_boot=OFF\n" +
+			"loose_group_replication_bootstrap_group=OFF\n" +
+			"loose_group_replication_ssl_mode=REQUIRED\n" +
+			"loose_group_replication_recovery_use_ssl=ON\n"
+	}
+
+	// Clients must connect using TLS, except via the local socket used by the probes. Members of a replication group
+	// verify the identity of one another.
+	tlsConfig := ""
+	if !dbServer.Spec.Tls.IsZero() {
+		tlsConfig = "" +
+			"ssl_ca=" + path.Join(DatabaseTlsMountPath, "ca.crt") + "\n" +
+			"ssl_cert=" + path.Join(DatabaseTlsMountPath, "tls.crt") + "\n" +
+			"ssl_key=" + path.Join(DatabaseTlsMountPath, "tls.key") + "\n" +
+			"require_secure_transport=ON\n"
+		if dbServer.IsGroupReplicated() {
+			groupReplicationConfig = strings.Replace(groupReplicationConfig, "loose_group_replication_ssl_mode=REQUIRED", "loose_group_replication_ssl_mode=VERIFY_IDENTITY", 1)
+			tlsConfig += "" +
+				"loose_group_replication_recovery_ssl_ca=" + path.Join(DatabaseTlsMountPath, "ca.crt") + "\n" +
+				"loose_group_replication_recovery_ssl_verify_server_cert=ON\n"
+		}
+	}
+
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      dbServer.GetBaseName(),
@@ -59,9 +116,15 @@ func (r *DatabaseServerReconciler) createConfigMap(dbServer *stroomv1.DatabaseSe
 				"datadir=/var/lib/mysql\n" +
 				"port=" + strconv.Itoa(int(DatabasePort)) + "\n" +
 				"user=mysql\n" +
+				binaryLogConfig +
+				groupReplicationConfig +
+				tlsConfig +
 				additionalConfig,
 		},
 	}
+	if dbServer.Spec.Metrics != nil {
+		configMap.Data[DatabaseExporterConfigKey] = createExporterConfig(dbServer)
+	}
 
 	ctrl.SetControllerReference(dbServer, configMap, r.Scheme)
 	return configMap
@@ -94,15 +157,48 @@ func (r *DatabaseServerReconciler) createDbInitConfigMap(dbServer *stroomv1.Data
 		},
 	}
 
+	if dbServer.IsGroupReplicated() {
+		// Each member is initialised independently with the same users and databases. Discard the transactions
+		// recorded while doing so, otherwise members cannot join the group, as they would appear to have diverged.
+		// Scripts run in alphabetical order.
+		configMap.Data["zz-reset-gtids.sql"] = "" +
+			"-- Discard transactions executed during initialisation\n" +
+			"RESET MASTER;"
+	}
+
 	ctrl.SetControllerReference(dbServer, configMap, r.Scheme)
 	return configMap
 }
 
-func (r *DatabaseServerReconciler) createStatefulSet(dbServer *stroomv1.DatabaseServer) *appsv1.StatefulSet {
+func (r *DatabaseServerReconciler) createScriptsConfigMap(dbServer *stroomv1.DatabaseServer, data map[string]string) *corev1.ConfigMap {
+	configMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dbServer.GetScriptsConfigMapName(),
+			Namespace: dbServer.Namespace,
+			Labels:    dbServer.GetLabels(),
+		},
+		Data: data,
+	}
+
+	ctrl.SetControllerReference(dbServer, &configMap, r.Scheme)
+	return &configMap
+}
+
+// createStatefulSet creates a StatefulSet running either a single instance of MySQL, or the members of a replication
+// group. If binary logging is enabled, dbBackup is the DatabaseBackup to whose volume and/or object storage closed
+// binary log files are shipped. configHash is the digest of the MySQL configuration.
+func (r *DatabaseServerReconciler) createStatefulSet(dbServer *stroomv1.DatabaseServer, dbBackup *stroomv1.DatabaseBackup, configHash string) *appsv1.StatefulSet {
 	var replicas int32 = 1
+	if dbServer.IsGroupReplicated() {
+		replicas = dbServer.Spec.Replicas
+	}
 
-	// DefaultSecretFileMode is the file mode to use for Secret volume mounts
-	secretFileMode := stroomv1.SecretFileMode
+	podAnnotations := map[string]string{
+		stroomv1.ConfigHashAnnotation: configHash,
+	}
+	for key, value := range dbServer.Spec.PodAnnotations {
+		podAnnotations[key] = value
+	}
 
 	statefulSet := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -118,7 +214,7 @@ func (r *DatabaseServerReconciler) createStatefulSet(dbServer *stroomv1.Database
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Annotations: dbServer.Annotations,
+					Annotations: podAnnotations,
 					Labels:      dbServer.GetLabels(),
 				},
 				Spec: corev1.PodSpec{
@@ -127,8 +223,22 @@ func (r *DatabaseServerReconciler) createStatefulSet(dbServer *stroomv1.Database
 						Image:           dbServer.Spec.Image.String(),
 						ImagePullPolicy: dbServer.Spec.ImagePullPolicy,
 						Env: []corev1.EnvVar{{
-							Name:  "MYSQL_ROOT_PASSWORD",
-							Value: "/etc/mysql/password/root",
+							// Only applied when the data directory is initialised. Servers created with the legacy root
+							// password are migrated by openRootDatabase.
+							Name: "MYSQL_ROOT_PASSWORD",
+							ValueFrom: &corev1.EnvVarSource{
+								SecretKeyRef: &corev1.SecretKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: dbServer.GetBaseName(),
+									},
+									Key: DatabaseRootUserName,
+								},
+							},
+						}, {
+							// Allow the operator and backup Jobs to connect as root. Like MYSQL_ROOT_PASSWORD, this only
+							// applies when the data directory is initialised.
+							Name:  "MYSQL_ROOT_HOST",
+							Value: "%",
 						}, {
 							Name:  "MYSQL_USER",
 							Value: DatabaseServiceUserName,
@@ -164,11 +274,6 @@ func (r *DatabaseServerReconciler) createStatefulSet(dbServer *stroomv1.Database
 						}, {
 							Name:      "data",
 							MountPath: "/var/lib/mysql",
-						}, {
-							Name:      "root-password",
-							MountPath: "/etc/mysql/password/root",
-							SubPath:   DatabaseRootUserName,
-							ReadOnly:  true,
 						}},
 					}},
 					SecurityContext: &dbServer.Spec.PodSecurityContext,
@@ -193,18 +298,6 @@ func (r *DatabaseServerReconciler) createStatefulSet(dbServer *stroomv1.Database
 								},
 							},
 						},
-					}, {
-						Name: "root-password",
-						VolumeSource: corev1.VolumeSource{
-							Secret: &corev1.SecretVolumeSource{
-								SecretName: dbServer.GetBaseName(),
-								Items: []corev1.KeyToPath{{
-									Key:  DatabaseRootUserName,
-									Path: DatabaseRootUserName,
-									Mode: &secretFileMode,
-								}},
-							},
-						},
 					}},
 				},
 			},
@@ -217,10 +310,151 @@ func (r *DatabaseServerReconciler) createStatefulSet(dbServer *stroomv1.Database
 		},
 	}
 
+	if !dbServer.Spec.Tls.IsZero() {
+		// MySQL runs as a non-root user, so the key must be readable by all users in the container
+		var tlsFileMode int32 = 0444
+		podSpec := &statefulSet.Spec.Template.Spec
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "tls",
+			MountPath: DatabaseTlsMountPath,
+			ReadOnly:  true,
+		})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  dbServer.Spec.Tls.SecretName,
+					DefaultMode: &tlsFileMode,
+				},
+			},
+		})
+	}
+
+	if dbServer.IsGroupReplicated() {
+		// Members must be able to resolve one another before they are ready, to form the group. Each member reports
+		// its DNS name, so it can be reached by members recovering transactions from it.
+		statefulSet.Spec.PodManagementPolicy = appsv1.ParallelPodManagement
+		container := &statefulSet.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name: "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			},
+		})
+		memberHost := fmt.Sprintf("$(POD_NAME).%v", dbServer.GetServiceFqdn())
+		container.Args = []string{
+			"--report-host=" + memberHost,
+			fmt.Sprintf("--loose-group-replication-local-address=%v:%v", memberHost, DatabaseGroupReplicationPort),
+		}
+		container.Ports = append(container.Ports, corev1.ContainerPort{
+			Name:          "replication",
+			ContainerPort: DatabaseGroupReplicationPort,
+			Protocol:      corev1.ProtocolTCP,
+		})
+	}
+
+	if dbServer.Spec.BinaryLog != nil && dbBackup != nil {
+		podSpec := &statefulSet.Spec.Template.Spec
+		container, volumes := createBinaryLogShipper(dbServer, dbBackup)
+		podSpec.Containers = append(podSpec.Containers, container)
+		podSpec.Volumes = append(podSpec.Volumes, volumes...)
+	}
+
+	if dbServer.Spec.Metrics != nil {
+		podSpec := &statefulSet.Spec.Template.Spec
+		podSpec.Containers = append(podSpec.Containers, createMetricsExporter(dbServer))
+	}
+
 	ctrl.SetControllerReference(dbServer, statefulSet, r.Scheme)
 	return statefulSet
 }
 
+// createBinaryLogShipper creates a sidecar container that ships closed binary log files from the data volume to the
+// volume and/or object storage of a DatabaseBackup, along with the additional volumes it requires
+func createBinaryLogShipper(dbServer *stroomv1.DatabaseServer, dbBackup *stroomv1.DatabaseBackup) (corev1.Container, []corev1.Volume) {
+	const dataDirectory = "/var/lib/mysql"
+	const scriptsPath = "/stroom-backup/scripts"
+	const backupDirectory = "/stroom-backup/data"
+	const stateDirectory = "/stroom-backup/state"
+	binaryLog := dbServer.Spec.BinaryLog
+
+	// Scripts need execute permissions
+	var scriptFileMode int32 = 0555
+
+	env := []corev1.EnvVar{{
+		Name:  "MYSQL_DATA_DIR",
+		Value: dataDirectory,
+	}, {
+		Name:  "STATE_DIR",
+		Value: stateDirectory,
+	}, {
+		Name:  "SHIP_INTERVAL_SECS",
+		Value: strconv.Itoa(binaryLog.ShipIntervalSeconds),
+	}, {
+		Name:  "ARCHIVE_RETENTION_DAYS",
+		Value: strconv.Itoa(binaryLog.ArchiveRetentionDays),
+	}}
+	volumeMounts := []corev1.VolumeMount{{
+		Name:      "data",
+		MountPath: dataDirectory,
+		ReadOnly:  true,
+	}, {
+		Name:      "scripts",
+		MountPath: scriptsPath,
+		ReadOnly:  true,
+	}, {
+		Name:      "binlog-state",
+		MountPath: stateDirectory,
+	}}
+	volumes := []corev1.Volume{{
+		Name: "scripts",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: dbServer.GetScriptsConfigMapName(),
+				},
+				DefaultMode: &scriptFileMode,
+			},
+		},
+	}, {
+		Name: "binlog-state",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}}
+
+	if dbBackup.Spec.TargetVolume != nil {
+		env = append(env, corev1.EnvVar{Name: "BINLOG_DIR", Value: path.Join(backupDirectory, "binlog")})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "backup",
+			MountPath: backupDirectory,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name:         "backup",
+			VolumeSource: *dbBackup.Spec.TargetVolume,
+		})
+	}
+
+	scriptPath := path.Join(scriptsPath, "ship-binlogs.sh")
+	var container corev1.Container
+	if objectStorage := dbBackup.Spec.ObjectStorage; objectStorage != nil {
+		// Use the object storage image, as it contains the AWS CLI
+		container = *createObjectStorageContainer("binlog-shipper", objectStorage, env, volumeMounts, scriptPath)
+	} else {
+		container = corev1.Container{
+			Name:            "binlog-shipper",
+			Image:           dbServer.Spec.Image.String(),
+			ImagePullPolicy: dbServer.Spec.ImagePullPolicy,
+			Command:         []string{scriptPath},
+			Env:             env,
+			VolumeMounts:    volumeMounts,
+		}
+	}
+	container.Resources = binaryLog.Resources
+
+	return container, volumes
+}
+
 func (r *DatabaseServerReconciler) createReadinessProbe(timings stroomv1.ProbeTimings) *corev1.Probe {
 	return &corev1.Probe{
 		ProbeHandler: corev1.ProbeHandler{
@@ -271,6 +505,55 @@ func (r *DatabaseServerReconciler) createService(dbServer *stroomv1.DatabaseServ
 			Type:      corev1.ServiceTypeClusterIP,
 			ClusterIP: corev1.ClusterIPNone,
 			Selector:  labels,
+			Ports: []corev1.ServicePort{{
+				Name:       "tcp",
+				Port:       DatabasePort,
+				TargetPort: intstr.FromInt32(DatabasePort),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+
+	if dbServer.IsGroupReplicated() {
+		// Members address one another by their DNS names while the group is forming
+		service.Spec.PublishNotReadyAddresses = true
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       "replication",
+			Port:       DatabaseGroupReplicationPort,
+			TargetPort: intstr.FromInt32(DatabaseGroupReplicationPort),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+
+	// Scraped from each instance, through the endpoints of the headless Service
+	if dbServer.Spec.Metrics != nil {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       DatabaseMetricsPortName,
+			Port:       DatabaseMetricsPort,
+			TargetPort: intstr.FromInt32(DatabaseMetricsPort),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+
+	ctrl.SetControllerReference(dbServer, service, r.Scheme)
+	return service
+}
+
+// createPrimaryService creates a Service routing connections to the primary member of a replication group, which is
+// labelled by the operator
+func (r *DatabaseServerReconciler) createPrimaryService(dbServer *stroomv1.DatabaseServer) *corev1.Service {
+	selector := dbServer.GetLabels()
+	selector[stroomv1.DatabaseRoleLabel] = DatabasePrimaryRole
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dbServer.GetPrimaryServiceName(),
+			Namespace: dbServer.Namespace,
+			Labels:    dbServer.GetLabels(),
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: selector,
 			Ports: []corev1.ServicePort{{
 				Name:     "tcp",
 				Port:     DatabasePort,
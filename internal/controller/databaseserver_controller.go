@@ -24,35 +24,43 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	common "github.com/gradata-systems/stroom-k8s-operator/internal/controller/common"
 )
 
 // DatabaseServerReconciler reconciles a DatabaseServer object
 type DatabaseServerReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Log    logr.Logger
+	Scheme   *runtime.Scheme
+	Log      logr.Logger
+	Recorder events.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databaseservers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databaseservers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databaseservers/finalizers,verbs=update
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=stroomclusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databasebackups,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -92,72 +100,188 @@ func (r *DatabaseServerReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	} else if !result.IsZero() {
 		return result, nil
 	}
+	if dbServer.Spec.Metrics != nil {
+		if err := r.ensureMonitoringPassword(ctx, &foundSecret); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
-	foundConfigMap := corev1.ConfigMap{}
-	result, err = r.getOrCreateObject(ctx, dbServer.GetConfigMapName(), dbServer.Namespace, "ConfigMap", &foundConfigMap, func() error {
-		// Generate a ConfigMap containing the MySQL database configuration
-		resource := r.createConfigMap(&dbServer)
-		logger.Info("Creating a new ConfigMap", "Namespace", resource.Namespace, "Name", resource.Name)
-		return r.Create(ctx, resource)
-	})
-	if err != nil {
-		return result, err
-	} else if !result.IsZero() {
-		return result, nil
+	// Generate a ConfigMap containing the MySQL database configuration
+	configMap := r.createConfigMap(&dbServer)
+	if err := r.createOrUpdateConfigMap(ctx, configMap); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	foundInitConfigMap := corev1.ConfigMap{}
-	result, err = r.getOrCreateObject(ctx, dbServer.GetInitConfigMapName(), dbServer.Namespace, "ConfigMap", &foundInitConfigMap, func() error {
-		// Generate a ConfigMap containing database initialisation scripts
-		resource := r.createDbInitConfigMap(&dbServer)
-		logger.Info("Creating a new ConfigMap", "Namespace", resource.Namespace, "Name", resource.Name)
-		return r.Create(ctx, resource)
-	})
-	if err != nil {
-		return result, err
-	} else if !result.IsZero() {
-		return result, nil
+	// Generate a ConfigMap containing database initialisation scripts. These only run when an instance is first
+	// started, so changes only affect new instances.
+	if err := r.createOrUpdateConfigMap(ctx, r.createDbInitConfigMap(&dbServer)); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	foundStatefulSet := appsv1.StatefulSet{}
-	result, err = r.getOrCreateObject(ctx, dbServer.GetBaseName(), dbServer.Namespace, "StatefulSet", &foundStatefulSet, func() error {
-		// Generate a StatefulSet for running a single instance of MySQL
-		resource := r.createStatefulSet(&dbServer)
-		logger.Info("Creating a new StatefulSet", "Namespace", resource.Namespace, "Name", resource.Name)
-		return r.Create(ctx, resource)
-	})
-	if err != nil {
-		r.setStatusUndeployed(ctx, &dbServer)
-		return result, err
-	} else if !result.IsZero() {
-		r.setStatusUndeployed(ctx, &dbServer)
-		return result, nil
+	// Binary logs are shipped to the target of a DatabaseBackup, by a sidecar running the backup scripts
+	var dbBackup *stroomv1.DatabaseBackup
+	if binaryLog := dbServer.Spec.BinaryLog; binaryLog != nil {
+		dbBackup = &stroomv1.DatabaseBackup{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: dbServer.Namespace, Name: binaryLog.BackupName}, dbBackup); err != nil {
+			logger.Error(err, "Could not get the DatabaseBackup that binary logs are shipped to", "Namespace", dbServer.Namespace, "Name", binaryLog.BackupName)
+			return ctrl.Result{}, err
+		}
+
+		scripts, err := readBackupScripts()
+		if err != nil {
+			logger.Error(err, "Could not read backup scripts to populate ConfigMap", "DatabaseServer", dbServer.Name)
+			return ctrl.Result{}, err
+		}
+		if err := r.createOrUpdateConfigMap(ctx, r.createScriptsConfigMap(&dbServer, scripts)); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
-	foundService := corev1.Service{}
-	result, err = r.getOrCreateObject(ctx, dbServer.GetServiceName(), dbServer.Namespace, "Service", &foundService, func() error {
-		// Create a headless service
-		resource := r.createService(&dbServer)
-		logger.Info("Creating a new Service", "Namespace", resource.Namespace, "Name", resource.Name)
-		return r.Create(ctx, resource)
+	// Generate a StatefulSet for running the MySQL instances. Its Pods are restarted when the configuration changes.
+	newStatefulSet := r.createStatefulSet(&dbServer, dbBackup, common.HashConfigData(configMap.Data))
+	existingStatefulSet := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newStatefulSet.Name,
+			Namespace: newStatefulSet.Namespace,
+		},
+	}
+	operationResult, err := controllerutil.CreateOrUpdate(ctx, r.Client, &existingStatefulSet, func() error {
+		existingStatefulSet.Labels = newStatefulSet.Labels
+		existingStatefulSet.OwnerReferences = newStatefulSet.OwnerReferences
+		if existingStatefulSet.CreationTimestamp.IsZero() {
+			existingStatefulSet.Spec = newStatefulSet.Spec
+		} else {
+			// Other fields of a StatefulSet spec are immutable. Departing replication group members leave the group
+			// gracefully as they shut down.
+			existingStatefulSet.Spec.Replicas = newStatefulSet.Spec.Replicas
+			existingStatefulSet.Spec.Template = newStatefulSet.Spec.Template
+		}
+		return nil
 	})
 	if err != nil {
+		logger.Error(err, "Failed to create or update StatefulSet", "Namespace", newStatefulSet.Namespace, "Name", newStatefulSet.Name)
 		r.setStatusUndeployed(ctx, &dbServer)
-		return result, err
-	} else if !result.IsZero() {
+		return ctrl.Result{}, err
+	} else if operationResult != controllerutil.OperationResultNone {
+		logger.Info("StatefulSet reconciled", "Result", operationResult, "Namespace", existingStatefulSet.Namespace, "Name", existingStatefulSet.Name)
+	}
+
+	// Create a headless service. Its ports are updated when metrics are enabled or disabled.
+	if err := r.createOrUpdateService(ctx, r.createService(&dbServer)); err != nil {
 		r.setStatusUndeployed(ctx, &dbServer)
-		return result, nil
+		return ctrl.Result{}, err
+	}
+
+	if dbServer.IsGroupReplicated() {
+		foundPrimaryService := corev1.Service{}
+		result, err = r.getOrCreateObject(ctx, dbServer.GetPrimaryServiceName(), dbServer.Namespace, "Service", &foundPrimaryService, func() error {
+			// Create a Service routing to the primary member
+			resource := r.createPrimaryService(&dbServer)
+			logger.Info("Creating a new Service", "Namespace", resource.Namespace, "Name", resource.Name)
+			return r.Create(ctx, resource)
+		})
+		if err != nil {
+			r.setStatusUndeployed(ctx, &dbServer)
+			return result, err
+		} else if !result.IsZero() {
+			r.setStatusUndeployed(ctx, &dbServer)
+			return result, nil
+		}
+
+		if err := r.reconcileGroupReplication(ctx, &dbServer); err != nil {
+			logger.Error(err, "Failed to reconcile replication group", "DatabaseServer", dbServer.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Create any databases added since the instances were initialised, once a writable instance is available
+	result = ctrl.Result{}
+	if existingStatefulSet.Status.ReadyReplicas > 0 && (!dbServer.IsGroupReplicated() || dbServer.Status.Primary != "") {
+		if err := r.reconcileDatabases(ctx, &dbServer); err != nil {
+			logger.Error(err, "Failed to reconcile databases", "DatabaseServer", dbServer.Name)
+			result.RequeueAfter = DatabaseRetryInterval
+		} else if requeueAfter, err := r.reconcileCredentialRotation(ctx, &dbServer); err != nil {
+			result.RequeueAfter = DatabaseRetryInterval
+		} else {
+			result.RequeueAfter = requeueAfter
+		}
 	}
 
 	dbServer.Status.State = "Deployed"
-	dbServer.Status.Address = dbServer.GetServiceName()
+	if dbServer.IsGroupReplicated() && dbServer.Status.Primary == "" {
+		dbServer.Status.State = "NoPrimary"
+	}
+	dbServer.Status.Address = dbServer.GetClientServiceName()
 	dbServer.Status.Port = DatabasePort
+	dbServer.Status.ObservedGeneration = dbServer.Generation
 	if err := r.Status().Update(ctx, &dbServer); err != nil {
 		logger.Error(err, "Failed to update DatabaseServer status")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	if dbServer.IsGroupReplicated() && (result.RequeueAfter == 0 || GroupMonitorInterval < result.RequeueAfter) {
+		// Check the group periodically, as a failover does not necessarily change any Kubernetes resource
+		result.RequeueAfter = GroupMonitorInterval
+	}
+	return result, nil
+}
+
+// createOrUpdateConfigMap creates a ConfigMap owned by a DatabaseServer, or updates its data to match
+func (r *DatabaseServerReconciler) createOrUpdateConfigMap(ctx context.Context, newConfigMap *corev1.ConfigMap) error {
+	logger := log.FromContext(ctx)
+
+	existingConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newConfigMap.Name,
+			Namespace: newConfigMap.Namespace,
+		},
+	}
+	operationResult, err := controllerutil.CreateOrUpdate(ctx, r.Client, &existingConfigMap, func() error {
+		existingConfigMap.Labels = newConfigMap.Labels
+		existingConfigMap.OwnerReferences = newConfigMap.OwnerReferences
+		existingConfigMap.Data = newConfigMap.Data
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "Failed to create or update ConfigMap", "Namespace", newConfigMap.Namespace, "Name", newConfigMap.Name)
+		return err
+	} else if operationResult != controllerutil.OperationResultNone {
+		logger.Info("ConfigMap reconciled", "Result", operationResult, "Namespace", existingConfigMap.Namespace, "Name", existingConfigMap.Name)
+	}
+
+	return nil
+}
+
+// createOrUpdateService creates a Service owned by a DatabaseServer, or updates its ports to match
+func (r *DatabaseServerReconciler) createOrUpdateService(ctx context.Context, newService *corev1.Service) error {
+	logger := log.FromContext(ctx)
+
+	existingService := corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newService.Name,
+			Namespace: newService.Namespace,
+		},
+	}
+	operationResult, err := controllerutil.CreateOrUpdate(ctx, r.Client, &existingService, func() error {
+		existingService.Labels = newService.Labels
+		existingService.OwnerReferences = newService.OwnerReferences
+		if existingService.CreationTimestamp.IsZero() {
+			existingService.Spec = newService.Spec
+		} else {
+			// The cluster IP of a Service cannot be changed
+			existingService.Spec.Ports = newService.Spec.Ports
+			existingService.Spec.PublishNotReadyAddresses = newService.Spec.PublishNotReadyAddresses
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "Failed to create or update Service", "Namespace", newService.Namespace, "Name", newService.Name)
+		return err
+	} else if operationResult != controllerutil.OperationResultNone {
+		logger.Info("Service reconciled", "Result", operationResult, "Namespace", existingService.Namespace, "Name", existingService.Name)
+	}
+
+	return nil
 }
 
 func (r *DatabaseServerReconciler) setStatusUndeployed(ctx context.Context, dbServer *stroomv1.DatabaseServer) {
@@ -166,6 +290,8 @@ func (r *DatabaseServerReconciler) setStatusUndeployed(ctx context.Context, dbSe
 	dbServer.Status.State = "Undeployed"
 	dbServer.Status.Address = ""
 	dbServer.Status.Port = 0
+	dbServer.Status.Primary = ""
+	dbServer.Status.Members = nil
 	if err := r.Status().Update(ctx, dbServer); err != nil {
 		logger.Error(err, "Failed to update DatabaseServer status")
 	}
@@ -181,10 +307,17 @@ func (r *DatabaseServerReconciler) checkIfDeleted(ctx context.Context, dbServer
 
 	} else {
 		if controllerutil.ContainsFinalizer(dbServer, stroomv1.StroomClusterFinalizerName) {
-			// Finalizer is present, so check whether the DatabaseServer is claimed by a StroomCluster
-			if dbServer.StroomClusterRef != (stroomv1.ResourceRef{}) {
+			// Finalizer is present, so check whether the DatabaseServer is claimed by any StroomCluster
+			clusterRefs := []stroomv1.ResourceRef{dbServer.StroomClusterRef}
+			for _, claim := range dbServer.StroomClusterClaims {
+				clusterRefs = append(clusterRefs, claim.StroomClusterRef)
+			}
+			for _, clusterRef := range clusterRefs {
+				if clusterRef.IsZero() {
+					continue
+				}
 				stroomCluster := stroomv1.StroomCluster{}
-				if err := r.Get(ctx, types.NamespacedName{Name: dbServer.StroomClusterRef.Name, Namespace: dbServer.StroomClusterRef.Namespace}, &stroomCluster); err == nil {
+				if err := r.Get(ctx, clusterRef.NamespacedName(), &stroomCluster); err == nil {
 					// Related StroomCluster resource exists, so block deletion
 					logger.Info(fmt.Sprintf("DatabaseServer will be deleted once StroomCluster '%v/%v' is deleted", stroomCluster.Namespace, stroomCluster.Name))
 					return true, nil
@@ -236,5 +369,20 @@ func (r *DatabaseServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&stroomv1.DatabaseServer{}).
 		Owns(&appsv1.StatefulSet{}).
-		Complete(r)
+		Owns(&corev1.ConfigMap{}).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(mapDatabasePodToDatabaseServer)).
+		Complete(instrumentReconciler("DatabaseServer", r))
+}
+
+// mapDatabasePodToDatabaseServer enqueues the DatabaseServer running a MySQL instance, so a change of primary is
+// detected as soon as a member Pod fails
+func mapDatabasePodToDatabaseServer(_ context.Context, pod client.Object) []reconcile.Request {
+	labels := pod.GetLabels()
+	if labels["app.kubernetes.io/component"] != "database-server" || labels["app.kubernetes.io/instance"] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Namespace: pod.GetNamespace(), Name: labels["app.kubernetes.io/instance"]},
+	}}
 }
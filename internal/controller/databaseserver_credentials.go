@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// CredentialRotationCheckInterval is how often to check whether Stroom nodes have restarted with new passwords
+	CredentialRotationCheckInterval = time.Second * 30
+
+	// pendingPasswordKeySuffix is appended to a user name to form the Secret key holding its new password, while the
+	// password is being changed
+	pendingPasswordKeySuffix = "-next"
+)
+
+// rotatedAccount is a MySQL user whose password is rotated, along with the Secret containing its password
+type rotatedAccount struct {
+	userName  string
+	secretRef types.NamespacedName
+}
+
+// getRotatedAccounts returns the users whose passwords are rotated: the Stroom service user, the user of each
+// StroomCluster claiming a multi-tenant DatabaseServer, and root. The operator connects as root, so it is rotated last.
+func getRotatedAccounts(dbServer *stroomv1.DatabaseServer) []rotatedAccount {
+	secretRef := types.NamespacedName{Namespace: dbServer.Namespace, Name: dbServer.GetSecretName()}
+	accounts := []rotatedAccount{{userName: DatabaseServiceUserName, secretRef: secretRef}}
+	for _, claim := range dbServer.StroomClusterClaims {
+		accounts = append(accounts, rotatedAccount{
+			userName:  claim.UserName,
+			secretRef: types.NamespacedName{Namespace: claim.StroomClusterRef.Namespace, Name: claim.SecretName},
+		})
+	}
+	return append(accounts, rotatedAccount{userName: DatabaseRootUserName, secretRef: secretRef})
+}
+
+// getNextCredentialRotation returns when the passwords are next due to be rotated, or the zero time if they are only
+// rotated on demand
+func getNextCredentialRotation(dbServer *stroomv1.DatabaseServer) time.Time {
+	intervalDays := dbServer.Spec.CredentialRotation.IntervalDays
+	if intervalDays == 0 {
+		return time.Time{}
+	}
+
+	lastRotationTime := dbServer.CreationTimestamp.Time
+	if status := dbServer.Status.CredentialRotation; status.LastRotationTime != nil {
+		lastRotationTime = status.LastRotationTime.Time
+	}
+	return lastRotationTime.AddDate(0, 0, intervalDays)
+}
+
+// isCredentialRotationDue returns whether the passwords are due to be rotated, either because the rotation interval
+// has elapsed, or rotation was requested by changing the annotation value
+func isCredentialRotationDue(dbServer *stroomv1.DatabaseServer, now time.Time) bool {
+	if request := dbServer.Annotations[stroomv1.RotateCredentialsAnnotation]; request != "" && request != dbServer.Status.CredentialRotation.LastRequest {
+		return true
+	}
+
+	nextRotation := getNextCredentialRotation(dbServer)
+	return !nextRotation.IsZero() && !now.Before(nextRotation)
+}
+
+// getCredentialsRotatedValue returns the value of the annotation that restarts Stroom nodes once the passwords of a
+// DatabaseServer are rotated
+func getCredentialsRotatedValue(dbServer *stroomv1.DatabaseServer) string {
+	if lastRotationTime := dbServer.Status.CredentialRotation.LastRotationTime; lastRotationTime != nil {
+		return lastRotationTime.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+// reconcileCredentialRotation rotates the passwords of the root, Stroom service and tenant users when due. Each user is given
+// a new password while retaining the current one, until the Stroom nodes of each StroomCluster using the
+// DatabaseServer have restarted. Returns how long to wait before checking again, or 0 if there is nothing to wait for.
+func (r *DatabaseServerReconciler) reconcileCredentialRotation(ctx context.Context, dbServer *stroomv1.DatabaseServer) (time.Duration, error) {
+	logger := log.FromContext(ctx)
+	status := &dbServer.Status.CredentialRotation
+
+	if status.PendingDiscard {
+		if restarted, err := r.areStroomNodesRestarted(ctx, dbServer); err != nil {
+			return 0, err
+		} else if !restarted {
+			return CredentialRotationCheckInterval, nil
+		}
+
+		if err := r.changePasswords(ctx, dbServer, getRotatedAccounts(dbServer), "ALTER USER %v DISCARD OLD PASSWORD", nil); err != nil {
+			logger.Error(err, "Failed to discard old passwords", "DatabaseServer", dbServer.Name)
+			return 0, err
+		}
+		status.PendingDiscard = false
+		r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "CredentialsRotated", "RotateCredentials",
+			"Stroom nodes restarted with the new passwords and the previous passwords were discarded")
+	}
+
+	if !isCredentialRotationDue(dbServer, time.Now()) {
+		if nextRotation := getNextCredentialRotation(dbServer); !nextRotation.IsZero() {
+			return time.Until(nextRotation), nil
+		}
+		return 0, nil
+	}
+
+	if err := r.rotatePasswords(ctx, dbServer); err != nil {
+		logger.Error(err, "Failed to rotate passwords", "DatabaseServer", dbServer.Name)
+		return 0, err
+	}
+	now := metav1.Now()
+	status.LastRotationTime = &now
+	status.LastRequest = dbServer.Annotations[stroomv1.RotateCredentialsAnnotation]
+	status.PendingDiscard = true
+	r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "CredentialRotationStarted", "RotateCredentials",
+		"Passwords changed. Restarting Stroom nodes before discarding the previous passwords.")
+
+	return CredentialRotationCheckInterval, nil
+}
+
+// rotatePasswords generates a new password for each rotated user and changes it, retaining the current password as
+// a secondary password. The new passwords are stored in the Secrets before being changed, so they are not lost if the
+// operator is interrupted.
+func (r *DatabaseServerReconciler) rotatePasswords(ctx context.Context, dbServer *stroomv1.DatabaseServer) error {
+	accounts := getRotatedAccounts(dbServer)
+	newPasswords := map[string]string{}
+	if err := r.patchPasswordSecrets(ctx, accounts, func(secret *corev1.Secret, userName string) {
+		key := userName + pendingPasswordKeySuffix
+		if _, exists := secret.Data[key]; !exists {
+			secret.Data[key] = stroomv1.GeneratePassword()
+		}
+		newPasswords[userName] = string(secret.Data[key])
+	}); err != nil {
+		return err
+	}
+
+	// RETAIN CURRENT PASSWORD replaces any previously retained password, so users whose password was already changed
+	// are skipped
+	if err := r.changePasswords(ctx, dbServer, accounts, "ALTER USER %v IDENTIFIED BY %v RETAIN CURRENT PASSWORD", newPasswords); err != nil {
+		return err
+	}
+
+	return r.patchPasswordSecrets(ctx, accounts, func(secret *corev1.Secret, userName string) {
+		secret.Data[userName] = []byte(newPasswords[userName])
+		delete(secret.Data, userName+pendingPasswordKeySuffix)
+	})
+}
+
+// patchPasswordSecrets applies a change to the password of each account in its Secret, patching each Secret once
+func (r *DatabaseServerReconciler) patchPasswordSecrets(ctx context.Context, accounts []rotatedAccount, change func(secret *corev1.Secret, userName string)) error {
+	secrets := map[types.NamespacedName]*corev1.Secret{}
+	patches := map[types.NamespacedName]client.Patch{}
+	var secretRefs []types.NamespacedName
+	for _, account := range accounts {
+		secret, exists := secrets[account.secretRef]
+		if !exists {
+			secret = &corev1.Secret{}
+			if err := r.Get(ctx, account.secretRef, secret); err != nil {
+				return err
+			}
+			secrets[account.secretRef] = secret
+			patches[account.secretRef] = client.MergeFrom(secret.DeepCopy())
+			secretRefs = append(secretRefs, account.secretRef)
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		change(secret, account.userName)
+	}
+
+	for _, secretRef := range secretRefs {
+		if err := r.Patch(ctx, secrets[secretRef], patches[secretRef]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changePasswords executes a statement for each host of each rotated account, connecting as root. If newPasswords is
+// specified, the quoted new password is substituted in the statement and users that can already connect with it are
+// skipped.
+func (r *DatabaseServerReconciler) changePasswords(ctx context.Context, dbServer *stroomv1.DatabaseServer, accounts []rotatedAccount, statement string, newPasswords map[string]string) error {
+	dbInfo := getClientConnectionInfo(dbServer, DatabaseRootUserName)
+	db, err := r.openRootDatabase(ctx, dbServer, &dbInfo)
+	if err != nil {
+		return err
+	}
+	defer CloseDatabase(db)
+
+	tlsConfig, err := GetDatabaseTlsConfig(r, ctx, &dbInfo, dbServer.Namespace)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	for _, rotated := range accounts {
+		userName := rotated.userName
+		newPassword, changing := newPasswords[userName]
+		if changing && canConnect(ctx, dbServer, userName, newPassword, tlsConfig) {
+			continue
+		}
+
+		hosts, err := queryStrings(ctx, db, "SELECT Host FROM mysql.user WHERE User = ?", userName)
+		if err != nil {
+			return err
+		}
+		for _, host := range hosts {
+			account := fmt.Sprintf("%v@%v", quoteString(userName), quoteString(host))
+			args := []any{account}
+			if changing {
+				args = append(args, quoteString(newPassword))
+			}
+			if _, err := db.ExecContext(ctx, fmt.Sprintf(statement, args...)); err != nil {
+				return fmt.Errorf("could not change the password of %v: %w", account, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// canConnect returns whether a user can connect to the DatabaseServer with the specified password
+func canConnect(ctx context.Context, dbServer *stroomv1.DatabaseServer, userName string, password string, tlsConfig *tls.Config) bool {
+	dbInfo := getClientConnectionInfo(dbServer, userName)
+	db, err := OpenDatabaseWithPassword(ctx, &dbInfo, password, tlsConfig, "")
+	if err != nil {
+		return false
+	}
+	defer CloseDatabase(db)
+
+	var result int
+	return db.QueryRowContext(ctx, "SELECT 1").Scan(&result) == nil
+}
+
+// areStroomNodesRestarted returns whether the Stroom nodes of every StroomCluster using the DatabaseServer have
+// restarted since its passwords were last rotated
+func (r *DatabaseServerReconciler) areStroomNodesRestarted(ctx context.Context, dbServer *stroomv1.DatabaseServer) (bool, error) {
+	stroomClusters := stroomv1.StroomClusterList{}
+	if err := r.List(ctx, &stroomClusters); err != nil {
+		return false, err
+	}
+
+	dbServerRef := stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: dbServer.Name}}
+	rotated := getCredentialsRotatedValue(dbServer)
+	for _, stroomCluster := range stroomClusters.Items {
+		if !usesDatabaseServer(&stroomCluster, &dbServerRef, dbServer.Namespace) {
+			continue
+		}
+
+		statefulSets := appsv1.StatefulSetList{}
+		if err := r.List(ctx, &statefulSets, client.InNamespace(stroomCluster.Namespace), client.MatchingLabels(stroomCluster.GetLabels())); err != nil {
+			return false, err
+		}
+		for _, statefulSet := range statefulSets.Items {
+			rotatedValues := strings.Fields(statefulSet.Spec.Template.Annotations[stroomv1.CredentialsRotatedAnnotation])
+			if !slices.Contains(rotatedValues, rotated) || !isRolloutComplete(&statefulSet) {
+				log.FromContext(ctx).Info("Waiting for Stroom nodes to restart with new database passwords", "StatefulSet", statefulSet.Name)
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// isRolloutComplete returns whether every Pod of a StatefulSet is running the current revision of its template
+func isRolloutComplete(statefulSet *appsv1.StatefulSet) bool {
+	status := &statefulSet.Status
+	return status.ObservedGeneration >= statefulSet.Generation &&
+		status.UpdatedReplicas == *statefulSet.Spec.Replicas &&
+		status.CurrentRevision == status.UpdateRevision
+}
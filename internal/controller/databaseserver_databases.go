@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DatabaseRetryInterval is how long to wait before retrying, if the databases could not be reconciled
+	DatabaseRetryInterval = time.Second * 30
+)
+
+// databaseChanges are the changes required for the databases of a DatabaseServer to match its spec
+type databaseChanges struct {
+	create []string
+	grant  []string
+	revoke []string
+	drop   []string
+}
+
+func (c *databaseChanges) isEmpty() bool {
+	return len(c.create) == 0 && len(c.grant) == 0 && len(c.revoke) == 0 && len(c.drop) == 0
+}
+
+// getDatabaseChanges compares the databases that exist, and those on which the service user has been granted
+// privileges, with the DatabaseServer spec. Only databases explicitly listed for removal, and not claimed by a
+// StroomCluster, are dropped.
+func getDatabaseChanges(dbServer *stroomv1.DatabaseServer, existing []string, granted []string) databaseChanges {
+	spec := &dbServer.Spec
+	changes := databaseChanges{}
+
+	var claimed []string
+	for _, claim := range dbServer.StroomClusterClaims {
+		claimed = append(claimed, claim.DatabaseNames...)
+	}
+
+	for _, name := range spec.DatabaseNames {
+		if !slices.Contains(existing, name) {
+			changes.create = append(changes.create, name)
+		}
+		if !slices.Contains(granted, name) {
+			changes.grant = append(changes.grant, name)
+		}
+	}
+	for _, name := range granted {
+		if !slices.Contains(spec.DatabaseNames, name) {
+			changes.revoke = append(changes.revoke, name)
+		}
+	}
+	for _, name := range spec.DropDatabaseNames {
+		if slices.Contains(existing, name) && !slices.Contains(spec.DatabaseNames, name) && !slices.Contains(claimed, name) {
+			changes.drop = append(changes.drop, name)
+		}
+	}
+
+	return changes
+}
+
+// reconcileDatabases connects to the DatabaseServer as root, creating each database in the spec that does not exist
+// and granting the service user all privileges on it. Privileges on databases removed from the spec are revoked.
+func (r *DatabaseServerReconciler) reconcileDatabases(ctx context.Context, dbServer *stroomv1.DatabaseServer) error {
+	logger := log.FromContext(ctx)
+
+	dbInfo := getClientConnectionInfo(dbServer, DatabaseRootUserName)
+	db, err := r.openRootDatabase(ctx, dbServer, &dbInfo)
+	if err != nil {
+		return err
+	}
+	defer CloseDatabase(db)
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	existing, err := queryStrings(ctx, db, "SELECT SCHEMA_NAME FROM information_schema.SCHEMATA")
+	if err != nil {
+		return err
+	}
+	granted, err := queryStrings(ctx, db, "SELECT DISTINCT Db FROM mysql.db WHERE User = ? AND Host = '%'", DatabaseServiceUserName)
+	if err != nil {
+		return err
+	}
+
+	changes := getDatabaseChanges(dbServer, existing, granted)
+	userName := fmt.Sprintf("'%v'@'%%'", DatabaseServiceUserName)
+	for _, name := range changes.create {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %v", quoteIdentifier(name))); err != nil {
+			logger.Error(err, "Failed to create database", "DatabaseServer", dbServer.Name, "Database", name)
+			return err
+		}
+		r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "DatabaseCreated", "CreateDatabase", "Created database %v", name)
+	}
+	for _, name := range changes.grant {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("GRANT ALL PRIVILEGES ON %v.* TO %v", quoteIdentifier(name), userName)); err != nil {
+			logger.Error(err, "Failed to grant privileges on database", "DatabaseServer", dbServer.Name, "Database", name)
+			return err
+		}
+		logger.Info("Granted privileges on database", "DatabaseServer", dbServer.Name, "Database", name, "User", DatabaseServiceUserName)
+	}
+	for _, name := range changes.revoke {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("REVOKE ALL PRIVILEGES ON %v.* FROM %v", quoteIdentifier(name), userName)); err != nil {
+			logger.Error(err, "Failed to revoke privileges on database", "DatabaseServer", dbServer.Name, "Database", name)
+			return err
+		}
+		r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "PrivilegesRevoked", "RevokePrivileges",
+			"Revoked the privileges of %v on database %v, which is no longer listed", DatabaseServiceUserName, name)
+	}
+	for _, name := range changes.drop {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %v", quoteIdentifier(name))); err != nil {
+			logger.Error(err, "Failed to drop database", "DatabaseServer", dbServer.Name, "Database", name)
+			return err
+		}
+		r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "DatabaseDropped", "DropDatabase", "Dropped database %v", name)
+	}
+	if !changes.isEmpty() {
+		logger.Info("Databases reconciled", "DatabaseServer", dbServer.Name, "Created", changes.create, "Revoked", changes.revoke, "Dropped", changes.drop)
+	}
+
+	if dbServer.Spec.Metrics != nil {
+		if err := r.reconcileMonitoringUser(ctx, db, dbServer); err != nil {
+			return err
+		}
+	}
+	if dbServer.Spec.MultiTenant || len(dbServer.Status.TenantUsers) > 0 {
+		if err := r.reconcileTenants(ctx, db, dbServer, existing); err != nil {
+			return err
+		}
+	}
+
+	dbServer.Status.Databases = slices.Clone(dbServer.Spec.DatabaseNames)
+	return nil
+}
+
+// getClientConnectionInfo returns the details required to connect to the writable instance of a DatabaseServer as
+// the specified user
+func getClientConnectionInfo(dbServer *stroomv1.DatabaseServer, userName string) DatabaseConnectionInfo {
+	return DatabaseConnectionInfo{
+		ServerAddress: stroomv1.ServerAddress{
+			Host:         dbServer.GetClientServiceFqdn(),
+			Port:         DatabasePort,
+			SecretName:   dbServer.GetSecretName(),
+			CaSecretName: dbServer.Spec.Tls.SecretName,
+		},
+		UserName: userName,
+	}
+}
+
+// quoteIdentifier quotes a MySQL identifier, such as a database name
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
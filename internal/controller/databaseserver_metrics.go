@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DatabaseMonitoringUserName is the user mysqld_exporter connects as. It can only connect from within the Pod.
+	DatabaseMonitoringUserName       = "exporter"
+	DatabaseMetricsPortName          = "metrics"
+	DatabaseMetricsPort        int32 = 9104
+	// DatabaseExporterConfigKey is the key of the mysqld_exporter client configuration in the DatabaseServer ConfigMap
+	DatabaseExporterConfigKey = "exporter.cnf"
+	// databaseMonitoringUserHost restricts the monitoring user to connections from the exporter sidecar
+	databaseMonitoringUserHost = "127.0.0.1"
+)
+
+// createExporterConfig returns the client configuration of mysqld_exporter. If TLS is enabled, MySQL requires the
+// exporter to connect using TLS.
+func createExporterConfig(dbServer *stroomv1.DatabaseServer) string {
+	config := "[client]\n"
+	if !dbServer.Spec.Tls.IsZero() {
+		config += "ssl-ca=" + path.Join(DatabaseTlsMountPath, "ca.crt") + "\n"
+	}
+	return config
+}
+
+// createMetricsExporter creates a sidecar container exporting the metrics of the MySQL instance in the Pod to
+// Prometheus
+func createMetricsExporter(dbServer *stroomv1.DatabaseServer) corev1.Container {
+	const configPath = "/etc/mysqld-exporter/my.cnf"
+	metrics := dbServer.Spec.Metrics
+
+	args := []string{
+		"--config.my-cnf=" + configPath,
+		"--mysqld.address=" + net.JoinHostPort(databaseMonitoringUserHost, strconv.Itoa(int(DatabasePort))),
+		"--mysqld.username=" + DatabaseMonitoringUserName,
+		fmt.Sprintf("--web.listen-address=:%v", DatabaseMetricsPort),
+	}
+	volumeMounts := []corev1.VolumeMount{{
+		Name:      "config",
+		MountPath: configPath,
+		SubPath:   DatabaseExporterConfigKey,
+		ReadOnly:  true,
+	}}
+	if !dbServer.Spec.Tls.IsZero() {
+		// The server certificate is not valid for the loopback address, which the connection never leaves
+		args = append(args, "--tls.insecure-skip-verify")
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "tls",
+			MountPath: DatabaseTlsMountPath,
+			ReadOnly:  true,
+		})
+	}
+	if dbServer.IsGroupReplicated() {
+		args = append(args, "--collect.perf_schema.replication_group_members")
+	}
+
+	return corev1.Container{
+		Name:            "metrics-exporter",
+		Image:           metrics.Image.String(),
+		ImagePullPolicy: metrics.ImagePullPolicy,
+		Args:            args,
+		Env: []corev1.EnvVar{{
+			Name: "MYSQLD_EXPORTER_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: dbServer.GetSecretName(),
+					},
+					Key: DatabaseMonitoringUserName,
+				},
+			},
+		}},
+		Ports: []corev1.ContainerPort{{
+			Name:          DatabaseMetricsPortName,
+			ContainerPort: DatabaseMetricsPort,
+			Protocol:      corev1.ProtocolTCP,
+		}},
+		VolumeMounts: volumeMounts,
+		Resources:    metrics.Resources,
+	}
+}
+
+// ensureMonitoringPassword adds a password for the monitoring user to the Secret of a DatabaseServer created before
+// metrics could be exported
+func (r *DatabaseServerReconciler) ensureMonitoringPassword(ctx context.Context, secret *corev1.Secret) error {
+	if _, exists := secret.Data[DatabaseMonitoringUserName]; exists {
+		return nil
+	}
+
+	patch := client.MergeFrom(secret.DeepCopy())
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[DatabaseMonitoringUserName] = stroomv1.GeneratePassword()
+	if err := r.Patch(ctx, secret, patch); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to add monitoring user password to Secret", "Namespace", secret.Namespace, "Name", secret.Name)
+		return err
+	}
+	return nil
+}
+
+// reconcileMonitoringUser creates the user mysqld_exporter connects as, if it does not exist. It is granted only the
+// privileges required to read server metrics, and not the contents of any database.
+func (r *DatabaseServerReconciler) reconcileMonitoringUser(ctx context.Context, db *sql.DB, dbServer *stroomv1.DatabaseServer) error {
+	logger := log.FromContext(ctx)
+
+	hosts, err := queryStrings(ctx, db, "SELECT Host FROM mysql.user WHERE User = ?", DatabaseMonitoringUserName)
+	if err != nil {
+		return err
+	} else if slices.Contains(hosts, databaseMonitoringUserHost) {
+		return nil
+	}
+
+	userInfo := DatabaseConnectionInfo{ServerAddress: stroomv1.ServerAddress{SecretName: dbServer.GetSecretName()}, UserName: DatabaseMonitoringUserName}
+	password, err := GetDatabasePassword(r, ctx, &userInfo, dbServer.Namespace)
+	if err != nil {
+		return err
+	}
+
+	account := fmt.Sprintf("%v@%v", quoteString(DatabaseMonitoringUserName), quoteString(databaseMonitoringUserHost))
+	for _, statement := range []string{
+		fmt.Sprintf("CREATE USER IF NOT EXISTS %v IDENTIFIED BY %v WITH MAX_USER_CONNECTIONS 3", account, quoteString(password)),
+		fmt.Sprintf("GRANT PROCESS, REPLICATION CLIENT ON *.* TO %v", account),
+		fmt.Sprintf("GRANT SELECT ON performance_schema.* TO %v", account),
+	} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			logger.Error(err, "Failed to create monitoring user", "DatabaseServer", dbServer.Name)
+			return err
+		}
+	}
+
+	logger.Info("Created monitoring user", "DatabaseServer", dbServer.Name, "User", DatabaseMonitoringUserName)
+	return nil
+}
@@ -0,0 +1,417 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	DatabasePrimaryRole   = "primary"
+	DatabaseSecondaryRole = "secondary"
+
+	// GroupQueryTimeout bounds each query of a group member, so an unresponsive member does not stall reconciliation
+	GroupQueryTimeout = time.Second * 10
+	// GroupJoinTimeout is how long to wait for a member to start group replication
+	GroupJoinTimeout = time.Minute * 2
+	// GroupMonitorInterval is how often the replication group is checked for a change of primary
+	GroupMonitorInterval = time.Second * 15
+
+	groupMemberOnline      = "ONLINE"
+	groupMemberRecovering  = "RECOVERING"
+	groupMemberOffline     = "OFFLINE"
+	groupMemberError       = "ERROR"
+	groupMemberUnreachable = "UNREACHABLE"
+	groupMemberPrimary     = "PRIMARY"
+)
+
+// groupMember is a MySQL instance of a group-replicated DatabaseServer, as seen by itself
+type groupMember struct {
+	ordinal int32
+	pod     *corev1.Pod
+	db      *sql.DB
+	state   string
+	role    string
+	// Whether a majority of the group, as seen by this member, is online
+	hasQuorum bool
+}
+
+func (m *groupMember) isReachable() bool {
+	return m.state != groupMemberUnreachable
+}
+
+// isPrimary returns whether the member is the writable primary of a group that has quorum
+func (m *groupMember) isPrimary() bool {
+	return m.state == groupMemberOnline && m.role == groupMemberPrimary && m.hasQuorum
+}
+
+// reconcileGroupReplication bootstraps the replication group if no member is online, joins each member that is not
+// part of the group and labels the primary Pod, so the primary Service routes to it. The state of each member and
+// the name of the primary are recorded in the DatabaseServer status.
+func (r *DatabaseServerReconciler) reconcileGroupReplication(ctx context.Context, dbServer *stroomv1.DatabaseServer) error {
+	logger := log.FromContext(ctx)
+
+	replicationPassword, err := r.getReplicationPassword(ctx, dbServer)
+	if err != nil {
+		return err
+	}
+
+	members, err := r.getGroupMembers(ctx, dbServer)
+	defer func() {
+		for _, member := range members {
+			if member.db != nil {
+				CloseDatabase(member.db)
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	primary := findGroupPrimary(members)
+	if primary == nil && !isGroupForming(members) {
+		// Only bootstrap once every member can be compared, so the group is not formed from a member that is
+		// missing transactions
+		if reachable := countReachableMembers(members); reachable < len(members) {
+			logger.Info("Waiting for all group members to be reachable before bootstrapping the group", "Reachable", reachable, "Replicas", len(members))
+		} else if candidate, err := findMostAdvancedMember(ctx, members); err != nil {
+			return err
+		} else if candidate == nil {
+			message := "Group members have diverged. Restore the group manually, or from a backup."
+			r.Recorder.Eventf(dbServer, nil, corev1.EventTypeWarning, "GroupDiverged", "Bootstrap", message)
+			logger.Info(message, "DatabaseServer", dbServer.Name)
+		} else {
+			if err := r.bootstrapGroup(ctx, dbServer, candidate, replicationPassword); err != nil {
+				return err
+			}
+			r.Recorder.Eventf(dbServer, candidate.pod, corev1.EventTypeNormal, "GroupBootstrapped", "Bootstrap",
+				"Replication group bootstrapped from member %v", candidate.pod.Name)
+			primary = candidate
+		}
+	}
+
+	if primary != nil {
+		for _, member := range members {
+			if member == primary || !member.isReachable() || member.state == groupMemberOnline || member.state == groupMemberRecovering {
+				continue
+			}
+			if err := r.joinGroup(ctx, dbServer, member, replicationPassword); err != nil {
+				// Try again on the next reconciliation, without preventing other members from joining
+				logger.Error(err, "Member could not join the replication group", "Pod", member.pod.Name)
+				r.Recorder.Eventf(dbServer, member.pod, corev1.EventTypeWarning, "JoinFailed", "Join",
+					"Member %v could not join the replication group: %v", member.pod.Name, err)
+			}
+		}
+	}
+
+	// Refresh the state of each member following any changes
+	for _, member := range members {
+		if member.isReachable() {
+			queryMemberState(ctx, member)
+		}
+	}
+	primary = findGroupPrimary(members)
+
+	if err := r.labelGroupMembers(ctx, members, primary); err != nil {
+		return err
+	}
+
+	status := &dbServer.Status
+	primaryName := ""
+	if primary != nil {
+		primaryName = primary.pod.Name
+	}
+	if status.Primary != "" && primaryName != "" && status.Primary != primaryName {
+		r.Recorder.Eventf(dbServer, primary.pod, corev1.EventTypeNormal, "PrimaryChanged", "Failover",
+			"Primary changed from %v to %v", status.Primary, primaryName)
+		logger.Info("Primary changed", "DatabaseServer", dbServer.Name, "From", status.Primary, "To", primaryName)
+	}
+	status.Primary = primaryName
+	status.Members = nil
+	for _, member := range members {
+		status.Members = append(status.Members, stroomv1.DatabaseServerMember{
+			Name:  dbServer.GetPodName(member.ordinal),
+			State: member.state,
+			Role:  member.role,
+		})
+	}
+
+	return nil
+}
+
+// getReplicationPassword returns the password of the user members use to recover transactions from one another.
+// Secrets created before group replication was supported do not contain one, so it is generated if required.
+func (r *DatabaseServerReconciler) getReplicationPassword(ctx context.Context, dbServer *stroomv1.DatabaseServer) (string, error) {
+	secret := corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: dbServer.Namespace, Name: dbServer.GetSecretName()}, &secret); err != nil {
+		return "", err
+	}
+
+	if password, exists := secret.Data[DatabaseReplicationUserName]; exists {
+		return string(password), nil
+	}
+
+	patch := client.MergeFrom(secret.DeepCopy())
+	password := stroomv1.GeneratePassword()
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[DatabaseReplicationUserName] = password
+	if err := r.Patch(ctx, &secret, patch); err != nil {
+		log.FromContext(ctx).Error(err, "Could not add the replication user password to Secret", "Name", secret.Name)
+		return "", err
+	}
+
+	return string(password), nil
+}
+
+// getGroupMembers connects to the MySQL instance in each running Pod and queries its group membership
+func (r *DatabaseServerReconciler) getGroupMembers(ctx context.Context, dbServer *stroomv1.DatabaseServer) ([]*groupMember, error) {
+	var members []*groupMember
+	for ordinal := int32(0); ordinal < dbServer.Spec.Replicas; ordinal++ {
+		member := &groupMember{ordinal: ordinal, state: groupMemberUnreachable}
+		members = append(members, member)
+
+		pod := corev1.Pod{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: dbServer.Namespace, Name: dbServer.GetPodName(ordinal)}, &pod); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return members, err
+		}
+		member.pod = &pod
+		if pod.Status.Phase != corev1.PodRunning || !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		dbInfo := DatabaseConnectionInfo{
+			ServerAddress: stroomv1.ServerAddress{
+				Host:         dbServer.GetPodFqdn(ordinal),
+				Port:         DatabasePort,
+				SecretName:   dbServer.GetSecretName(),
+				CaSecretName: dbServer.Spec.Tls.SecretName,
+			},
+			UserName: DatabaseRootUserName,
+		}
+		db, err := OpenDatabase(r, ctx, &dbInfo, dbServer.Namespace, "")
+		if err != nil {
+			return members, err
+		}
+		member.db = db
+		queryMemberState(ctx, member)
+	}
+
+	return members, nil
+}
+
+// queryMemberState records the state and role of a member, from its own view of the group. A member that has not
+// started group replication does not appear in the view, so is `OFFLINE`.
+func queryMemberState(ctx context.Context, member *groupMember) {
+	ctx, cancel := context.WithTimeout(ctx, GroupQueryTimeout)
+	defer cancel()
+
+	row := member.db.QueryRowContext(ctx, ""+
+		"SELECT m.MEMBER_STATE, m.MEMBER_ROLE, "+
+		"(SELECT COUNT(*) FROM performance_schema.replication_group_members WHERE MEMBER_STATE = 'ONLINE') * 2 > "+
+		"(SELECT COUNT(*) FROM performance_schema.replication_group_members) "+
+		"FROM performance_schema.replication_group_members m WHERE m.MEMBER_ID = @@server_uuid")
+
+	var state, role string
+	var hasQuorum bool
+	if err := row.Scan(&state, &role, &hasQuorum); err == sql.ErrNoRows {
+		member.state, member.role, member.hasQuorum = groupMemberOffline, "", false
+	} else if err != nil {
+		log.FromContext(ctx).V(1).Info("Could not query group member state", "Pod", member.pod.Name, "Error", err.Error())
+		member.state, member.role, member.hasQuorum = groupMemberUnreachable, "", false
+	} else {
+		member.state, member.role, member.hasQuorum = state, role, hasQuorum
+	}
+}
+
+// findGroupPrimary returns the writable primary of the group, if there is one
+func findGroupPrimary(members []*groupMember) *groupMember {
+	for _, member := range members {
+		if member.isPrimary() {
+			return member
+		}
+	}
+	return nil
+}
+
+// isGroupForming returns whether any member is part of a group, such as while a new primary is being elected
+func isGroupForming(members []*groupMember) bool {
+	for _, member := range members {
+		if (member.state == groupMemberOnline && member.hasQuorum) || member.state == groupMemberRecovering {
+			return true
+		}
+	}
+	return false
+}
+
+func countReachableMembers(members []*groupMember) int {
+	count := 0
+	for _, member := range members {
+		if member.isReachable() {
+			count++
+		}
+	}
+	return count
+}
+
+// findMostAdvancedMember returns the member whose executed transactions include those of every other member. If no
+// such member exists, the members have diverged and nil is returned.
+func findMostAdvancedMember(ctx context.Context, members []*groupMember) (*groupMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, GroupQueryTimeout)
+	defer cancel()
+
+	executed := make([]string, len(members))
+	for i, member := range members {
+		if err := member.db.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed").Scan(&executed[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, candidate := range members {
+		isSuperset := true
+		for j := range members {
+			if i == j {
+				continue
+			}
+			var isSubset bool
+			if err := candidate.db.QueryRowContext(ctx, "SELECT GTID_SUBSET(?, @@GLOBAL.gtid_executed)", executed[j]).Scan(&isSubset); err != nil {
+				return nil, err
+			}
+			if !isSubset {
+				isSuperset = false
+				break
+			}
+		}
+		if isSuperset {
+			return candidate, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// configureMember sets the options a member requires to form or join the group. They are persisted, so the member can
+// rejoin the group after restarting.
+func configureMember(ctx context.Context, dbServer *stroomv1.DatabaseServer, member *groupMember, replicationPassword string) error {
+	var seeds []string
+	for ordinal := int32(0); ordinal < dbServer.Spec.Replicas; ordinal++ {
+		seeds = append(seeds, fmt.Sprintf("%v:%v", dbServer.GetPodFqdn(ordinal), DatabaseGroupReplicationPort))
+	}
+
+	return execStatements(ctx, member.db, GroupQueryTimeout,
+		// Each member requires a unique server ID
+		fmt.Sprintf("SET PERSIST server_id = %v", member.ordinal+1),
+		fmt.Sprintf("SET PERSIST group_replication_group_seeds = '%v'", strings.Join(seeds, ",")),
+		fmt.Sprintf("CHANGE REPLICATION SOURCE TO SOURCE_USER = %v, SOURCE_PASSWORD = %v FOR CHANNEL 'group_replication_recovery'",
+			quoteString(DatabaseReplicationUserName), quoteString(replicationPassword)),
+	)
+}
+
+// bootstrapGroup starts the replication group from the specified member, which becomes the primary
+func (r *DatabaseServerReconciler) bootstrapGroup(ctx context.Context, dbServer *stroomv1.DatabaseServer, member *groupMember, replicationPassword string) error {
+	logger := log.FromContext(ctx)
+	logger.Info("Bootstrapping replication group", "DatabaseServer", dbServer.Name, "Pod", member.pod.Name)
+
+	if err := configureMember(ctx, dbServer, member, replicationPassword); err != nil {
+		return err
+	}
+
+	err := execStatements(ctx, member.db, GroupJoinTimeout,
+		"SET GLOBAL group_replication_bootstrap_group = ON",
+		"START GROUP_REPLICATION",
+	)
+	// Always reset the bootstrap flag, so a second group is not formed if the member restarts
+	if resetErr := execStatements(ctx, member.db, GroupQueryTimeout, "SET GLOBAL group_replication_bootstrap_group = OFF"); err == nil {
+		err = resetErr
+	}
+	if err != nil {
+		logger.Error(err, "Failed to bootstrap replication group", "Pod", member.pod.Name)
+		return err
+	}
+
+	// The replication user is replicated to members as they join. BACKUP_ADMIN allows a member that is missing
+	// transactions no longer in the binary logs of the group to clone a donor.
+	userName := fmt.Sprintf("%v@'%%'", quoteString(DatabaseReplicationUserName))
+	return execStatements(ctx, member.db, GroupQueryTimeout,
+		fmt.Sprintf("CREATE USER IF NOT EXISTS %v IDENTIFIED BY %v", userName, quoteString(replicationPassword)),
+		fmt.Sprintf("ALTER USER %v IDENTIFIED BY %v", userName, quoteString(replicationPassword)),
+		fmt.Sprintf("GRANT REPLICATION SLAVE, BACKUP_ADMIN ON *.* TO %v", userName),
+		"SET PERSIST group_replication_start_on_boot = ON",
+	)
+}
+
+// joinGroup adds a member to the replication group. A member that left the group due to an error is restarted.
+func (r *DatabaseServerReconciler) joinGroup(ctx context.Context, dbServer *stroomv1.DatabaseServer, member *groupMember, replicationPassword string) error {
+	log.FromContext(ctx).Info("Joining member to replication group", "DatabaseServer", dbServer.Name, "Pod", member.pod.Name, "State", member.state)
+
+	if err := configureMember(ctx, dbServer, member, replicationPassword); err != nil {
+		return err
+	}
+
+	if member.state == groupMemberError {
+		if err := execStatements(ctx, member.db, GroupJoinTimeout, "STOP GROUP_REPLICATION"); err != nil {
+			return err
+		}
+	}
+
+	return execStatements(ctx, member.db, GroupJoinTimeout,
+		"START GROUP_REPLICATION",
+		"SET PERSIST group_replication_start_on_boot = ON",
+	)
+}
+
+// labelGroupMembers labels each member Pod with its role, so the primary Service routes only to the primary. If
+// there is no primary, no Pod is labelled as such.
+func (r *DatabaseServerReconciler) labelGroupMembers(ctx context.Context, members []*groupMember, primary *groupMember) error {
+	for _, member := range members {
+		if member.pod == nil {
+			continue
+		}
+
+		role := DatabaseSecondaryRole
+		if member == primary {
+			role = DatabasePrimaryRole
+		}
+		if member.pod.Labels[stroomv1.DatabaseRoleLabel] == role {
+			continue
+		}
+
+		patch := client.MergeFrom(member.pod.DeepCopy())
+		if member.pod.Labels == nil {
+			member.pod.Labels = map[string]string{}
+		}
+		member.pod.Labels[stroomv1.DatabaseRoleLabel] = role
+		if err := r.Patch(ctx, member.pod, patch); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to label database Pod", "Pod", member.pod.Name, "Role", role)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execStatements executes each statement in turn, stopping at the first error
+func execStatements(ctx context.Context, db *sql.DB, timeout time.Duration, statements ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
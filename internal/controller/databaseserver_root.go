@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// LegacyRootPassword is the root password of DatabaseServers deployed by earlier versions of the operator, which
+	// set MYSQL_ROOT_PASSWORD to the path of the root password file, rather than the password itself
+	LegacyRootPassword = "/etc/mysql/password/root"
+
+	mysqlAccessDeniedError = 1045
+)
+
+// isAccessDenied returns whether a MySQL connection was refused due to an incorrect user name or password
+func isAccessDenied(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlAccessDeniedError
+}
+
+// openRootDatabase connects to a DatabaseServer instance as root, using the password in its Secret. If the password
+// is refused, the legacy root password is migrated first.
+func (r *DatabaseServerReconciler) openRootDatabase(ctx context.Context, dbServer *stroomv1.DatabaseServer, dbInfo *DatabaseConnectionInfo) (*sql.DB, error) {
+	db, err := OpenDatabase(r, ctx, dbInfo, dbServer.Namespace, "")
+	if err != nil {
+		return nil, err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err == nil || !isAccessDenied(err) {
+		// Any other error is returned by the first query
+		return db, nil
+	}
+	CloseDatabase(db)
+
+	if err := r.migrateRootPassword(ctx, dbServer, dbInfo); err != nil {
+		return nil, err
+	}
+	return OpenDatabase(r, ctx, dbInfo, dbServer.Namespace, "")
+}
+
+// migrateRootPassword connects as root using the legacy root password and changes the password of each root account
+// to the one in the DatabaseServer Secret
+func (r *DatabaseServerReconciler) migrateRootPassword(ctx context.Context, dbServer *stroomv1.DatabaseServer, dbInfo *DatabaseConnectionInfo) error {
+	logger := log.FromContext(ctx)
+
+	password, err := GetDatabasePassword(r, ctx, dbInfo, dbServer.Namespace)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := GetDatabaseTlsConfig(r, ctx, dbInfo, dbServer.Namespace)
+	if err != nil {
+		return err
+	}
+	db, err := OpenDatabaseWithPassword(ctx, dbInfo, LegacyRootPassword, tlsConfig, "")
+	if err != nil {
+		return err
+	}
+	defer CloseDatabase(db)
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	hosts, err := queryStrings(ctx, db, "SELECT Host FROM mysql.user WHERE User = ?", DatabaseRootUserName)
+	if err != nil {
+		if isAccessDenied(err) {
+			r.Recorder.Eventf(dbServer, nil, corev1.EventTypeWarning, "RootAccessDenied", "MigrateRootPassword",
+				"The operator could not connect as root using the password in Secret '%v'. Set the password of 'root'@'%%' to the value of its '%v' key.",
+				dbServer.GetSecretName(), DatabaseRootUserName)
+		}
+		return err
+	}
+	for _, host := range hosts {
+		account := fmt.Sprintf("%v@%v", quoteString(DatabaseRootUserName), quoteString(host))
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER USER %v IDENTIFIED BY %v", account, quoteString(password))); err != nil {
+			logger.Error(err, "Failed to migrate the root password", "DatabaseServer", dbServer.Name, "Account", account)
+			return err
+		}
+	}
+
+	logger.Info("Migrated the legacy root password", "DatabaseServer", dbServer.Name, "Hosts", hosts)
+	r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "RootPasswordMigrated", "MigrateRootPassword",
+		"Changed the root password from the legacy value to the one in Secret '%v'", dbServer.GetSecretName())
+	return nil
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DatabaseServer root account", func() {
+
+	Context("isAccessDenied()", func() {
+		It("should match a MySQL access denied error", func() {
+			err := &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'root'@'10.0.0.1'"}
+			Expect(isAccessDenied(err)).Should(BeTrue())
+			Expect(isAccessDenied(fmt.Errorf("ping failed: %w", err))).Should(BeTrue())
+		})
+		It("should not match other errors", func() {
+			Expect(isAccessDenied(&mysql.MySQLError{Number: 1049, Message: "Unknown database"})).Should(BeFalse())
+			Expect(isAccessDenied(errors.New("connection refused"))).Should(BeFalse())
+			Expect(isAccessDenied(nil)).Should(BeFalse())
+		})
+	})
+})
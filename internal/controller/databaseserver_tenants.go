@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// TenantUserNamePrefix is prepended to the name of the StroomCluster to form the name of its MySQL user
+	TenantUserNamePrefix = "stroom_"
+	// MaxDatabaseUserNameLength is the longest user name MySQL accepts
+	MaxDatabaseUserNameLength = 32
+	// MaxDatabaseNameLength is the longest database name MySQL accepts
+	MaxDatabaseNameLength = 64
+)
+
+// getTenantName returns the name identifying the MySQL user and databases of a StroomCluster on a multi-tenant
+// DatabaseServer. Hyphens are replaced, so the names do not need to be quoted.
+func getTenantName(stroomCluster *stroomv1.StroomCluster) string {
+	return strings.ReplaceAll(stroomCluster.Name, "-", "_")
+}
+
+// getTenantUserName returns the name of the MySQL user created for a StroomCluster on a multi-tenant DatabaseServer
+func getTenantUserName(stroomCluster *stroomv1.StroomCluster) string {
+	userName := TenantUserNamePrefix + getTenantName(stroomCluster)
+	if len(userName) > MaxDatabaseUserNameLength {
+		userName = userName[:MaxDatabaseUserNameLength]
+	}
+	return userName
+}
+
+// useTenant connects as the MySQL user created for a StroomCluster, if the database server is a multi-tenant
+// DatabaseServer
+func (dbInfo *DatabaseConnectionInfo) useTenant(stroomCluster *stroomv1.StroomCluster) {
+	if dbInfo.DatabaseServer == nil || !dbInfo.DatabaseServer.Spec.MultiTenant {
+		return
+	}
+
+	dbInfo.UserName = getTenantUserName(stroomCluster)
+	dbInfo.SecretName = stroomCluster.GetDatabaseSecretName(dbInfo.DatabaseServer.Name)
+	dbInfo.TenantName = getTenantName(stroomCluster)
+}
+
+// newDatabaseServerClaim returns the claim of a StroomCluster on a multi-tenant DatabaseServer, listing the app
+// and/or statistics databases it hosts
+func newDatabaseServerClaim(stroomCluster *stroomv1.StroomCluster, dbServer *stroomv1.DatabaseServer, appDbInfo *DatabaseConnectionInfo, statsDbInfo *DatabaseConnectionInfo) stroomv1.DatabaseServerClaim {
+	claim := stroomv1.DatabaseServerClaim{
+		StroomClusterRef: stroomv1.ResourceRef{Name: stroomCluster.Name, Namespace: stroomCluster.Namespace},
+		UserName:         getTenantUserName(stroomCluster),
+		SecretName:       stroomCluster.GetDatabaseSecretName(dbServer.Name),
+	}
+	for _, database := range []struct {
+		dbInfo *DatabaseConnectionInfo
+		name   string
+	}{{appDbInfo, stroomCluster.Spec.AppDatabaseName}, {statsDbInfo, stroomCluster.Spec.StatsDatabaseName}} {
+		if isDatabaseServer(database.dbInfo.DatabaseServer, dbServer) {
+			name := database.dbInfo.GetDatabaseName(database.name)
+			if !slices.Contains(claim.DatabaseNames, name) {
+				claim.DatabaseNames = append(claim.DatabaseNames, name)
+			}
+		}
+	}
+	return claim
+}
+
+// isDatabaseServer returns whether a DatabaseServer is the other specified DatabaseServer
+func isDatabaseServer(dbServer *stroomv1.DatabaseServer, other *stroomv1.DatabaseServer) bool {
+	return dbServer != nil && dbServer.Name == other.Name && dbServer.Namespace == other.Namespace
+}
+
+// validateDatabaseServerClaim returns an error if the claim of a StroomCluster would share a MySQL user or database
+// with that of another StroomCluster, or its names are too long for MySQL
+func validateDatabaseServerClaim(dbServer *stroomv1.DatabaseServer, claim *stroomv1.DatabaseServerClaim) error {
+	for _, name := range claim.DatabaseNames {
+		if len(name) > MaxDatabaseNameLength {
+			return fmt.Errorf("database name '%v' exceeds %v characters", name, MaxDatabaseNameLength)
+		}
+	}
+
+	for _, other := range dbServer.StroomClusterClaims {
+		if other.StroomClusterRef == claim.StroomClusterRef {
+			continue
+		}
+		if other.UserName == claim.UserName {
+			return fmt.Errorf("MySQL user '%v' is already used by StroomCluster '%v'", claim.UserName, other.StroomClusterRef.String())
+		}
+		for _, name := range claim.DatabaseNames {
+			if slices.Contains(other.DatabaseNames, name) {
+				return fmt.Errorf("database '%v' is already used by StroomCluster '%v'", name, other.StroomClusterRef.String())
+			}
+		}
+	}
+	return nil
+}
+
+// claimTenantDatabaseServer adds the claim of a StroomCluster to a multi-tenant DatabaseServer, creating a Secret
+// containing the password of its MySQL user if one does not exist
+func (r *StroomClusterReconciler) claimTenantDatabaseServer(ctx context.Context, stroomCluster *stroomv1.StroomCluster, db *stroomv1.DatabaseServer, claim stroomv1.DatabaseServerClaim) error {
+	logger := log.FromContext(ctx)
+
+	if err := validateDatabaseServerClaim(db, &claim); err != nil {
+		err = errors.NewBadRequest(fmt.Sprintf("DatabaseServer '%v/%v' cannot be claimed by StroomCluster '%v/%v': %v",
+			db.Namespace, db.Name, stroomCluster.Namespace, stroomCluster.Name, err.Error()))
+		logger.Error(err, "Cannot claim DatabaseServer")
+		return err
+	}
+
+	secret := corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: stroomCluster.Namespace, Name: claim.SecretName}, &secret); errors.IsNotFound(err) {
+		secret = corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      claim.SecretName,
+				Namespace: stroomCluster.Namespace,
+				Labels:    stroomCluster.GetLabels(),
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				claim.UserName: stroomv1.GeneratePassword(),
+			},
+		}
+		// The MySQL user is dropped when the claim is released, so the Secret is deleted with the StroomCluster
+		if err := ctrl.SetControllerReference(stroomCluster, &secret, r.Scheme); err != nil {
+			return err
+		}
+		logger.Info("Creating a new Secret", "Namespace", secret.Namespace, "Name", secret.Name)
+		if err := r.Create(ctx, &secret); err != nil {
+			logger.Error(err, "Failed to create database user Secret", "Namespace", secret.Namespace, "Name", secret.Name)
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if existing := db.GetClaim(claim.StroomClusterRef); existing != nil {
+		if slices.Equal(existing.DatabaseNames, claim.DatabaseNames) && existing.UserName == claim.UserName && existing.SecretName == claim.SecretName {
+			// Already claimed by this cluster
+			return nil
+		}
+		*existing = claim
+	} else {
+		db.StroomClusterClaims = append(db.StroomClusterClaims, claim)
+	}
+
+	if err := r.Update(ctx, db); err != nil {
+		logger.Error(err, fmt.Sprintf("Could not claim the DatabaseServer '%v/%v' by StroomCluster '%v/%v'", db.Namespace, db.Name, stroomCluster.Namespace, stroomCluster.Name))
+		return err
+	}
+	return nil
+}
+
+// releaseDatabaseServer removes the claim of a deleted StroomCluster from a DatabaseServer. The finalizer is removed
+// once no StroomCluster claims it, allowing the DatabaseServer to be deleted.
+func (r *StroomClusterReconciler) releaseDatabaseServer(ctx context.Context, stroomCluster *stroomv1.StroomCluster, db *stroomv1.DatabaseServer) error {
+	if err := r.Get(ctx, types.NamespacedName{Namespace: db.Namespace, Name: db.Name}, db); err != nil {
+		return err
+	}
+
+	clusterRef := stroomv1.ResourceRef{Name: stroomCluster.Name, Namespace: stroomCluster.Namespace}
+	claimCount := len(db.StroomClusterClaims)
+	db.StroomClusterClaims = slices.DeleteFunc(db.StroomClusterClaims, func(claim stroomv1.DatabaseServerClaim) bool {
+		return claim.StroomClusterRef == clusterRef
+	})
+	released := len(db.StroomClusterClaims) < claimCount
+
+	if len(db.StroomClusterClaims) == 0 && controllerutil.ContainsFinalizer(db, stroomv1.StroomClusterFinalizerName) {
+		controllerutil.RemoveFinalizer(db, stroomv1.StroomClusterFinalizerName)
+	} else if !released {
+		return nil
+	}
+	return r.Update(ctx, db)
+}
+
+// reconcileTenants creates a MySQL user for each StroomCluster claiming a multi-tenant DatabaseServer, along with its
+// databases. The users of StroomClusters that have released their claim are dropped, but their databases are retained.
+func (r *DatabaseServerReconciler) reconcileTenants(ctx context.Context, db *sql.DB, dbServer *stroomv1.DatabaseServer, existing []string) error {
+	logger := log.FromContext(ctx)
+
+	rootInfo := getClientConnectionInfo(dbServer, DatabaseRootUserName)
+	tlsConfig, err := GetDatabaseTlsConfig(r, ctx, &rootInfo, dbServer.Namespace)
+	if err != nil {
+		return err
+	}
+	users, err := queryStrings(ctx, db, "SELECT User FROM mysql.user WHERE Host = '%'")
+	if err != nil {
+		return err
+	}
+
+	var tenantUsers []string
+	for _, claim := range dbServer.StroomClusterClaims {
+		userInfo := DatabaseConnectionInfo{ServerAddress: stroomv1.ServerAddress{SecretName: claim.SecretName}, UserName: claim.UserName}
+		password, err := GetDatabasePassword(r, ctx, &userInfo, claim.StroomClusterRef.Namespace)
+		if err != nil {
+			return err
+		}
+
+		account := fmt.Sprintf("%v@'%%'", quoteString(claim.UserName))
+		if !slices.Contains(users, claim.UserName) {
+			if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE USER %v IDENTIFIED BY %v", account, quoteString(password))); err != nil {
+				logger.Error(err, "Failed to create user", "DatabaseServer", dbServer.Name, "User", claim.UserName)
+				return err
+			}
+			r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "TenantUserCreated", "CreateUser",
+				"Created user %v for StroomCluster %v", claim.UserName, claim.StroomClusterRef.String())
+		} else if !canConnect(ctx, dbServer, claim.UserName, password, tlsConfig) {
+			// The Secret was replaced, so the user is given its password
+			if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER USER %v IDENTIFIED BY %v", account, quoteString(password))); err != nil {
+				logger.Error(err, "Failed to change the password of user", "DatabaseServer", dbServer.Name, "User", claim.UserName)
+				return err
+			}
+		}
+
+		for _, name := range claim.DatabaseNames {
+			if !slices.Contains(existing, name) {
+				if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %v", quoteIdentifier(name))); err != nil {
+					logger.Error(err, "Failed to create database", "DatabaseServer", dbServer.Name, "Database", name)
+					return err
+				}
+				r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "DatabaseCreated", "CreateDatabase", "Created database %v", name)
+			}
+			if _, err := db.ExecContext(ctx, fmt.Sprintf("GRANT ALL PRIVILEGES ON %v.* TO %v", quoteIdentifier(name), account)); err != nil {
+				logger.Error(err, "Failed to grant privileges on database", "DatabaseServer", dbServer.Name, "Database", name)
+				return err
+			}
+		}
+		tenantUsers = append(tenantUsers, claim.UserName)
+	}
+
+	for _, userName := range dbServer.Status.TenantUsers {
+		if !slices.Contains(tenantUsers, userName) {
+			if _, err := db.ExecContext(ctx, fmt.Sprintf("DROP USER IF EXISTS %v@'%%'", quoteString(userName))); err != nil {
+				logger.Error(err, "Failed to drop user", "DatabaseServer", dbServer.Name, "User", userName)
+				return err
+			}
+			r.Recorder.Eventf(dbServer, nil, corev1.EventTypeNormal, "TenantUserDropped", "DropUser",
+				"Dropped user %v, as its StroomCluster no longer claims the DatabaseServer", userName)
+		}
+	}
+
+	dbServer.Status.TenantUsers = tenantUsers
+	return nil
+}
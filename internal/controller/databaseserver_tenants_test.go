@@ -0,0 +1,120 @@
+package controller
+
+import (
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("DatabaseServer tenants", func() {
+
+	var (
+		stroomCluster stroomv1.StroomCluster
+		dbServer      stroomv1.DatabaseServer
+	)
+
+	BeforeEach(func() {
+		stroomCluster = stroomv1.StroomCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev-1", Namespace: "stroom"},
+			Spec: stroomv1.StroomClusterSpec{
+				AppDatabaseName:   "stroom",
+				StatsDatabaseName: "stats",
+			},
+		}
+		dbServer = stroomv1.DatabaseServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "db"},
+			Spec:       stroomv1.DatabaseServerSpec{MultiTenant: true},
+		}
+	})
+
+	Context("useTenant()", func() {
+		It("should connect as the user and databases of the StroomCluster", func() {
+			dbInfo := DatabaseConnectionInfo{DatabaseServer: &dbServer, UserName: DatabaseServiceUserName}
+			dbInfo.useTenant(&stroomCluster)
+
+			Expect(dbInfo.UserName).Should(Equal("stroom_dev_1"))
+			Expect(dbInfo.SecretName).Should(Equal("stroom-dev-1-shared-db"))
+			Expect(dbInfo.GetDatabaseName("stroom")).Should(Equal("stroom_dev_1"))
+		})
+		It("should not change the connection to a single-tenant DatabaseServer", func() {
+			dbServer.Spec.MultiTenant = false
+			dbInfo := DatabaseConnectionInfo{DatabaseServer: &dbServer, UserName: DatabaseServiceUserName}
+			dbInfo.useTenant(&stroomCluster)
+
+			Expect(dbInfo.UserName).Should(Equal(DatabaseServiceUserName))
+			Expect(dbInfo.GetDatabaseName("stroom")).Should(Equal("stroom"))
+		})
+		It("should truncate long user names", func() {
+			stroomCluster.Name = "a-very-long-stroom-cluster-name-exceeding-the-limit"
+			Expect(getTenantUserName(&stroomCluster)).Should(HaveLen(MaxDatabaseUserNameLength))
+		})
+	})
+
+	Context("newDatabaseServerClaim()", func() {
+		It("should list only the databases hosted on the DatabaseServer", func() {
+			appDbInfo := DatabaseConnectionInfo{DatabaseServer: &dbServer}
+			appDbInfo.useTenant(&stroomCluster)
+			statsDbInfo := appDbInfo
+			Expect(newDatabaseServerClaim(&stroomCluster, &dbServer, &appDbInfo, &statsDbInfo).DatabaseNames).
+				Should(Equal([]string{"stroom_dev_1", "stats_dev_1"}))
+
+			statsDbInfo = DatabaseConnectionInfo{}
+			claim := newDatabaseServerClaim(&stroomCluster, &dbServer, &appDbInfo, &statsDbInfo)
+			Expect(claim.StroomClusterRef).Should(Equal(stroomv1.ResourceRef{Name: "dev-1", Namespace: "stroom"}))
+			Expect(claim.DatabaseNames).Should(Equal([]string{"stroom_dev_1"}))
+		})
+	})
+
+	Context("validateDatabaseServerClaim()", func() {
+		It("should deny sharing a user or database with another StroomCluster", func() {
+			claim := stroomv1.DatabaseServerClaim{
+				StroomClusterRef: stroomv1.ResourceRef{Name: "dev_1", Namespace: "other"},
+				UserName:         "stroom_dev_1",
+				DatabaseNames:    []string{"stroom_dev_1"},
+			}
+			Expect(validateDatabaseServerClaim(&dbServer, &claim)).Should(Succeed())
+
+			dbServer.StroomClusterClaims = []stroomv1.DatabaseServerClaim{{
+				StroomClusterRef: stroomv1.ResourceRef{Name: "dev-1", Namespace: "stroom"},
+				UserName:         "stroom_dev_1",
+				DatabaseNames:    []string{"stroom_dev_1"},
+			}}
+			Expect(validateDatabaseServerClaim(&dbServer, &claim)).Should(MatchError(ContainSubstring("MySQL user 'stroom_dev_1'")))
+
+			claim.UserName = "stroom_other"
+			Expect(validateDatabaseServerClaim(&dbServer, &claim)).Should(MatchError(ContainSubstring("database 'stroom_dev_1'")))
+		})
+		It("should allow a StroomCluster to update its own claim", func() {
+			dbServer.StroomClusterClaims = []stroomv1.DatabaseServerClaim{{
+				StroomClusterRef: stroomv1.ResourceRef{Name: "dev-1", Namespace: "stroom"},
+				UserName:         "stroom_dev_1",
+				DatabaseNames:    []string{"stroom_dev_1"},
+			}}
+			claim := dbServer.StroomClusterClaims[0]
+			claim.DatabaseNames = append(claim.DatabaseNames, "stats_dev_1")
+			Expect(validateDatabaseServerClaim(&dbServer, &claim)).Should(Succeed())
+		})
+	})
+
+	Context("getRotatedAccounts()", func() {
+		It("should rotate the password of each tenant user in its own Secret, before root", func() {
+			dbServer.StroomClusterClaims = []stroomv1.DatabaseServerClaim{
+				newDatabaseServerClaim(&stroomCluster, &dbServer, &DatabaseConnectionInfo{}, &DatabaseConnectionInfo{}),
+			}
+			serverSecret := types.NamespacedName{Namespace: "db", Name: dbServer.GetSecretName()}
+			Expect(getRotatedAccounts(&dbServer)).Should(Equal([]rotatedAccount{
+				{userName: DatabaseServiceUserName, secretRef: serverSecret},
+				{userName: "stroom_dev_1", secretRef: types.NamespacedName{Namespace: "stroom", Name: "stroom-dev-1-shared-db"}},
+				{userName: DatabaseRootUserName, secretRef: serverSecret},
+			}))
+		})
+	})
+
+	Context("quoteString()", func() {
+		It("should escape quotes and backslashes", func() {
+			Expect(quoteString(`pass'word\`)).Should(Equal(`'pass\'word\\'`))
+		})
+	})
+})
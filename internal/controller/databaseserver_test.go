@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	common "github.com/gradata-systems/stroom-k8s-operator/internal/controller/common"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("DatabaseServer", func() {
+
+	var (
+		reconciler DatabaseServerReconciler
+		dbServer   stroomv1.DatabaseServer
+		dbBackup   stroomv1.DatabaseBackup
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(stroomv1.AddToScheme(scheme)).Should(Succeed())
+		reconciler = DatabaseServerReconciler{Scheme: scheme}
+
+		dbServer = stroomv1.DatabaseServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.DatabaseServerSpec{
+				Image: stroomv1.Image{Repository: "mysql/mysql-server", Tag: "8.0.26"},
+			},
+		}
+		dbBackup = stroomv1.DatabaseBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.DatabaseBackupSpec{
+				TargetVolume: &corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			},
+		}
+	})
+
+	Context("createConfigMap()", func() {
+		It("should only enable binary logging when requested", func() {
+			Expect(reconciler.createConfigMap(&dbServer).Data["my.cnf"]).ShouldNot(ContainSubstring("log_bin"))
+
+			dbServer.Spec.BinaryLog = &stroomv1.BinaryLogSettings{BackupName: "dev", ExpireDays: 2, MaxFileSizeMB: 50}
+			config := reconciler.createConfigMap(&dbServer).Data["my.cnf"]
+			Expect(config).Should(ContainSubstring("log_bin=binlog\n"))
+			Expect(config).Should(ContainSubstring("binlog_expire_logs_seconds=172800\n"))
+			Expect(config).Should(ContainSubstring("max_binlog_size=50M\n"))
+		})
+	})
+
+	Context("createConfigMap() with TLS", func() {
+		It("should require clients to connect using TLS", func() {
+			Expect(reconciler.createConfigMap(&dbServer).Data["my.cnf"]).ShouldNot(ContainSubstring("require_secure_transport"))
+
+			dbServer.Spec.Tls = stroomv1.TlsSettings{SecretName: "stroom-dev-db-tls"}
+			Expect(reconciler.createConfigMap(&dbServer).Data["my.cnf"]).Should(ContainSubstring("ssl_cert=/etc/mysql/tls/tls.crt\nssl_key=/etc/mysql/tls/tls.key\nrequire_secure_transport=ON\n"))
+			Expect(reconciler.createStatefulSet(&dbServer, nil, "").Spec.Template.Spec.Volumes).Should(ContainElement(HaveField("VolumeSource.Secret.SecretName", "stroom-dev-db-tls")))
+
+			dbInfo := getClientConnectionInfo(&dbServer, DatabaseServiceUserName)
+			Expect(dbInfo.ToJdbcConnectionString("stroom")).Should(ContainSubstring("&sslMode=VERIFY_IDENTITY&trustCertificateKeyStoreUrl=file:/stroom/pki/database/truststore.p12"))
+		})
+		It("should verify the identity of replication group members", func() {
+			dbServer.Spec.Topology = stroomv1.GroupReplicationTopology
+			dbServer.Spec.Tls = stroomv1.TlsSettings{SecretName: "stroom-dev-db-tls"}
+			config := reconciler.createConfigMap(&dbServer).Data["my.cnf"]
+			Expect(config).Should(ContainSubstring("loose_group_replication_ssl_mode=VERIFY_IDENTITY\n"))
+			Expect(config).Should(ContainSubstring("loose_group_replication_recovery_ssl_verify_server_cert=ON\n"))
+		})
+	})
+
+	Context("createDbInitConfigMap()", func() {
+		It("should discard transactions executed while initialising a group member", func() {
+			Expect(reconciler.createDbInitConfigMap(&dbServer).Data).ShouldNot(HaveKey("zz-reset-gtids.sql"))
+
+			dbServer.Spec.Topology = stroomv1.GroupReplicationTopology
+			Expect(reconciler.createDbInitConfigMap(&dbServer).Data).Should(HaveKeyWithValue("zz-reset-gtids.sql", ContainSubstring("RESET MASTER")))
+		})
+	})
+
+	Context("createStatefulSet()", func() {
+		It("should read the root password from the Secret", func() {
+			container := reconciler.createStatefulSet(&dbServer, nil, "").Spec.Template.Spec.Containers[0]
+			Expect(container.Env).Should(ContainElement(And(
+				HaveField("Name", "MYSQL_ROOT_PASSWORD"),
+				HaveField("ValueFrom.SecretKeyRef.Key", DatabaseRootUserName),
+			)))
+		})
+		It("should deploy each member of a replication group", func() {
+			dbServer.UID = "8a94f5b0-71ca-11e1-9e33-c80aa9429562"
+			dbServer.Spec.Topology = stroomv1.GroupReplicationTopology
+			dbServer.Spec.Replicas = 3
+			Expect(reconciler.createConfigMap(&dbServer).Data["my.cnf"]).Should(ContainSubstring("loose_group_replication_group_name=8a94f5b0-71ca-11e1-9e33-c80aa9429562\n"))
+
+			statefulSet := reconciler.createStatefulSet(&dbServer, nil, "")
+			Expect(*statefulSet.Spec.Replicas).Should(Equal(int32(3)))
+			Expect(statefulSet.Spec.PodManagementPolicy).Should(Equal(appsv1.ParallelPodManagement))
+			Expect(statefulSet.Spec.Template.Spec.Containers[0].Args).Should(ContainElement("--report-host=$(POD_NAME).stroom-dev-db-headless.stroom.svc.cluster.local"))
+			Expect(reconciler.createService(&dbServer).Spec.PublishNotReadyAddresses).Should(BeTrue())
+			Expect(reconciler.createPrimaryService(&dbServer).Spec.Selector).Should(HaveKeyWithValue(stroomv1.DatabaseRoleLabel, DatabasePrimaryRole))
+		})
+		It("should restart Pods when the configuration changes", func() {
+			dbServer.Spec.PodAnnotations = map[string]string{"example.com/team": "stroom"}
+			configHash := common.HashConfigData(reconciler.createConfigMap(&dbServer).Data)
+			annotations := reconciler.createStatefulSet(&dbServer, nil, configHash).Spec.Template.Annotations
+			Expect(annotations).Should(HaveKeyWithValue(stroomv1.ConfigHashAnnotation, configHash))
+			Expect(annotations).Should(HaveKeyWithValue("example.com/team", "stroom"))
+
+			dbServer.Spec.AdditionalConfig = []string{"max_connections=500"}
+			Expect(common.HashConfigData(reconciler.createConfigMap(&dbServer).Data)).ShouldNot(Equal(configHash))
+		})
+		It("should not add the binary log shipper unless binary logging is enabled", func() {
+			statefulSet := reconciler.createStatefulSet(&dbServer, nil, "")
+			Expect(statefulSet.Spec.Template.Spec.Containers).Should(HaveLen(1))
+		})
+		It("should ship binary logs to the backup volume", func() {
+			dbServer.Spec.BinaryLog = &stroomv1.BinaryLogSettings{BackupName: "dev", ShipIntervalSeconds: 30}
+			podSpec := reconciler.createStatefulSet(&dbServer, &dbBackup, "").Spec.Template.Spec
+			Expect(podSpec.Containers).Should(HaveLen(2))
+
+			shipper := podSpec.Containers[1]
+			Expect(shipper.Name).Should(Equal("binlog-shipper"))
+			Expect(shipper.Env).Should(ContainElement(corev1.EnvVar{Name: "BINLOG_DIR", Value: "/stroom-backup/data/binlog"}))
+			Expect(shipper.VolumeMounts).Should(ContainElement(And(HaveField("Name", "data"), HaveField("ReadOnly", true))))
+			Expect(podSpec.Volumes).Should(ContainElement(HaveField("VolumeSource.ConfigMap.Name", dbServer.GetScriptsConfigMapName())))
+		})
+		It("should export metrics using TLS when enabled", func() {
+			dbServer.Spec.Metrics = &stroomv1.DatabaseMetricsSettings{Image: stroomv1.Image{Repository: "prom/mysqld-exporter", Tag: "v0.17.2"}}
+			dbServer.Spec.Tls = stroomv1.TlsSettings{SecretName: "stroom-dev-db-tls"}
+			podSpec := reconciler.createStatefulSet(&dbServer, nil, "").Spec.Template.Spec
+			Expect(podSpec.Containers).Should(HaveLen(2))
+
+			exporter := podSpec.Containers[1]
+			Expect(exporter.Args).Should(ContainElements("--mysqld.username=exporter", "--tls.insecure-skip-verify"))
+			Expect(exporter.Env[0].ValueFrom.SecretKeyRef.Key).Should(Equal(DatabaseMonitoringUserName))
+			Expect(exporter.VolumeMounts).Should(ContainElement(HaveField("Name", "tls")))
+			Expect(reconciler.createConfigMap(&dbServer).Data[DatabaseExporterConfigKey]).Should(Equal("[client]\nssl-ca=/etc/mysql/tls/ca.crt\n"))
+			Expect(reconciler.createService(&dbServer).Spec.Ports).Should(ContainElement(HaveField("Name", DatabaseMetricsPortName)))
+		})
+	})
+
+	Context("findGroupPrimary()", func() {
+		It("should only route to a primary that has quorum", func() {
+			members := []*groupMember{
+				{ordinal: 0, state: "ONLINE", role: "PRIMARY", hasQuorum: false},
+				{ordinal: 1, state: "ONLINE", role: "PRIMARY", hasQuorum: true},
+				{ordinal: 2, state: "UNREACHABLE"},
+			}
+			Expect(findGroupPrimary(members)).Should(Equal(members[1]))
+
+			members[1].state = "ERROR"
+			Expect(findGroupPrimary(members)).Should(BeNil())
+			Expect(isGroupForming(members)).Should(BeFalse())
+
+			members[2].state = "RECOVERING"
+			Expect(isGroupForming(members)).Should(BeTrue())
+		})
+	})
+
+	Context("getDatabaseChanges()", func() {
+		It("should create and grant databases added to the spec", func() {
+			dbServer.Spec.DatabaseNames = []string{"stroom", "stats"}
+			changes := getDatabaseChanges(&dbServer, []string{"mysql", "stroom"}, []string{"stroom"})
+			Expect(changes.create).Should(Equal([]string{"stats"}))
+			Expect(changes.grant).Should(Equal([]string{"stats"}))
+			Expect(changes.revoke).Should(BeEmpty())
+			Expect(changes.drop).Should(BeEmpty())
+		})
+		It("should only drop removed databases that are listed for removal", func() {
+			dbServer.Spec.DatabaseNames = []string{"stroom"}
+			changes := getDatabaseChanges(&dbServer, []string{"stroom", "stats", "stats_old"}, []string{"stroom", "stats", "stats_old"})
+			Expect(changes.revoke).Should(Equal([]string{"stats", "stats_old"}))
+			Expect(changes.drop).Should(BeEmpty())
+
+			dbServer.Spec.DropDatabaseNames = []string{"stats_old", "missing"}
+			changes = getDatabaseChanges(&dbServer, []string{"stroom", "stats", "stats_old"}, []string{"stroom"})
+			Expect(changes.drop).Should(Equal([]string{"stats_old"}))
+		})
+		It("should not drop databases claimed by a StroomCluster", func() {
+			dbServer.Spec.DropDatabaseNames = []string{"stroom_dev"}
+			dbServer.StroomClusterClaims = []stroomv1.DatabaseServerClaim{{DatabaseNames: []string{"stroom_dev"}}}
+			changes := getDatabaseChanges(&dbServer, []string{"stroom", "stroom_dev"}, []string{"stroom"})
+			Expect(changes.drop).Should(BeEmpty())
+		})
+	})
+
+	Context("isCredentialRotationDue()", func() {
+		It("should rotate passwords when requested", func() {
+			Expect(isCredentialRotationDue(&dbServer, time.Now())).Should(BeFalse())
+
+			dbServer.Annotations = map[string]string{stroomv1.RotateCredentialsAnnotation: "1"}
+			Expect(isCredentialRotationDue(&dbServer, time.Now())).Should(BeTrue())
+
+			dbServer.Status.CredentialRotation.LastRequest = "1"
+			Expect(isCredentialRotationDue(&dbServer, time.Now())).Should(BeFalse())
+		})
+		It("should rotate passwords once the interval has elapsed", func() {
+			lastRotationTime := metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+			dbServer.Spec.CredentialRotation.IntervalDays = 30
+			dbServer.Status.CredentialRotation.LastRotationTime = &lastRotationTime
+			Expect(isCredentialRotationDue(&dbServer, lastRotationTime.AddDate(0, 0, 29))).Should(BeFalse())
+			Expect(isCredentialRotationDue(&dbServer, lastRotationTime.AddDate(0, 0, 30))).Should(BeTrue())
+			Expect(getCredentialsRotatedValue(&dbServer)).Should(Equal("2026-01-01T00:00:00Z"))
+		})
+	})
+
+	Context("isRolloutComplete()", func() {
+		It("should wait for every Pod to run the current revision", func() {
+			replicas := int32(3)
+			statefulSet := appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+				Status: appsv1.StatefulSetStatus{
+					ObservedGeneration: 2,
+					UpdatedReplicas:    2,
+					CurrentRevision:    "dev-1",
+					UpdateRevision:     "dev-2",
+				},
+			}
+			Expect(isRolloutComplete(&statefulSet)).Should(BeFalse())
+
+			statefulSet.Status.UpdatedReplicas = 3
+			statefulSet.Status.CurrentRevision = "dev-2"
+			Expect(isRolloutComplete(&statefulSet)).Should(BeTrue())
+		})
+	})
+})
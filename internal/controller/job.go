@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// JobResult is the outcome reported by backup, verification and restore scripts in their container termination message
+type JobResult struct {
+	ArchivePath      string `json:"archivePath,omitempty"`
+	ArchiveSizeBytes int64  `json:"archiveSizeBytes,omitempty"`
+	PrunedCount      int    `json:"prunedCount,omitempty"`
+	// Details of the archive uploaded to object storage
+	ObjectUrl         string `json:"objectUrl,omitempty"`
+	ObjectSizeBytes   int64  `json:"objectSizeBytes,omitempty"`
+	ObjectPrunedCount int    `json:"objectPrunedCount,omitempty"`
+	// Number of tables checked when verifying an archive
+	VerifiedTables int `json:"verifiedTables,omitempty"`
+	// Number of binary log files replayed by a point-in-time restore
+	BinaryLogFiles int `json:"binaryLogFiles,omitempty"`
+}
+
+// getJobFinishedCondition returns the Complete or Failed condition of a Job, or nil if the Job is still running
+func getJobFinishedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i, condition := range job.Status.Conditions {
+		if condition.Status == corev1.ConditionTrue && (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) {
+			return &job.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// getJobResult combines the results written to the termination messages of the containers of a Job Pod that
+// succeeded. Returns nil if no result was reported.
+func getJobResult(ctx context.Context, c client.Reader, job *batchv1.Job) (*JobResult, error) {
+	pods := corev1.PodList{}
+	if err := c.List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		// Skip failed attempts, which are retried in a new Pod
+		if pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		var result *JobResult
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			terminated := containerStatus.State.Terminated
+			if terminated == nil || terminated.ExitCode != 0 || terminated.Message == "" {
+				continue
+			}
+
+			if result == nil {
+				result = &JobResult{}
+			}
+			if err := json.Unmarshal([]byte(terminated.Message), result); err != nil {
+				return nil, err
+			}
+		}
+		if result != nil {
+			return result, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// getJobFailureMessage returns the termination message of the most recently failed container of a Job. As Job
+// containers fall back to their logs on error, this is usually the last line written before the failure.
+// Returns an empty string if no failed container is found.
+func getJobFailureMessage(ctx context.Context, c client.Reader, job *batchv1.Job) (string, error) {
+	pods := corev1.PodList{}
+	if err := c.List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return "", err
+	}
+
+	var lastFailure *corev1.ContainerStateTerminated
+	for _, pod := range pods.Items {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			// Containers restarted in place by the OnFailure policy report the failure in their last state
+			for _, terminated := range []*corev1.ContainerStateTerminated{containerStatus.State.Terminated, containerStatus.LastTerminationState.Terminated} {
+				if terminated == nil || terminated.ExitCode == 0 || strings.TrimSpace(terminated.Message) == "" {
+					continue
+				}
+				if lastFailure == nil || terminated.FinishedAt.After(lastFailure.FinishedAt.Time) {
+					lastFailure = terminated
+				}
+			}
+		}
+	}
+
+	if lastFailure == nil {
+		return "", nil
+	}
+	lines := strings.Split(strings.TrimSpace(lastFailure.Message), "\n")
+	return strings.TrimSpace(lines[len(lines)-1]), nil
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	ReconcileResultSuccess = "success"
+	ReconcileResultRequeue = "requeue"
+	ReconcileResultError   = "error"
+)
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stroom_operator_reconcile_total",
+		Help: "Number of reconciles of each kind of custom resource, by result",
+	}, []string{"kind", "result"})
+
+	stroomClusterDrainDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "stroom_operator_stroomcluster_drain_duration_seconds",
+		Help:    "Time taken for the Stroom nodes of a deleted StroomCluster to finish their tasks",
+		Buckets: []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800},
+	}, []string{"namespace", "stroomcluster"})
+
+	stroomClusterDrainRemainingTasks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stroom_operator_stroomcluster_drain_remaining_tasks",
+		Help: "Number of tasks still processing on each Stroom node of a draining StroomCluster",
+	}, []string{"namespace", "stroomcluster", "node"})
+
+	taskLimitChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stroom_operator_autoscaler_task_limit_changes_total",
+		Help: "Number of task limit changes made by a StroomTaskAutoscaler, by direction",
+	}, []string{"namespace", "stroomcluster", "node", "task", "direction"})
+
+	taskLimitFrom = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stroom_operator_autoscaler_task_limit_from",
+		Help: "Task limit of a Stroom node before it was last changed by a StroomTaskAutoscaler",
+	}, []string{"namespace", "stroomcluster", "node", "task"})
+
+	taskLimitTo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stroom_operator_autoscaler_task_limit_to",
+		Help: "Task limit of a Stroom node after it was last changed by a StroomTaskAutoscaler",
+	}, []string{"namespace", "stroomcluster", "node", "task"})
+
+	databaseBackupLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stroom_operator_database_backup_last_success_timestamp_seconds",
+		Help: "Time the last successful backup Job of a DatabaseBackup completed, in seconds since the Unix epoch",
+	}, []string{"namespace", "databasebackup"})
+
+	databaseConnectionErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stroom_operator_database_connection_errors_total",
+		Help: "Number of failed attempts by a StroomCluster to connect to its databases",
+	}, []string{"namespace", "stroomcluster", "host"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		reconcileTotal,
+		stroomClusterDrainDuration,
+		stroomClusterDrainRemainingTasks,
+		taskLimitChangesTotal,
+		taskLimitFrom,
+		taskLimitTo,
+		databaseBackupLastSuccess,
+		databaseConnectionErrorsTotal,
+	)
+}
+
+// instrumentedReconciler counts the result of each reconcile of a custom resource
+type instrumentedReconciler struct {
+	kind       string
+	reconciler reconcile.Reconciler
+}
+
+// instrumentReconciler wraps a reconciler, so its results are recorded in the stroom_operator_reconcile_total metric
+func instrumentReconciler(kind string, reconciler reconcile.Reconciler) reconcile.Reconciler {
+	return &instrumentedReconciler{kind: kind, reconciler: reconciler}
+}
+
+func (r *instrumentedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	result, err := r.reconciler.Reconcile(ctx, req)
+	reconcileTotal.WithLabelValues(r.kind, getReconcileResult(result, err)).Inc()
+	return result, err
+}
+
+func getReconcileResult(result ctrl.Result, err error) string {
+	if err != nil {
+		return ReconcileResultError
+	} else if result.Requeue || result.RequeueAfter > 0 {
+		return ReconcileResultRequeue
+	}
+	return ReconcileResultSuccess
+}
+
+// recordRemainingTasks replaces the number of tasks remaining on each node of a draining StroomCluster
+func recordRemainingTasks(stroomCluster *stroomv1.StroomCluster, remainingTasks map[string]int) {
+	stroomClusterDrainRemainingTasks.DeletePartialMatch(prometheus.Labels{"namespace": stroomCluster.Namespace, "stroomcluster": stroomCluster.Name})
+	for nodeName, taskCount := range remainingTasks {
+		stroomClusterDrainRemainingTasks.WithLabelValues(stroomCluster.Namespace, stroomCluster.Name, nodeName).Set(float64(taskCount))
+	}
+}
+
+// recordDrainCompleted records how long a StroomCluster took to drain, from when it was marked for deletion
+func recordDrainCompleted(stroomCluster *stroomv1.StroomCluster, now time.Time) {
+	stroomClusterDrainRemainingTasks.DeletePartialMatch(prometheus.Labels{"namespace": stroomCluster.Namespace, "stroomcluster": stroomCluster.Name})
+	if stroomCluster.DeletionTimestamp != nil {
+		stroomClusterDrainDuration.WithLabelValues(stroomCluster.Namespace, stroomCluster.Name).
+			Observe(now.Sub(stroomCluster.DeletionTimestamp.Time).Seconds())
+	}
+}
+
+// recordTaskLimitChange records a change to the task limit of a Stroom node by a StroomTaskAutoscaler
+func recordTaskLimitChange(stroomCluster *stroomv1.StroomCluster, nodeName string, taskName string, from int, to int) {
+	direction := "up"
+	if to < from {
+		direction = "down"
+	}
+	taskLimitChangesTotal.WithLabelValues(stroomCluster.Namespace, stroomCluster.Name, nodeName, taskName, direction).Inc()
+	taskLimitFrom.WithLabelValues(stroomCluster.Namespace, stroomCluster.Name, nodeName, taskName).Set(float64(from))
+	taskLimitTo.WithLabelValues(stroomCluster.Namespace, stroomCluster.Name, nodeName, taskName).Set(float64(to))
+}
+
+// recordBackupSuccess exports the time of the last successful backup of a DatabaseBackup
+func recordBackupSuccess(dbBackup *stroomv1.DatabaseBackup) {
+	if lastSuccess := dbBackup.Status.LastSuccessfulTime; lastSuccess != nil {
+		databaseBackupLastSuccess.WithLabelValues(dbBackup.Namespace, dbBackup.Name).Set(float64(lastSuccess.Unix()))
+	}
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("Operator metrics", func() {
+
+	var stroomCluster stroomv1.StroomCluster
+
+	BeforeEach(func() {
+		stroomCluster = stroomv1.StroomCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "metrics-test", Namespace: "stroom"},
+		}
+	})
+
+	Context("getReconcileResult()", func() {
+		It("should classify the result of a reconcile", func() {
+			Expect(getReconcileResult(ctrl.Result{}, nil)).Should(Equal(ReconcileResultSuccess))
+			Expect(getReconcileResult(ctrl.Result{RequeueAfter: time.Minute}, nil)).Should(Equal(ReconcileResultRequeue))
+			Expect(getReconcileResult(ctrl.Result{}, errors.New("failed"))).Should(Equal(ReconcileResultError))
+		})
+	})
+
+	Context("recordRemainingTasks()", func() {
+		It("should only report nodes with remaining tasks", func() {
+			recordRemainingTasks(&stroomCluster, map[string]int{"node-0": 3, "node-1": 1})
+			recordRemainingTasks(&stroomCluster, map[string]int{"node-0": 2})
+
+			Expect(testutil.ToFloat64(stroomClusterDrainRemainingTasks.WithLabelValues("stroom", "metrics-test", "node-0"))).Should(Equal(2.0))
+			Expect(stroomClusterDrainRemainingTasks.DeleteLabelValues("stroom", "metrics-test", "node-1")).Should(BeFalse())
+
+			deletionTime := metav1.NewTime(time.Now().Add(-time.Minute))
+			stroomCluster.DeletionTimestamp = &deletionTime
+			recordDrainCompleted(&stroomCluster, deletionTime.Add(time.Minute))
+			Expect(stroomClusterDrainRemainingTasks.DeleteLabelValues("stroom", "metrics-test", "node-0")).Should(BeFalse())
+		})
+	})
+
+	Context("recordTaskLimitChange()", func() {
+		It("should record the previous and new task limit", func() {
+			recordTaskLimitChange(&stroomCluster, "node-0", "Data Processor", 10, 5)
+
+			Expect(testutil.ToFloat64(taskLimitChangesTotal.WithLabelValues("stroom", "metrics-test", "node-0", "Data Processor", "down"))).Should(Equal(1.0))
+			Expect(testutil.ToFloat64(taskLimitFrom.WithLabelValues("stroom", "metrics-test", "node-0", "Data Processor"))).Should(Equal(10.0))
+			Expect(testutil.ToFloat64(taskLimitTo.WithLabelValues("stroom", "metrics-test", "node-0", "Data Processor"))).Should(Equal(5.0))
+		})
+	})
+})
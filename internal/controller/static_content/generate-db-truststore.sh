@@ -0,0 +1,6 @@
+#!/bin/bash
+# Creates a truststore from the CA certificates of each database server, mounted under /opt/database-ca/<name>
+
+truststore_path='/data/truststore.p12'
+echo "Creating database truststore: $truststore_path"
+openssl pkcs12 -in <(cat /opt/database-ca/*/ca.crt) -nokeys -export -out "$truststore_path" -passout "pass:${DATABASE_TRUSTSTORE_PASSWORD}" -jdktrust anyExtendedKeyUsage
@@ -1,33 +1,19 @@
 #!/bin/bash
 # Executed by the pod pre-stop hook.
-
-source /stroom/scripts/utils.sh
+# Once the Pod is terminating, the operator disables the node and its jobs, and annotates the Pod when no tasks remain.
+# If the node does not drain, the container is stopped at the end of the termination grace period.
 
 log_file='/stroom/logs/k8s/pre-stop.log'
+annotations_file='/stroom/pod-info/annotations'
 
 mkdir -p "$(dirname $log_file)"
 
-# Disable all node tasks, so the node can drain
-set_job_status "${STROOM_NODE}" 'false'
-log "Node ${STROOM_NODE} jobs disabled" $log_file
-
-# Disable the node so the cluster doesn't attempt to contact it while it's unresponsive
-call_api node/v1/enabled/"${STROOM_NODE}" -X PUT -d false
-log "Node ${STROOM_NODE} disabled" $log_file
-
-task_count=-1
-while :
-do
-  # Get the number of active tasks for this node
-  task_list=$(call_api task/v1/list/"${STROOM_NODE}")
-  task_count=$(echo "$task_list" | jq '.pageResponse.total')
-  if [[ $task_count -eq 0 ]]; then
-    # Allow the node to shut down as there are no active tasks
-    log "All tasks drained for node ${STROOM_NODE}. Node shutting down." $log_file
-    exit 0
-  else
-    log "Shutdown blocked for node ${STROOM_NODE}, as there are still $task_count active tasks" $log_file
-  fi
+function log() {
+  echo "[$(date '+%Y-%m-%d %H:%M:%S')] $1" >> "$log_file"
+}
 
+log "Waiting for the operator to drain node ${STROOM_NODE}"
+until grep -q '^stroom.gchq.github.io/drained=' "$annotations_file"; do
   sleep 5
 done
+log "All tasks drained for node ${STROOM_NODE}. Node shutting down."
@@ -0,0 +1,31 @@
+#!/bin/bash
+# Substitutes database passwords read from files into the Stroom config, in place of the password environment
+# variables. A password is read from the file named by the variable with the `_FILE` suffix, if set.
+
+config_path='/data/config.yml'
+echo "Rendering config: $config_path"
+
+password_vars=(STROOM_JDBC_DRIVER_PASSWORD STROOM_STATISTICS_JDBC_DRIVER_PASSWORD)
+config=$(< /opt/config/config.yml)
+
+# Replace each variable with a placeholder first, so a substituted password is never matched as a variable
+for name in "${password_vars[@]}"; do
+  file_var="${name}_FILE"
+  if [ -n "${!file_var}" ]; then
+    config=$(printf '%s\n' "$config" | sed -E "s/\\$\\{${name}(:-[^}]*)?\\}/__${name}__/g")
+  fi
+done
+
+for name in "${password_vars[@]}"; do
+  file_var="${name}_FILE"
+  if [ -n "${!file_var}" ]; then
+    password=$(< "${!file_var}")
+    # Escape the password for a YAML double-quoted string, and prevent Stroom substituting variables within it
+    password=${password//\\/\\\\}
+    password=${password//\"/\\\"}
+    password=${password//\$\{/\$\$\{}
+    config=${config//__${name}__/"${password}"}
+  fi
+done
+
+printf '%s\n' "$config" > "$config_path"
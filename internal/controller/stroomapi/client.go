@@ -0,0 +1,206 @@
+// Package stroomapi is a client for the Stroom REST API, used to manage the lifecycle of Stroom nodes
+package stroomapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TokenExpiryThreshold is how long before it expires an access token is replaced
+	TokenExpiryThreshold = time.Second * 10
+	// DefaultTimeout is the time limit for each request made by a Client
+	DefaultTimeout = time.Second * 30
+
+	tokenRequestPath = "authproxy/v1/fetchClientCredsToken"
+)
+
+// Client calls the Stroom API using an OAuth2 client credentials token, which is cached until it is about to expire
+type Client struct {
+	// BaseUrl is the URL of the Stroom API (e.g. http://stroom:8080/api)
+	BaseUrl      string
+	ClientId     string
+	ClientSecret string
+	HttpClient   *http.Client
+
+	mutex       sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// ApiError is returned when the Stroom API responds with an unsuccessful status code
+type ApiError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Body       string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("%v %v failed with status %v: %v", e.Method, e.Url, e.StatusCode, e.Body)
+}
+
+func NewClient(baseUrl string, clientId string, clientSecret string) *Client {
+	return &Client{
+		BaseUrl:      strings.TrimSuffix(baseUrl, "/"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		HttpClient:   &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// SetNodeEnabled enables or disables a Stroom node. Other nodes do not contact a disabled node.
+func (c *Client) SetNodeEnabled(ctx context.Context, nodeName string, enabled bool) error {
+	return c.call(ctx, http.MethodPut, "node/v1/enabled/"+url.PathEscape(nodeName), enabled, nil)
+}
+
+// SetJobsEnabled enables or disables the jobs of a Stroom node. If includeJobs is empty, all jobs are changed.
+func (c *Client) SetJobsEnabled(ctx context.Context, nodeName string, enabled bool, includeJobs []string) error {
+	if includeJobs == nil {
+		includeJobs = []string{}
+	}
+	request := SetJobsEnabledRequest{Enabled: enabled, IncludeJobs: includeJobs}
+	return c.call(ctx, http.MethodPut, "job/v1/setJobsEnabled/"+url.PathEscape(nodeName), request, nil)
+}
+
+// ListTasks returns the tasks running on a Stroom node
+func (c *Client) ListTasks(ctx context.Context, nodeName string) (*TaskProgressResponse, error) {
+	response := TaskProgressResponse{}
+	if err := c.call(ctx, http.MethodGet, "task/v1/list/"+url.PathEscape(nodeName), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// CountTasks returns the number of tasks running on a Stroom node
+func (c *Client) CountTasks(ctx context.Context, nodeName string) (int64, error) {
+	response, err := c.ListTasks(ctx, nodeName)
+	if err != nil {
+		return 0, err
+	}
+	return response.PageResponse.GetTotal(), nil
+}
+
+// call sends a JSON request to the Stroom API and decodes the response into result, if not nil
+func (c *Client) call(ctx context.Context, method string, path string, body any, result any) error {
+	token, err := c.getToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var requestBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.BaseUrl+"/"+path, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	responseBody, err := c.send(request)
+	if err != nil {
+		return err
+	}
+	if result != nil {
+		if err := json.Unmarshal(responseBody, result); err != nil {
+			return fmt.Errorf("invalid response from %v %v: %w", method, request.URL, err)
+		}
+	}
+	return nil
+}
+
+// send performs an HTTP request, returning the response body if successful
+func (c *Client) send(request *http.Request) ([]byte, error) {
+	response, err := c.HttpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, &ApiError{
+			Method:     request.Method,
+			Url:        request.URL.String(),
+			StatusCode: response.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+	return body, nil
+}
+
+// getToken returns the cached access token, requesting a new one from the Stroom auth proxy if it is about to expire
+func (c *Client) getToken(ctx context.Context) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && time.Now().Before(c.tokenExpiry.Add(-TokenExpiryThreshold)) {
+		return c.token, nil
+	}
+
+	data, err := json.Marshal(ClientCredentials{ClientId: c.ClientId, ClientSecret: c.ClientSecret})
+	if err != nil {
+		return "", err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseUrl+"/"+tokenRequestPath, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Accept", "text/plain")
+	request.Header.Set("Content-Type", "application/json")
+
+	body, err := c.send(request)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(body))
+	expiry, err := getTokenExpiry(token)
+	if err != nil {
+		return "", err
+	}
+
+	c.token = token
+	c.tokenExpiry = expiry
+	return token, nil
+}
+
+// getTokenExpiry reads the expiry time from the claims of a JWT. The signature is not verified, as the token is only
+// presented back to the server that issued it.
+func getTokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("access token is not a valid JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("access token payload could not be decoded: %w", err)
+	}
+	claims := struct {
+		Expiry int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("access token claims could not be parsed: %w", err)
+	}
+	return time.Unix(claims.Expiry, 0), nil
+}
@@ -0,0 +1,103 @@
+package stroomapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// newToken returns an unsigned JWT expiring at the specified time
+func newToken(expiry time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%v}`, expiry.Unix())))
+	return header + "." + payload + ".signature"
+}
+
+var _ = Describe("Client", func() {
+
+	var (
+		server        *httptest.Server
+		client        *Client
+		tokenRequests int
+		tokenExpiry   time.Time
+		requests      map[string]string
+	)
+
+	BeforeEach(func() {
+		tokenRequests = 0
+		tokenExpiry = time.Now().Add(time.Hour)
+		requests = map[string]string{}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/authproxy/v1/fetchClientCredsToken", func(w http.ResponseWriter, r *http.Request) {
+			credentials := ClientCredentials{}
+			Expect(json.NewDecoder(r.Body).Decode(&credentials)).Should(Succeed())
+			if credentials.ClientId != "stroom-operator" || credentials.ClientSecret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokenRequests++
+			_, _ = w.Write([]byte(newToken(tokenExpiry)))
+		})
+		record := func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+newToken(tokenExpiry) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			requests[r.Method+" "+r.URL.Path] = string(body)
+		}
+		mux.HandleFunc("PUT /api/node/v1/enabled/{node}", record)
+		mux.HandleFunc("PUT /api/job/v1/setJobsEnabled/{node}", record)
+		mux.HandleFunc("GET /api/task/v1/list/{node}", func(w http.ResponseWriter, r *http.Request) {
+			record(w, r)
+			_, _ = w.Write([]byte(`{"values":[{"taskName":"Data Processor","nodeName":"node-0"}],"pageResponse":{"offset":0,"length":1,"total":1,"exact":true}}`))
+		})
+		server = httptest.NewServer(mux)
+		client = NewClient(server.URL+"/api/", "stroom-operator", "secret")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should enable a node and its jobs", func(ctx SpecContext) {
+		Expect(client.SetNodeEnabled(ctx, "node-0", true)).Should(Succeed())
+		Expect(client.SetJobsEnabled(ctx, "node-0", true, nil)).Should(Succeed())
+
+		Expect(requests).Should(HaveKeyWithValue("PUT /api/node/v1/enabled/node-0", "true"))
+		Expect(requests).Should(HaveKeyWithValue("PUT /api/job/v1/setJobsEnabled/node-0", `{"enabled":true,"includeJobs":[]}`))
+	})
+
+	It("should count the tasks running on a node", func(ctx SpecContext) {
+		Expect(client.CountTasks(ctx, "node-0")).Should(Equal(int64(1)))
+	})
+
+	It("should cache the access token until it is about to expire", func(ctx SpecContext) {
+		Expect(client.SetNodeEnabled(ctx, "node-0", false)).Should(Succeed())
+		Expect(client.SetNodeEnabled(ctx, "node-1", false)).Should(Succeed())
+		Expect(tokenRequests).Should(Equal(1))
+
+		tokenExpiry = time.Now().Add(TokenExpiryThreshold / 2)
+		client.tokenExpiry = tokenExpiry
+		Expect(client.SetNodeEnabled(ctx, "node-0", false)).Should(Succeed())
+		Expect(client.SetNodeEnabled(ctx, "node-1", false)).Should(Succeed())
+		Expect(tokenRequests).Should(Equal(3))
+	})
+
+	It("should return the status of a failed request", func(ctx SpecContext) {
+		client.ClientSecret = "wrong"
+		err := client.SetNodeEnabled(ctx, "node-0", true)
+
+		apiError := &ApiError{}
+		Expect(err).Should(BeAssignableToTypeOf(apiError))
+		Expect(err.(*ApiError).StatusCode).Should(Equal(http.StatusUnauthorized))
+	})
+})
@@ -0,0 +1,13 @@
+package stroomapi
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestStroomApi(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Stroom API Suite")
+}
@@ -0,0 +1,45 @@
+package stroomapi
+
+// ClientCredentials is sent to the Stroom auth proxy to obtain an access token
+type ClientCredentials struct {
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+type SetJobsEnabledRequest struct {
+	Enabled bool `json:"enabled"`
+	// IncludeJobs lists the names of the jobs to change. If empty, all jobs are changed.
+	IncludeJobs []string `json:"includeJobs"`
+}
+
+type PageResponse struct {
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	Total  *int64 `json:"total,omitempty"`
+	Exact  bool   `json:"exact"`
+}
+
+// GetTotal returns the total number of results, or the number returned if the total is unknown
+func (in *PageResponse) GetTotal() int64 {
+	if in.Total == nil {
+		return int64(in.Length)
+	}
+	return *in.Total
+}
+
+type TaskProgress struct {
+	Id       TaskId `json:"id"`
+	TaskName string `json:"taskName"`
+	NodeName string `json:"nodeName"`
+	UserName string `json:"userName"`
+	TaskInfo string `json:"taskInfo"`
+}
+
+type TaskId struct {
+	Id string `json:"id"`
+}
+
+type TaskProgressResponse struct {
+	Values       []TaskProgress `json:"values"`
+	PageResponse PageResponse   `json:"pageResponse"`
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -19,26 +21,28 @@ import (
 )
 
 const (
-	AppHttpPortName             = "app-http"
-	AppHttpPortNumber           = 8080
-	AppHttpsPortName            = "app-https"
-	AppHttpsPortNumber          = 8443
-	AdminPortName               = "admin"
-	AdminPortNumber             = 8081
-	StaticContentVolumeName     = "static-content"
-	StroomNodePvcName           = "data"
-	StroomNodeContainerName     = "stroom-node"
-	StroomKeystoreVolumeName    = "keystore"
-	StroomTlsVolumeName         = "tls"
-	StroomApiTokenVolumeName    = "api-token"
-	StroomApiTokenMountPath     = "/stroom/auth"
-	LogSenderConfigMapName      = "log-sender-configmap"
-	LogSenderDefaultCpuLimit    = "500m"
-	LogSenderDefaultMemoryLimit = "256Mi"
-	LogSenderCertsVolumeName    = "log-sender-certs"
+	AppHttpPortName                = "app-http"
+	AppHttpPortNumber              = 8080
+	AppHttpsPortName               = "app-https"
+	AppHttpsPortNumber             = 8443
+	AdminPortName                  = "admin"
+	AdminPortNumber                = 8081
+	StaticContentVolumeName        = "static-content"
+	StroomNodePvcName              = "data"
+	StroomNodeContainerName        = "stroom-node"
+	StroomKeystoreVolumeName       = "keystore"
+	StroomTlsVolumeName            = "tls"
+	StroomPodInfoVolumeName        = "pod-info"
+	StroomConfigMountPath          = "/stroom/config/config.yml"
+	StroomRenderedConfigVolumeName = "rendered-config"
+	LogSenderConfigMapName         = "log-sender-configmap"
+	LogSenderDefaultCpuLimit       = "500m"
+	LogSenderDefaultMemoryLimit    = "256Mi"
+	LogSenderCertsVolumeName       = "log-sender-certs"
 )
 
-func (r *StroomClusterReconciler) createNodeSetPvcLabels(stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet) map[string]string {
+// createNodeSetLabels returns the labels of the objects created for a NodeSet, so they can be found if it is removed
+func (r *StroomClusterReconciler) createNodeSetLabels(stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet) map[string]string {
 	labels := stroomCluster.GetLabels()
 	labels[stroomv1.NodeSetLabel] = nodeSet.Name
 
@@ -123,10 +127,54 @@ func (r *StroomClusterReconciler) createStaticContentVolume(stroomCluster *stroo
 	}
 }
 
-func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, dbInfo *DatabaseConnectionInfo) *appsv1.StatefulSet {
+// stroomDatabase describes how a Stroom node is provided with the password and CA certificate of a database connection
+type stroomDatabase struct {
+	dbInfo             *DatabaseConnectionInfo
+	passwordEnvName    string
+	caVolumeName       string
+	passwordVolumeName string
+	passwordMountPath  string
+}
+
+// getStroomDatabases returns the app and statistics database connections of a Stroom node. Unless a separate
+// statistics database server is specified, both connections share the same volumes.
+func getStroomDatabases(stroomCluster *stroomv1.StroomCluster, dbInfo *DatabaseConnectionInfo, statsDbInfo *DatabaseConnectionInfo) []stroomDatabase {
+	statsDatabase := stroomDatabase{
+		dbInfo:             statsDbInfo,
+		passwordEnvName:    "STROOM_STATISTICS_JDBC_DRIVER_PASSWORD",
+		caVolumeName:       DatabaseCaVolumeName,
+		passwordVolumeName: DatabasePasswordVolumeName,
+		passwordMountPath:  DatabasePasswordMountPath,
+	}
+	if stroomCluster.Spec.StatsDatabaseServerRef != nil {
+		statsDatabase.caVolumeName = StatsDatabaseCaVolumeName
+		statsDatabase.passwordVolumeName = StatsDatabasePasswordVolumeName
+		statsDatabase.passwordMountPath = StatsDatabasePasswordMountPath
+	}
+
+	return []stroomDatabase{{
+		dbInfo:             dbInfo,
+		passwordEnvName:    "STROOM_JDBC_DRIVER_PASSWORD",
+		caVolumeName:       DatabaseCaVolumeName,
+		passwordVolumeName: DatabasePasswordVolumeName,
+		passwordMountPath:  DatabasePasswordMountPath,
+	}, statsDatabase}
+}
+
+// containsVolume returns whether a volume with the specified name exists in the list
+func containsVolume(volumes []corev1.Volume, name string) bool {
+	return slices.ContainsFunc(volumes, func(volume corev1.Volume) bool {
+		return volume.Name == name
+	})
+}
+
+// createStatefulSet creates the StatefulSet for a NodeSet. The image may differ from the StroomCluster image while
+// an upgrade is in progress.
+func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, dbInfo *DatabaseConnectionInfo, statsDbInfo *DatabaseConnectionInfo, image string, configHash string) *appsv1.StatefulSet {
 	logSender := stroomCluster.Spec.LogSender
+	databases := getStroomDatabases(stroomCluster, dbInfo, statsDbInfo)
 
-	env := append([]corev1.EnvVar{{
+	env := []corev1.EnvVar{{
 		Name:  "API_GATEWAY_HOST",
 		Value: stroomCluster.Spec.Ingress.HostName,
 	}, {
@@ -183,64 +231,39 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 		Value: string(nodeSet.Role),
 	}, {
 		Name:  "STROOM_JDBC_DRIVER_URL",
-		Value: dbInfo.ToJdbcConnectionString(stroomCluster.Spec.AppDatabaseName),
+		Value: dbInfo.ToJdbcConnectionString(dbInfo.GetDatabaseName(stroomCluster.Spec.AppDatabaseName)),
 	}, {
 		Name:  "STROOM_JDBC_DRIVER_CLASS_NAME",
 		Value: "com.mysql.cj.jdbc.Driver",
 	}, {
 		Name:  "STROOM_JDBC_DRIVER_USERNAME",
 		Value: dbInfo.UserName,
-	}, {
-		Name: "STROOM_JDBC_DRIVER_PASSWORD",
-		ValueFrom: &corev1.EnvVarSource{
-			SecretKeyRef: &corev1.SecretKeySelector{
-				LocalObjectReference: corev1.LocalObjectReference{
-					Name: dbInfo.SecretName,
-				},
-				Key: dbInfo.UserName,
-			},
-		},
 	}, {
 		Name:  "STROOM_STATISTICS_JDBC_DRIVER_URL",
-		Value: dbInfo.ToJdbcConnectionString(stroomCluster.Spec.StatsDatabaseName),
+		Value: statsDbInfo.ToJdbcConnectionString(statsDbInfo.GetDatabaseName(stroomCluster.Spec.StatsDatabaseName)),
 	}, {
 		Name:  "STROOM_STATISTICS_JDBC_DRIVER_CLASS_NAME",
 		Value: "com.mysql.cj.jdbc.Driver",
 	}, {
 		Name:  "STROOM_STATISTICS_JDBC_DRIVER_USERNAME",
-		Value: dbInfo.UserName,
-	}, {
-		Name: "STROOM_STATISTICS_JDBC_DRIVER_PASSWORD",
-		ValueFrom: &corev1.EnvVarSource{
-			SecretKeyRef: &corev1.SecretKeySelector{
-				LocalObjectReference: corev1.LocalObjectReference{
-					Name: dbInfo.SecretName,
-				},
-				Key: dbInfo.UserName,
-			},
-		},
+		Value: statsDbInfo.UserName,
 	}, {
 		Name:  "STROOM_TEMP",
 		Value: "/stroom/tmp",
-	}}, stroomCluster.Spec.ExtraEnv...)
-
-	// List the jobs that should be managed by the node startup and shutdown scripts.
-	// These are typically node role dependent. Frontend nodes for instance, shouldn't have the `Data Processor` node
-	// enabled.
-	var includeJobs []string
-	if nodeSet.ManagedJobs != nil && len(nodeSet.ManagedJobs) > 0 {
-		includeJobs = nodeSet.ManagedJobs
-	} else if nodeSet.Role == stroomv1.ProcessingNodeRole {
-		includeJobs = []string{}
-	} else if nodeSet.Role == stroomv1.FrontendNodeRole {
-		includeJobs = []string{
-			"Reindex Content",
+	}}
+
+	// If a password is read from a file, it is substituted into the Stroom config by an init container instead
+	for _, database := range databases {
+		if secretKeyRef := database.dbInfo.getPasswordSecretKeyRef(); secretKeyRef != nil {
+			env = append(env, corev1.EnvVar{
+				Name: database.passwordEnvName,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: secretKeyRef,
+				},
+			})
 		}
 	}
-	env = append(env, corev1.EnvVar{
-		Name:  "STROOM_NODE_MANAGED_JOBS",
-		Value: strings.Join(includeJobs, ","),
-	})
+	env = append(env, stroomCluster.Spec.ExtraEnv...)
 
 	if !stroomCluster.Spec.Https.IsZero() {
 		env = append(env, corev1.EnvVar{
@@ -281,9 +304,15 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 	volumes := []corev1.Volume{
 		*r.createStaticContentVolume(stroomCluster),
 		{
-			Name: StroomApiTokenVolumeName,
+			// Exposes the Pod annotations to the pre-stop hook, which waits for the operator to drain the node
+			Name: StroomPodInfoVolumeName,
 			VolumeSource: corev1.VolumeSource{
-				EmptyDir: &corev1.EmptyDirVolumeSource{},
+				DownwardAPI: &corev1.DownwardAPIVolumeSource{
+					Items: []corev1.DownwardAPIVolumeFile{{
+						Path:     "annotations",
+						FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.annotations"},
+					}},
+				},
 			},
 		},
 	}
@@ -346,23 +375,14 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 	}
 
 	volumeMounts := []corev1.VolumeMount{{
-		Name:      StaticContentVolumeName,
-		SubPath:   "utils.sh",
-		MountPath: "/stroom/scripts/utils.sh",
-		ReadOnly:  true,
-	}, {
-		Name:      StaticContentVolumeName,
-		SubPath:   "node-start.sh",
-		MountPath: "/stroom/scripts/node-start.sh",
-		ReadOnly:  true,
-	}, {
 		Name:      StaticContentVolumeName,
 		SubPath:   "node-pre-stop.sh",
 		MountPath: "/stroom/scripts/node-pre-stop.sh",
 		ReadOnly:  true,
 	}, {
-		Name:      StroomApiTokenVolumeName,
-		MountPath: StroomApiTokenMountPath,
+		Name:      StroomPodInfoVolumeName,
+		MountPath: "/stroom/pod-info",
+		ReadOnly:  true,
 	}, {
 		Name:      StroomNodePvcName,
 		SubPath:   "logs",
@@ -413,7 +433,65 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 		})
 	}
 
-	r.appendConfigVolumeMounts(stroomCluster, &volumeMounts)
+	var initContainers []corev1.Container
+	var renderConfigEnv []corev1.EnvVar
+	var passwordVolumeMounts []corev1.VolumeMount
+	for _, database := range databases {
+		if database.dbInfo.getPasswordSecretKeyRef() == nil {
+			renderConfigEnv = append(renderConfigEnv, corev1.EnvVar{
+				Name:  database.passwordEnvName + "_FILE",
+				Value: database.dbInfo.getPasswordFilePath(database.passwordMountPath),
+			})
+			if !containsVolume(volumes, database.passwordVolumeName) {
+				volumes = append(volumes, database.dbInfo.createPasswordVolume(database.passwordVolumeName))
+				passwordVolumeMounts = append(passwordVolumeMounts, createPasswordVolumeMount(database.passwordVolumeName, database.passwordMountPath))
+			}
+		}
+	}
+	if len(renderConfigEnv) == 0 {
+		volumeMounts = append(volumeMounts, r.createConfigVolumeMount(stroomCluster, StroomConfigMountPath))
+	} else {
+		// A database password is read from a file, which Stroom cannot do. Substitute the password into a copy of
+		// the config, so it is not exposed in the environment.
+		volumes = append(volumes, corev1.Volume{
+			Name: StroomRenderedConfigVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{
+					Medium: corev1.StorageMediumMemory,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      StroomRenderedConfigVolumeName,
+			SubPath:   "config.yml",
+			MountPath: StroomConfigMountPath,
+			ReadOnly:  true,
+		})
+		initContainers = append(initContainers, corev1.Container{
+			Name:            "render-config",
+			Image:           image,
+			ImagePullPolicy: stroomCluster.Spec.ImagePullPolicy,
+			Command: []string{
+				"sh",
+				"-c",
+				"/opt/scripts/render-config.sh",
+			},
+			Env: renderConfigEnv,
+			VolumeMounts: append([]corev1.VolumeMount{
+				{
+					Name:      StaticContentVolumeName,
+					SubPath:   "render-config.sh",
+					MountPath: "/opt/scripts/render-config.sh",
+					ReadOnly:  true,
+				},
+				r.createConfigVolumeMount(stroomCluster, "/opt/config/config.yml"),
+				{
+					Name:      StroomRenderedConfigVolumeName,
+					MountPath: "/data",
+				},
+			}, passwordVolumeMounts...),
+		})
+	}
 
 	if len(stroomCluster.Spec.ExtraVolumes) > 0 {
 		volumes = append(volumes, stroomCluster.Spec.ExtraVolumes...)
@@ -425,11 +503,10 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 		volumeMounts = append(volumeMounts, nodeSet.ExtraVolumeMounts...)
 	}
 
-	var initContainers []corev1.Container
 	if !stroomCluster.Spec.Https.IsZero() {
 		initContainers = append(initContainers, corev1.Container{
 			Name:            "generate-keystore",
-			Image:           stroomCluster.Spec.Image.String(),
+			Image:           image,
 			ImagePullPolicy: stroomCluster.Spec.ImagePullPolicy,
 			Command: []string{
 				"sh",
@@ -464,9 +541,58 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 		)
 	}
 
+	// Connector/J cannot read a PEM CA certificate, so convert the certificates of each database server to a truststore
+	var caVolumeMounts []corev1.VolumeMount
+	for _, database := range databases {
+		if database.dbInfo.IsTlsEnabled() && !containsVolume(volumes, database.caVolumeName) {
+			volumes = append(volumes, database.dbInfo.createCaVolume(database.caVolumeName))
+			caVolumeMounts = append(caVolumeMounts, corev1.VolumeMount{
+				Name:      database.caVolumeName,
+				MountPath: path.Join("/opt/database-ca", database.caVolumeName),
+				ReadOnly:  true,
+			})
+		}
+	}
+	if len(caVolumeMounts) > 0 {
+		volumes = append(volumes, corev1.Volume{
+			Name: DatabaseTruststoreVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      DatabaseTruststoreVolumeName,
+			MountPath: DatabaseTruststoreMountPath,
+			ReadOnly:  true,
+		})
+		initContainers = append(initContainers, corev1.Container{
+			Name:            "generate-database-truststore",
+			Image:           image,
+			ImagePullPolicy: stroomCluster.Spec.ImagePullPolicy,
+			Command: []string{
+				"sh",
+				"-c",
+				"/opt/scripts/generate-db-truststore.sh",
+			},
+			Env: []corev1.EnvVar{{
+				Name:  "DATABASE_TRUSTSTORE_PASSWORD",
+				Value: DatabaseTruststorePassword,
+			}},
+			VolumeMounts: append([]corev1.VolumeMount{{
+				Name:      StaticContentVolumeName,
+				SubPath:   "generate-db-truststore.sh",
+				MountPath: "/opt/scripts/generate-db-truststore.sh",
+				ReadOnly:  true,
+			}, {
+				Name:      DatabaseTruststoreVolumeName,
+				MountPath: "/data",
+			}}, caVolumeMounts...),
+		})
+	}
+
 	containers := []corev1.Container{{
 		Name:            StroomNodeContainerName,
-		Image:           stroomCluster.Spec.Image.String(),
+		Image:           image,
 		ImagePullPolicy: stroomCluster.Spec.ImagePullPolicy,
 		Env:             env,
 		VolumeMounts:    volumeMounts,
@@ -484,21 +610,9 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 			ContainerPort: AdminPortNumber,
 			Protocol:      corev1.ProtocolTCP,
 		}},
-		StartupProbe: &corev1.Probe{
-			ProbeHandler: corev1.ProbeHandler{
-				Exec: &corev1.ExecAction{
-					Command: []string{
-						"bash",
-						"/stroom/scripts/node-start.sh",
-					},
-				},
-			},
-			InitialDelaySeconds: nodeSet.StartupProbeTimings.InitialDelaySeconds,
-			PeriodSeconds:       nodeSet.StartupProbeTimings.PeriodSeconds,
-			TimeoutSeconds:      nodeSet.StartupProbeTimings.TimeoutSeconds,
-			SuccessThreshold:    nodeSet.StartupProbeTimings.SuccessThreshold,
-			FailureThreshold:    nodeSet.StartupProbeTimings.FailureThreshold,
-		},
+		// The node and its jobs are enabled by the operator once the Pod is ready. When the Pod terminates, the
+		// pre-stop hook waits for the operator to drain the node.
+		StartupProbe:   r.createProbe(&nodeSet.StartupProbeTimings, AdminPortName),
 		ReadinessProbe: r.createProbe(&nodeSet.ReadinessProbeTimings, AdminPortName),
 		LivenessProbe:  r.createProbe(&nodeSet.LivenessProbeTimings, AdminPortName),
 		Resources:      nodeSet.Resources,
@@ -518,14 +632,39 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 		containers = append(containers, r.createLogSenderContainer(stroomCluster))
 	}
 
+	// Restart the nodes when their configuration changes, or the passwords of a DatabaseServer are rotated, as they are
+	// read from the environment
+	podAnnotations := map[string]string{}
+	if configHash != "" {
+		podAnnotations[stroomv1.ConfigHashAnnotation] = configHash
+	}
+	for key, value := range nodeSet.PodAnnotations {
+		podAnnotations[key] = value
+	}
+	var rotatedValues []string
+	for _, dbServer := range getDatabaseServers(dbInfo, statsDbInfo) {
+		if rotated := getCredentialsRotatedValue(dbServer); rotated != "" && !slices.Contains(rotatedValues, rotated) {
+			rotatedValues = append(rotatedValues, rotated)
+		}
+	}
+	if len(rotatedValues) > 0 {
+		podAnnotations[stroomv1.CredentialsRotatedAnnotation] = strings.Join(rotatedValues, " ")
+	}
+
+	// Stop all nodes while the database is being restored
+	replicas := nodeSet.Count
+	if stroomCluster.IsRestoreInProgress() {
+		replicas = 0
+	}
+
 	statefulSet := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      stroomCluster.GetNodeSetName(nodeSet),
 			Namespace: stroomCluster.Namespace,
-			Labels:    stroomCluster.GetLabels(),
+			Labels:    r.createNodeSetLabels(stroomCluster, nodeSet),
 		},
 		Spec: appsv1.StatefulSetSpec{
-			Replicas:            &nodeSet.Count,
+			Replicas:            &replicas,
 			PodManagementPolicy: stroomCluster.Spec.PodManagementPolicy,
 			ServiceName:         stroomCluster.GetNodeSetHeadlessServiceName(nodeSet),
 			Selector: &metav1.LabelSelector{
@@ -533,7 +672,7 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Annotations: nodeSet.PodAnnotations,
+					Annotations: podAnnotations,
 					Labels:      stroomCluster.GetNodeSetSelectorLabels(nodeSet),
 				},
 				Spec: corev1.PodSpec{
@@ -551,7 +690,7 @@ func (r *StroomClusterReconciler) createStatefulSet(stroomCluster *stroomv1.Stro
 			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:   StroomNodePvcName,
-					Labels: r.createNodeSetPvcLabels(stroomCluster, nodeSet),
+					Labels: r.createNodeSetLabels(stroomCluster, nodeSet),
 				},
 				Spec: nodeSet.LocalDataVolumeClaim,
 			}},
@@ -643,24 +782,24 @@ func (r *StroomClusterReconciler) createLogSenderContainer(stroomCluster *stroom
 	}
 }
 
-func (r *StroomClusterReconciler) appendConfigVolumeMounts(stroomCluster *stroomv1.StroomCluster, volumeMounts *[]corev1.VolumeMount) {
-	// If a Stroom node config override is provided, mount the existing ConfigMap
-	const configMountPath = "/stroom/config/config.yml"
+// createConfigVolumeMount mounts the Stroom node config at the specified path. If a Stroom node config override is
+// provided, the existing ConfigMap is mounted, otherwise the default config.
+func (r *StroomClusterReconciler) createConfigVolumeMount(stroomCluster *stroomv1.StroomCluster, mountPath string) corev1.VolumeMount {
 	if !stroomCluster.Spec.ConfigMapRef.IsZero() {
-		*volumeMounts = append(*volumeMounts, corev1.VolumeMount{
+		return corev1.VolumeMount{
 			Name:      "config-override",
 			SubPath:   stroomCluster.Spec.ConfigMapRef.ItemName,
-			MountPath: configMountPath,
-			ReadOnly:  true,
-		})
-	} else {
-		// Use the default config
-		*volumeMounts = append(*volumeMounts, corev1.VolumeMount{
-			Name:      StaticContentVolumeName,
-			SubPath:   "stroomcluster-config.yaml",
-			MountPath: configMountPath,
+			MountPath: mountPath,
 			ReadOnly:  true,
-		})
+		}
+	}
+
+	// Use the default config
+	return corev1.VolumeMount{
+		Name:      StaticContentVolumeName,
+		SubPath:   "stroomcluster-config.yaml",
+		MountPath: mountPath,
+		ReadOnly:  true,
 	}
 }
 
@@ -728,7 +867,7 @@ func (r *StroomClusterReconciler) createService(stroomCluster *stroomv1.StroomCl
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: stroomCluster.Namespace,
-			Labels:    stroomCluster.GetLabels(),
+			Labels:    r.createNodeSetLabels(stroomCluster, nodeSet),
 		},
 		Spec: corev1.ServiceSpec{
 			Type:      corev1.ServiceTypeClusterIP,
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	common "github.com/gradata-systems/stroom-k8s-operator/internal/controller/common"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// getConfigSecretNames returns the names of the Secrets mounted by Stroom nodes, or read into their environment.
+// Database passwords are excluded, as nodes are restarted when they are rotated.
+func getConfigSecretNames(stroomCluster *stroomv1.StroomCluster) []string {
+	var secretNames []string
+	if https := stroomCluster.Spec.Https; !https.IsZero() {
+		secretNames = append(secretNames, https.TlsSecretName, https.TlsKeystorePasswordSecretRef.SecretName)
+	}
+	if logSender := stroomCluster.Spec.LogSender; !logSender.IsZero() && !logSender.Tls.IsZero() {
+		secretNames = append(secretNames, logSender.Tls.SecretName)
+	}
+	if openIdConfig := stroomCluster.Spec.OpenId; !openIdConfig.IsZero() {
+		secretNames = append(secretNames, openIdConfig.ClientSecret.SecretName)
+	}
+	slices.Sort(secretNames)
+	return slices.Compact(secretNames)
+}
+
+// getConfigHash returns a digest of the configuration used by Stroom nodes: the static files, the config override
+// ConfigMap, the log sender ConfigMap and the referenced Secrets. Returns an empty string if the StroomCluster opts out
+// of rolling out configuration changes. Missing ConfigMaps and Secrets are omitted, so Pods are restarted once they
+// are created.
+func (r *StroomClusterReconciler) getConfigHash(ctx context.Context, stroomCluster *stroomv1.StroomCluster, staticFileData map[string]string) (string, error) {
+	if !stroomCluster.Spec.RolloutOnConfigChange {
+		return "", nil
+	}
+
+	configData := make(map[string]string)
+	for key, value := range staticFileData {
+		configData["static/"+key] = value
+	}
+
+	if configMapRef := stroomCluster.Spec.ConfigMapRef; !configMapRef.IsZero() {
+		configMap := corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: stroomCluster.Namespace, Name: configMapRef.Name}, &configMap); err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+		for key, value := range configMap.Data {
+			configData["configMapRef/"+key] = value
+		}
+		for key, value := range configMap.BinaryData {
+			configData["configMapRef/"+key] = string(value)
+		}
+	}
+
+	if logSender := stroomCluster.Spec.LogSender; !logSender.IsZero() {
+		for key, value := range r.createLogSenderConfigMap(stroomCluster).Data {
+			configData["logSender/"+key] = value
+		}
+	}
+
+	for _, secretName := range getConfigSecretNames(stroomCluster) {
+		secret := corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: stroomCluster.Namespace, Name: secretName}, &secret); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+		for key, value := range secret.Data {
+			configData["secret/"+secretName+"/"+key] = string(value)
+		}
+	}
+
+	return common.HashConfigData(configData), nil
+}
+
+// mapConfigToStroomClusters enqueues each StroomCluster referencing a ConfigMap or Secret, so its nodes are restarted
+// when the configuration changes
+func (r *StroomClusterReconciler) mapConfigToStroomClusters(ctx context.Context, object client.Object) []reconcile.Request {
+	stroomClusters := stroomv1.StroomClusterList{}
+	if err := r.List(ctx, &stroomClusters, client.InNamespace(object.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Could not list StroomClusters")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, stroomCluster := range stroomClusters.Items {
+		var referenced bool
+		switch object.(type) {
+		case *corev1.ConfigMap:
+			referenced = stroomCluster.Spec.ConfigMapRef.Name == object.GetName()
+		case *corev1.Secret:
+			referenced = slices.Contains(getConfigSecretNames(&stroomCluster), object.GetName())
+		}
+		if referenced && stroomCluster.Spec.RolloutOnConfigChange {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.Name},
+			})
+		}
+	}
+	return requests
+}
@@ -21,17 +21,24 @@ import (
 	"embed"
 	"fmt"
 	"path"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
-	common "github.com/gradata-systems/stroom-k8s-operator/internal/controller/common"
+	"github.com/gradata-systems/stroom-k8s-operator/internal/controller/stroomapi"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -47,6 +54,12 @@ type StroomClusterReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Log    logr.Logger
+
+	apiClients      map[types.NamespacedName]*stroomapi.Client
+	apiClientsMutex sync.Mutex
+
+	databaseChecks      map[types.NamespacedName]time.Time
+	databaseChecksMutex sync.Mutex
 }
 
 //go:embed static_content
@@ -57,13 +70,14 @@ var StaticFiles embed.FS
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=stroomclusters/finalizers,verbs=update
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databaseservers,verbs=get;list;watch;update
 //+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databaseservers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=stroom.gchq.github.io,resources=databasebackups,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 
@@ -87,30 +101,42 @@ func (r *StroomClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
-	// Retrieve app database connection info
-	dbServerRef := stroomCluster.Spec.DatabaseServerRef
+	// Retrieve app and statistics database connection info
 	dbInfo := DatabaseConnectionInfo{}
-	if err := GetDatabaseConnectionInfo(r.Client, ctx, &dbServerRef, stroomCluster.Namespace, &dbInfo); err != nil {
-		logger.Info(fmt.Sprintf("DatabaseServer '%v' could not be found", dbServerRef.ServerRef))
+	statsDbInfo := DatabaseConnectionInfo{}
+	if err := GetStroomDatabaseConnectionInfo(r.Client, ctx, &stroomCluster, &dbInfo, &statsDbInfo); err != nil {
+		logger.Info("DatabaseServer could not be found", "Error", err.Error())
+		r.setCondition(&stroomCluster, stroomv1.DatabaseReadyCondition, metav1.ConditionFalse, "DatabaseServerNotFound", err.Error())
+		_ = r.updateStatus(ctx, &stroomCluster)
 		// Try to find the database server again in 10 seconds
 		return ctrl.Result{RequeueAfter: time.Second * 10}, err
-	} else if dbInfo.DatabaseServer != nil {
-		if err := r.claimDatabaseServer(ctx, &stroomCluster, dbServerRef.ServerRef, dbInfo.DatabaseServer); err != nil {
+	}
+	for _, dbServer := range getDatabaseServers(&dbInfo, &statsDbInfo) {
+		if err := r.claimDatabaseServer(ctx, &stroomCluster, dbServer, &dbInfo, &statsDbInfo); err != nil {
+			r.setCondition(&stroomCluster, stroomv1.DatabaseReadyCondition, metav1.ConditionFalse, "DatabaseServerClaimFailed", err.Error())
+			_ = r.updateStatus(ctx, &stroomCluster)
 			return ctrl.Result{}, err
 		}
 	}
 
 	// If StroomCluster is deleted or an error occurs when adding a finalizer, do not proceed with child item creation
 	var requeue, clusterDeleted bool
-	if err := r.checkIfDeleted(ctx, &stroomCluster, &dbInfo, &requeue, &clusterDeleted); err != nil {
+	if err := r.checkIfDeleted(ctx, &stroomCluster, &dbInfo, &statsDbInfo, &requeue, &clusterDeleted); err != nil {
 		return ctrl.Result{}, err
 	} else if requeue {
 		// Waiting for Stroom task completion, so check again in a minute
+		_ = r.updateStatus(ctx, &stroomCluster)
 		return ctrl.Result{RequeueAfter: time.Minute}, nil
 	} else if clusterDeleted {
 		return ctrl.Result{}, err
 	}
 
+	// Check that the app and statistics databases accept connections. Child objects are reconciled regardless, as
+	// Stroom nodes wait for the database to become available during startup.
+	if r.startDatabaseCheck(&stroomCluster) {
+		r.checkDatabaseConnections(ctx, &stroomCluster, &dbInfo, &statsDbInfo)
+	}
+
 	// Create child objects
 
 	existingServiceAccount := corev1.ServiceAccount{}
@@ -130,12 +156,12 @@ func (r *StroomClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	allFileData := make(map[string]string)
 	if files, err := StaticFiles.ReadDir("static_content"); err != nil {
 		logger.Error(err, "Could not read static files to populate ConfigMap", "StroomCluster", stroomCluster.Name)
-		return ctrl.Result{}, err
+		return r.setConfigNotReady(ctx, &stroomCluster, err)
 	} else {
 		for _, file := range files {
 			if data, err := StaticFiles.ReadFile(path.Join("static_content", file.Name())); err != nil {
 				logger.Error(err, "Could not read static file", "Filename", file.Name())
-				return ctrl.Result{}, err
+				return r.setConfigNotReady(ctx, &stroomCluster, err)
 			} else {
 				allFileData[file.Name()] = string(data)
 			}
@@ -156,7 +182,7 @@ func (r *StroomClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return nil
 	})
 	if err != nil {
-		return ctrl.Result{}, err
+		return r.setConfigNotReady(ctx, &stroomCluster, err)
 	}
 	logger.Info("Static content ConfigMap reconciled", "Result", operationResult, "Namespace", existingConfigMap.Namespace, "Name", existingConfigMap.Name)
 
@@ -178,15 +204,56 @@ func (r *StroomClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			return nil
 		})
 		if err != nil {
-			return ctrl.Result{}, err
+			return r.setConfigNotReady(ctx, &stroomCluster, err)
 		}
 		logger.Info("Log sender ConfigMap reconciled", "Result", operationResult, "Namespace", existingConfigMap.Namespace, "Name", existingConfigMap.Name)
 	}
 
+	// Stamp a digest of the configuration on each Pod template, so nodes are restarted when it changes
+	configHash, err := r.getConfigHash(ctx, &stroomCluster, allFileData)
+	if err != nil {
+		logger.Error(err, "Could not compute the Stroom configuration hash", "StroomCluster", stroomCluster.Name)
+		return r.setConfigNotReady(ctx, &stroomCluster, err)
+	}
+	r.setCondition(&stroomCluster, stroomv1.ConfigReadyCondition, metav1.ConditionTrue, "Reconciled", "Stroom configuration ConfigMaps are up to date")
+
+	// Determine whether the Stroom image has changed and if so, which NodeSets are to be upgraded. Upgrades are paused
+	// while a database restore has the cluster scaled down.
+	upgradeResult := ctrl.Result{}
+	if !stroomCluster.IsRestoreInProgress() {
+		if upgradeResult, err = r.reconcileUpgrade(ctx, &stroomCluster); err != nil {
+			_ = r.updateStatus(ctx, &stroomCluster)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Drain the nodes of Pods that are terminating, so their pre-stop hooks can complete
+	terminatingNodes, err := r.drainTerminatingNodes(ctx, &stroomCluster)
+	if err != nil {
+		logger.Info("Terminating Stroom nodes could not be drained", "Error", err.Error())
+	}
+
 	// Query the StroomCluster StatefulSet and if it doesn't exist, create it
+	nodeSetStatuses := make([]stroomv1.NodeSetStatus, 0, len(stroomCluster.Spec.NodeSets))
+	nodesPendingEnable := false
+	var scalingDown, rollingOut []string
 	for _, nodeSet := range stroomCluster.Spec.NodeSets {
 		// Create a StatefulSet representing the NodeSet's nodes
-		newStatefulSet := r.createStatefulSet(&stroomCluster, &nodeSet, &dbInfo)
+		newStatefulSet := r.createStatefulSet(&stroomCluster, &nodeSet, &dbInfo, &statsDbInfo, getNodeSetImage(&stroomCluster, &nodeSet), configHash)
+
+		// If the NodeSet is being scaled down, drain the nodes being removed first
+		scaleDownStatus, err := r.reconcileScaleDown(ctx, &stroomCluster, &nodeSet, newStatefulSet)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// If the Pod template has changed, drain each node before its Pod is replaced
+		rollingUpdateStatus, err := r.reconcileRollingUpdate(ctx, &stroomCluster, &nodeSet, newStatefulSet)
+		if err != nil {
+			return ctrl.Result{}, err
+		} else if rollingUpdateStatus != "" {
+			rollingOut = append(rollingOut, fmt.Sprintf("%v (%v)", nodeSet.Name, rollingUpdateStatus))
+		}
 		existingStatefulSet := appsv1.StatefulSet{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      newStatefulSet.Name,
@@ -203,10 +270,25 @@ func (r *StroomClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			return nil
 		})
 		if err != nil {
+			r.setCondition(&stroomCluster, stroomv1.NodeSetsReadyCondition, metav1.ConditionFalse, "ReconcileFailed",
+				fmt.Sprintf("StatefulSet for NodeSet '%v' could not be reconciled: %v", nodeSet.Name, err))
+			_ = r.updateStatus(ctx, &stroomCluster)
 			return ctrl.Result{}, err
 		}
 		logger.Info("StatefulSet reconciled", "Result", operationResult, "Namespace", existingStatefulSet.Namespace, "Name", existingStatefulSet.Name)
-		if operationResult == controllerutil.OperationResultUpdated {
+		nodeSetStatus := newNodeSetStatus(&nodeSet, &existingStatefulSet)
+		if scaleDownStatus != nil {
+			nodeSetStatus.ScaleDown = scaleDownStatus
+			scalingDown = append(scalingDown, fmt.Sprintf("%v (%v)", nodeSet.Name, scaleDownStatus.Message))
+		}
+		nodeSetStatuses = append(nodeSetStatuses, nodeSetStatus)
+
+		// Enable the Stroom nodes that have started since the last reconcile
+		if err := r.enableStroomNodes(ctx, &stroomCluster, &nodeSet); err != nil {
+			logger.Info("Stroom nodes could not be enabled", "NodeSet", nodeSet.Name, "Error", err.Error())
+			nodesPendingEnable = true
+		}
+		if operationResult == controllerutil.OperationResultUpdated && !stroomCluster.IsRestoreInProgress() {
 			// StatefulSet may have been scaled down, so delete excess PVCs, depending on deletion policy
 			if err := r.deletePvcs(ctx, &stroomCluster, &nodeSet, oldReplicaCount, *newStatefulSet.Spec.Replicas); err != nil {
 				return ctrl.Result{}, err
@@ -255,8 +337,39 @@ func (r *StroomClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 		logger.Info("ClusterIP service reconciled", "Result", operationResult, "Namespace", existingService.Namespace, "Name", existingService.Name)
 	}
+	r.setNodeSetStatus(&stroomCluster, nodeSetStatuses)
+
+	// Drain and delete the NodeSets removed from the spec
+	removedNodeSets, err := r.reconcileRemovedNodeSets(ctx, &stroomCluster)
+	if err != nil {
+		_ = r.updateStatus(ctx, &stroomCluster)
+		return ctrl.Result{}, err
+	}
+	stroomCluster.Status.RemovedNodeSets = removedNodeSets
+	for _, nodeSetStatus := range removedNodeSets {
+		scalingDown = append(scalingDown, fmt.Sprintf("%v (removed: %v)", nodeSetStatus.Name, nodeSetStatus.ScaleDown.Message))
+	}
+	if len(scalingDown) > 0 {
+		r.setCondition(&stroomCluster, stroomv1.DrainingCondition, metav1.ConditionTrue, "ScalingDown",
+			fmt.Sprintf("Draining nodes before scaling down NodeSets: %v", strings.Join(scalingDown, ", ")))
+	} else if len(rollingOut) > 0 {
+		r.setCondition(&stroomCluster, stroomv1.DrainingCondition, metav1.ConditionTrue, "RollingUpdate",
+			fmt.Sprintf("Draining nodes before replacing their Pods: %v", strings.Join(rollingOut, ", ")))
+	} else if len(terminatingNodes) > 0 {
+		r.setCondition(&stroomCluster, stroomv1.DrainingCondition, metav1.ConditionTrue, "PodsTerminating",
+			fmt.Sprintf("Draining nodes before their Pods terminate: %v", strings.Join(terminatingNodes, ", ")))
+	} else {
+		r.setCondition(&stroomCluster, stroomv1.DrainingCondition, metav1.ConditionFalse, "NotDraining", "Stroom nodes are not being drained")
+	}
+
+	// Decommission Stroom nodes that have been removed from the cluster
+	decommissionAfter, err := r.reconcileDepartedNodes(ctx, &stroomCluster, &dbInfo)
+	if err != nil {
+		logger.Info("Departed Stroom nodes could not be decommissioned", "StroomCluster", stroomCluster.Name, "Error", err.Error())
+	}
 
 	ingresses := r.createIngresses(ctx, &stroomCluster)
+	ingressesPendingAddress := 0
 	for _, newIngress := range ingresses {
 		// Create or update an Ingress resource
 		existingIngress := v1.Ingress{
@@ -273,12 +386,49 @@ func (r *StroomClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			return nil
 		})
 		if err != nil {
+			r.setCondition(&stroomCluster, stroomv1.IngressReadyCondition, metav1.ConditionFalse, "ReconcileFailed",
+				fmt.Sprintf("Ingress '%v' could not be reconciled: %v", newIngress.Name, err))
+			_ = r.updateStatus(ctx, &stroomCluster)
 			return ctrl.Result{}, err
 		}
 		logger.Info("Ingress reconciled", "Result", operationResult, "Namespace", existingIngress.Namespace, "Name", existingIngress.Name)
+		if len(existingIngress.Status.LoadBalancer.Ingress) == 0 {
+			ingressesPendingAddress++
+		}
+	}
+	if ingressesPendingAddress > 0 {
+		r.setCondition(&stroomCluster, stroomv1.IngressReadyCondition, metav1.ConditionTrue, "AddressPending",
+			fmt.Sprintf("%v Ingresses reconciled, %v awaiting a load balancer address", len(ingresses), ingressesPendingAddress))
+	} else {
+		r.setCondition(&stroomCluster, stroomv1.IngressReadyCondition, metav1.ConditionTrue, "Reconciled",
+			fmt.Sprintf("%v Ingresses reconciled", len(ingresses)))
 	}
 
-	return ctrl.Result{}, nil
+	if err := r.updateStatus(ctx, &stroomCluster); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if (len(rollingOut) > 0 || len(terminatingNodes) > 0) && upgradeResult.IsZero() {
+		// Count the remaining tasks of the nodes being drained, or release the next Pod
+		return ctrl.Result{RequeueAfter: RollingUpdatePollInterval}, nil
+	} else if len(scalingDown) > 0 && upgradeResult.IsZero() {
+		// Count the remaining tasks of the draining nodes again
+		return ctrl.Result{RequeueAfter: ScaleDownPollInterval}, nil
+	} else if nodesPendingEnable && upgradeResult.IsZero() {
+		// Try to enable the nodes again shortly
+		return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+	} else if decommissionAfter > 0 && upgradeResult.IsZero() {
+		// Decommission departed nodes once their grace period has elapsed
+		return ctrl.Result{RequeueAfter: decommissionAfter}, nil
+	}
+	return upgradeResult, nil
+}
+
+// setConfigNotReady records a failure to reconcile the Stroom configuration and returns the error to the caller
+func (r *StroomClusterReconciler) setConfigNotReady(ctx context.Context, stroomCluster *stroomv1.StroomCluster, err error) (ctrl.Result, error) {
+	r.setCondition(stroomCluster, stroomv1.ConfigReadyCondition, metav1.ConditionFalse, "ReconcileFailed", err.Error())
+	_ = r.updateStatus(ctx, stroomCluster)
+	return ctrl.Result{}, err
 }
 
 func (r *StroomClusterReconciler) deletePvcs(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, oldReplicaCount int32, newReplicaCount int32) error {
@@ -310,7 +460,7 @@ func (r *StroomClusterReconciler) deletePvcs(ctx context.Context, stroomCluster
 }
 
 // checkIfDeleted returns whether the object is being deleted and if any error occurred during finalisation
-func (r *StroomClusterReconciler) checkIfDeleted(ctx context.Context, stroomCluster *stroomv1.StroomCluster, appDatabase *DatabaseConnectionInfo, requeue *bool, clusterDeleted *bool) error {
+func (r *StroomClusterReconciler) checkIfDeleted(ctx context.Context, stroomCluster *stroomv1.StroomCluster, appDatabase *DatabaseConnectionInfo, statsDatabase *DatabaseConnectionInfo, requeue *bool, clusterDeleted *bool) error {
 	logger := log.FromContext(ctx)
 
 	*clusterDeleted = false
@@ -319,8 +469,8 @@ func (r *StroomClusterReconciler) checkIfDeleted(ctx context.Context, stroomClus
 	if !stroomCluster.IsBeingDeleted() {
 		// Add finalizers to database server objects to prevent them from being removed while the StroomCluster
 		// still exists
-		if appDatabase.DatabaseServer != nil {
-			if err := r.addFinalizer(ctx, appDatabase.DatabaseServer, stroomv1.StroomClusterFinalizerName); err != nil {
+		for _, dbServer := range getDatabaseServers(appDatabase, statsDatabase) {
+			if err := r.addFinalizer(ctx, dbServer, stroomv1.StroomClusterFinalizerName); err != nil {
 				return err
 			}
 		}
@@ -348,7 +498,7 @@ func (r *StroomClusterReconciler) checkIfDeleted(ctx context.Context, stroomClus
 			// One or more Stroom nodes are deployed, so perform graceful shutdown
 
 			// Disable node task processing, allowing nodes to drain
-			if err := r.disableTaskProcessing(ctx, stroomCluster, appDatabase); err != nil {
+			if err := r.disableTaskProcessing(ctx, stroomCluster); err != nil {
 				return err
 			} else {
 				logger.Info("Task processing disabled, nodes draining", "StroomCluster", stroomCluster.Name)
@@ -356,32 +506,39 @@ func (r *StroomClusterReconciler) checkIfDeleted(ctx context.Context, stroomClus
 
 			// Check whether there are any active Stroom node tasks. Only allow deletion once they are completed.
 			remainingTasks := make(map[string]int)
-			if err := r.countRemainingTasks(ctx, stroomCluster, appDatabase, remainingTasks); err != nil {
+			if err := r.countRemainingTasks(ctx, stroomCluster, remainingTasks); err != nil {
 				*requeue = true
 				return err
 			} else if len(remainingTasks) > 0 {
+				recordRemainingTasks(stroomCluster, remainingTasks)
 				// Requeue so we can check again after some time, to allow node server tasks to finish
 				remainingTaskSummary := fmt.Sprintf("StroomCluster deletion waiting on task completion for %v nodes: ", len(remainingTasks))
 				for nodeName, taskCount := range remainingTasks {
 					remainingTaskSummary += fmt.Sprintf("%v (%v) ", nodeName, taskCount)
 				}
 				logger.Info(remainingTaskSummary, "StroomCluster", stroomCluster.Name)
+				r.setCondition(stroomCluster, stroomv1.DrainingCondition, metav1.ConditionTrue, "WaitingForTasks", remainingTaskSummary)
 				*requeue = true
 				return nil
 			} else {
-				// All tasks drained, so allow deletion by removing the finalizer
+				// All tasks drained, so allow deletion by removing the finalizer. The nodes need not drain again
+				// when their Pods are deleted.
 				logger.Info("All tasks drained, deletion commencing", "StroomCluster", stroomCluster.Name)
+				recordDrainCompleted(stroomCluster, time.Now())
+				if err := r.setNodesDrained(ctx, stroomCluster, nil); err != nil {
+					return err
+				}
 				if err := r.removeFinalizer(ctx, stroomCluster, stroomv1.WaitNodeTasksFinalizerName); err != nil {
 					return err
 				}
 			}
 		}
 
-		// Remove finalizer from the linked DatabaseServers
-		if appDatabase.DatabaseServer != nil {
-			if err := r.removeFinalizer(ctx, appDatabase.DatabaseServer, stroomv1.StroomClusterFinalizerName); err != nil {
+		// Release the claims on the linked DatabaseServers
+		for _, dbServer := range getDatabaseServers(appDatabase, statsDatabase) {
+			if err := r.releaseDatabaseServer(ctx, stroomCluster, dbServer); err != nil {
 				logger.Error(err, "Finalizer could not be removed from DatabaseServer",
-					"Namespace", appDatabase.DatabaseServer.Namespace, "Name", appDatabase.DatabaseServer.Name)
+					"Namespace", dbServer.Namespace, "Name", dbServer.Name)
 				return err
 			}
 		}
@@ -389,6 +546,8 @@ func (r *StroomClusterReconciler) checkIfDeleted(ctx context.Context, stroomClus
 		logger.Info("StroomCluster deleted", "Namespace", stroomCluster.Namespace, "Name", stroomCluster.Name)
 
 		r.cleanup(ctx, stroomCluster)
+		r.releaseStroomApiClient(stroomCluster)
+		r.releaseDatabaseCheck(stroomCluster)
 		return nil
 	}
 
@@ -420,62 +579,6 @@ func (r *StroomClusterReconciler) removeFinalizer(ctx context.Context, obj clien
 	return nil
 }
 
-// disableTaskProcessing disables Stroom nodes tasks prior to deleting the StroomCluster. This allows all nodes to drain.
-func (r *StroomClusterReconciler) disableTaskProcessing(ctx context.Context, stroomCluster *stroomv1.StroomCluster, dbInfo *DatabaseConnectionInfo) error {
-	logger := log.FromContext(ctx)
-
-	if db, err := OpenDatabase(r, ctx, dbInfo, stroomCluster.Namespace, stroomCluster.Spec.AppDatabaseName); err != nil {
-		return err
-	} else {
-		defer CloseDatabase(db)
-
-		if _, err := db.Exec("update job_node set enabled = 0 where node_name like ?", stroomCluster.GetBaseName()+"%"); err != nil {
-			logger.Error(err, "Failed to disable Stroom node task processing", "StroomCluster", stroomCluster.Name)
-			return err
-		}
-	}
-
-	return nil
-}
-
-// countRemainingTasks removes the finalizer from StroomCluster pods that have no active Stroom tasks.
-// Returns whether tasks are still running on any node.
-func (r *StroomClusterReconciler) countRemainingTasks(ctx context.Context, stroomCluster *stroomv1.StroomCluster, dbInfo *DatabaseConnectionInfo, remainingTasks map[string]int) error {
-	logger := log.FromContext(ctx)
-
-	// Get the current active server tasks
-	if db, err := OpenDatabase(r, ctx, dbInfo, stroomCluster.Namespace, stroomCluster.Spec.AppDatabaseName); err != nil {
-		return err
-	} else {
-		defer CloseDatabase(db)
-
-		// Get a summary of active tasks by node
-		rows, err := db.Query("select n.name as node_name, count(*) as task_count "+
-			"from processor_task pt inner join node n on n.id = pt.fk_processor_node_id "+
-			"where pt.status = ? "+
-			"group by n.name", common.NodeTaskStatusProcessing)
-
-		if err != nil {
-			logger.Error(err, fmt.Sprintf("Failed to query the active Stroom processor tasks for cluster '%v'", stroomCluster.Name))
-			return err
-		}
-
-		// For each pod in the StroomCluster determine whether any active Stroom tasks are running
-		var nodeName string
-		var taskCount int
-		for rows.Next() {
-			if err := rows.Scan(&nodeName, &taskCount); err != nil {
-				logger.Error(err, fmt.Sprintf("Could not parse node name and task count"))
-				return err
-			} else if taskCount > 0 {
-				remainingTasks[nodeName] = taskCount
-			}
-		}
-	}
-
-	return nil
-}
-
 // cleanup performs post-deletion actions like removing Ingress resources created by the operator
 func (r *StroomClusterReconciler) cleanup(ctx context.Context, stroomCluster *stroomv1.StroomCluster) {
 	logger := log.FromContext(ctx)
@@ -537,12 +640,23 @@ func (r *StroomClusterReconciler) getOrCreateObject(ctx context.Context, name st
 	return ctrl.Result{}, nil
 }
 
-func (r *StroomClusterReconciler) claimDatabaseServer(ctx context.Context, stroomCluster *stroomv1.StroomCluster, dbRef stroomv1.ResourceRef, db *stroomv1.DatabaseServer) error {
+// claimDatabaseServer registers the StroomCluster with a DatabaseServer, so the DatabaseServer is not deleted while
+// the StroomCluster exists. Unless it is multi-tenant, a DatabaseServer may only be claimed by one StroomCluster.
+func (r *StroomClusterReconciler) claimDatabaseServer(ctx context.Context, stroomCluster *stroomv1.StroomCluster, db *stroomv1.DatabaseServer, appDatabase *DatabaseConnectionInfo, statsDatabase *DatabaseConnectionInfo) error {
 	logger := log.FromContext(ctx)
 
+	if db.Spec.MultiTenant {
+		return r.claimTenantDatabaseServer(ctx, stroomCluster, db, newDatabaseServerClaim(stroomCluster, db, appDatabase, statsDatabase))
+	}
+	clusterRef := stroomv1.ResourceRef{Name: stroomCluster.Name, Namespace: stroomCluster.Namespace}
+
+	// Earlier versions of the operator recorded a reference to the DatabaseServer itself, rather than the StroomCluster
+	// claiming it. Such claims are replaced.
+	legacyClaim := db.StroomClusterRef.Name == db.Name && db.StroomClusterRef.Namespace == db.Namespace
+
 	// If DatabaseServer is claimed by a StroomCluster, check whether it is the current cluster
-	if !db.StroomClusterRef.IsZero() {
-		if db.StroomClusterRef.Name == stroomCluster.Name && db.StroomClusterRef.Namespace == stroomCluster.Namespace {
+	if !db.StroomClusterRef.IsZero() && !legacyClaim {
+		if db.StroomClusterRef == clusterRef {
 			// Already claimed by this cluster
 			return nil
 		}
@@ -554,10 +668,10 @@ func (r *StroomClusterReconciler) claimDatabaseServer(ctx context.Context, stroo
 		return err
 	} else {
 		// Register the StroomCluster with the DatabaseServer
-		db.StroomClusterRef = dbRef
+		db.StroomClusterRef = clusterRef
 		err := r.Update(ctx, db)
 		if err != nil {
-			logger.Error(err, fmt.Sprintf("Could not claim the DatabaseServer '%v' by StroomCluster '%v/%v'", dbRef, stroomCluster.Namespace, stroomCluster.Name))
+			logger.Error(err, fmt.Sprintf("Could not claim the DatabaseServer '%v/%v' by StroomCluster '%v/%v'", db.Namespace, db.Name, stroomCluster.Namespace, stroomCluster.Name))
 			return err
 		}
 	}
@@ -565,10 +679,68 @@ func (r *StroomClusterReconciler) claimDatabaseServer(ctx context.Context, stroo
 	return nil
 }
 
+// getDatabaseServers returns the distinct operator-managed DatabaseServers hosting the app and statistics databases
+func getDatabaseServers(appDatabase *DatabaseConnectionInfo, statsDatabase *DatabaseConnectionInfo) []*stroomv1.DatabaseServer {
+	var dbServers []*stroomv1.DatabaseServer
+	if appDatabase.DatabaseServer != nil {
+		dbServers = append(dbServers, appDatabase.DatabaseServer)
+	}
+	if statsDb := statsDatabase.DatabaseServer; statsDb != nil && (appDatabase.DatabaseServer == nil || !isDatabaseServer(statsDb, appDatabase.DatabaseServer)) {
+		dbServers = append(dbServers, statsDb)
+	}
+	return dbServers
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *StroomClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&stroomv1.StroomCluster{}).
 		Owns(&appsv1.StatefulSet{}).
-		Complete(r)
+		Owns(&batchv1.Job{}).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(mapPodToStroomCluster), builder.WithPredicates(podTerminatingPredicate)).
+		Watches(&stroomv1.DatabaseServer{}, handler.EnqueueRequestsFromMapFunc(r.mapDatabaseServerToStroomClusters)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigToStroomClusters)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigToStroomClusters)).
+		Complete(instrumentReconciler("StroomCluster", r))
+}
+
+// podTerminatingPredicate selects Pods that have started terminating, so their nodes are drained without waiting for
+// the next reconcile
+var podTerminatingPredicate = predicate.Funcs{
+	CreateFunc: func(event.CreateEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return e.ObjectOld.GetDeletionTimestamp() == nil && e.ObjectNew.GetDeletionTimestamp() != nil
+	},
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+}
+
+// mapPodToStroomCluster enqueues the StroomCluster running a Stroom node Pod
+func mapPodToStroomCluster(_ context.Context, pod client.Object) []reconcile.Request {
+	name, ok := pod.GetLabels()[stroomv1.StroomClusterLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: pod.GetNamespace(), Name: name}}}
+}
+
+// mapDatabaseServerToStroomClusters enqueues each StroomCluster using a DatabaseServer, so its nodes are restarted
+// when the database passwords are rotated
+func (r *StroomClusterReconciler) mapDatabaseServerToStroomClusters(ctx context.Context, dbServer client.Object) []reconcile.Request {
+	stroomClusters := stroomv1.StroomClusterList{}
+	if err := r.List(ctx, &stroomClusters); err != nil {
+		log.FromContext(ctx).Error(err, "Could not list StroomClusters")
+		return nil
+	}
+
+	dbServerRef := stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: dbServer.GetName()}}
+	var requests []reconcile.Request
+	for _, stroomCluster := range stroomClusters.Items {
+		if usesDatabaseServer(&stroomCluster, &dbServerRef, dbServer.GetNamespace()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.Name},
+			})
+		}
+	}
+	return requests
 }
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// isClusterNodeName returns whether a Stroom node name follows the naming convention of the StroomCluster's nodes:
+// <cluster base name>-node-<NodeSet name>-<ordinal>
+func isClusterNodeName(stroomCluster *stroomv1.StroomCluster, nodeName string) bool {
+	prefix := stroomCluster.GetBaseName() + "-node-"
+	index := strings.LastIndex(nodeName, "-")
+	if !strings.HasPrefix(nodeName, prefix) || index < len(prefix)+1 {
+		return false
+	}
+	_, err := strconv.ParseUint(nodeName[index+1:], 10, 32)
+	return err == nil
+}
+
+// getDepartedNodes returns the names of the Stroom nodes that are neither running in a Pod, nor part of a NodeSet.
+// The time each node departed is carried over from the previous status, or is set to now.
+func getDepartedNodes(stroomCluster *stroomv1.StroomCluster, nodeNames []string, podNames []string, now metav1.Time) []stroomv1.DepartedNode {
+	var departedNodes []stroomv1.DepartedNode
+	for _, nodeName := range nodeNames {
+		if !isClusterNodeName(stroomCluster, nodeName) || slices.Contains(podNames, nodeName) || slices.Contains(stroomCluster.Status.Nodes, nodeName) {
+			continue
+		}
+
+		departedNode := stroomv1.DepartedNode{Name: nodeName, DepartedTime: now}
+		for _, previous := range stroomCluster.Status.DepartedNodes {
+			if previous.Name == nodeName {
+				departedNode.DepartedTime = previous.DepartedTime
+			}
+		}
+		departedNodes = append(departedNodes, departedNode)
+	}
+	return departedNodes
+}
+
+// reconcileDepartedNodes decommissions Stroom nodes removed from the cluster by a scale-down or NodeSet removal, once
+// the grace period has elapsed. Departed nodes are disabled, so other nodes stop trying to contact them and, if
+// configured, their job assignments are deleted. Returns the time until the next departed node is due to be
+// decommissioned, or zero if there are none.
+func (r *StroomClusterReconciler) reconcileDepartedNodes(ctx context.Context, stroomCluster *stroomv1.StroomCluster, dbInfo *DatabaseConnectionInfo) (time.Duration, error) {
+	logger := log.FromContext(ctx)
+	settings := stroomCluster.Spec.NodeDecommission
+
+	if !settings.Enabled || stroomCluster.IsRestoreInProgress() {
+		stroomCluster.Status.DepartedNodes = nil
+		return 0, nil
+	}
+
+	db, err := OpenDatabase(r, ctx, dbInfo, stroomCluster.Namespace, dbInfo.GetDatabaseName(stroomCluster.Spec.AppDatabaseName))
+	if err != nil {
+		return 0, err
+	}
+	defer CloseDatabase(db)
+
+	// Nodes already decommissioned are disabled and, if purging, have no jobs
+	query := "select n.name from node n where n.name like ? and (n.enabled = 1"
+	if settings.PurgeJobs {
+		query += " or exists (select 1 from job_node jn where jn.node_name = n.name)"
+	}
+	nodeNames, err := queryStrings(ctx, db, query+")", stroomCluster.GetBaseName()+"-node-%")
+	if err != nil {
+		logger.Error(err, "Failed to query Stroom nodes", "StroomCluster", stroomCluster.Name)
+		return 0, err
+	}
+
+	podList := corev1.PodList{}
+	if err := r.List(ctx, &podList, client.InNamespace(stroomCluster.Namespace), client.MatchingLabels(stroomCluster.GetNodeSelectorLabels())); err != nil {
+		return 0, err
+	}
+	podNames := make([]string, 0, len(podList.Items))
+	for _, pod := range podList.Items {
+		podNames = append(podNames, pod.Name)
+	}
+
+	gracePeriod := time.Duration(settings.GracePeriodMins) * time.Minute
+	var pendingNodes []stroomv1.DepartedNode
+	var requeueAfter time.Duration
+	for _, departedNode := range getDepartedNodes(stroomCluster, nodeNames, podNames, metav1.Now()) {
+		if remaining := gracePeriod - time.Since(departedNode.DepartedTime.Time); remaining > 0 {
+			pendingNodes = append(pendingNodes, departedNode)
+			if requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
+
+		if err := r.decommissionNode(ctx, stroomCluster, db, departedNode.Name); err != nil {
+			// Try again on the next reconcile
+			logger.Info("Stroom node could not be decommissioned", "StroomCluster", stroomCluster.Name, "Node", departedNode.Name, "Error", err.Error())
+			pendingNodes = append(pendingNodes, departedNode)
+		}
+	}
+	stroomCluster.Status.DepartedNodes = pendingNodes
+
+	return requeueAfter, nil
+}
+
+// decommissionNode disables a departed Stroom node and, if configured, deletes its job assignments. The node is
+// disabled using the Stroom API, so the change is seen by the running nodes.
+func (r *StroomClusterReconciler) decommissionNode(ctx context.Context, stroomCluster *stroomv1.StroomCluster, db *sql.DB, nodeName string) error {
+	logger := log.FromContext(ctx)
+
+	apiClient, err := r.getStroomApiClient(ctx, stroomCluster)
+	if err != nil {
+		return err
+	}
+	if err := apiClient.SetNodeEnabled(ctx, nodeName, false); err != nil {
+		return err
+	}
+
+	if stroomCluster.Spec.NodeDecommission.PurgeJobs {
+		if _, err := db.ExecContext(ctx, "delete from job_node where node_name = ?", nodeName); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Departed Stroom node decommissioned", "StroomCluster", stroomCluster.Name, "Node", nodeName,
+		"PurgedJobs", stroomCluster.Spec.NodeDecommission.PurgeJobs)
+	return nil
+}
@@ -0,0 +1,369 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	"github.com/gradata-systems/stroom-k8s-operator/internal/controller/stroomapi"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// getManagedJobs lists the jobs enabled when a node starts and disabled before it stops. These are typically node role
+// dependent. Frontend nodes for instance, shouldn't have the `Data Processor` job enabled. An empty list means all jobs.
+func getManagedJobs(nodeSet *stroomv1.NodeSet) []string {
+	if len(nodeSet.ManagedJobs) > 0 {
+		return nodeSet.ManagedJobs
+	} else if nodeSet.Role == stroomv1.FrontendNodeRole {
+		return []string{
+			"Reindex Content",
+		}
+	}
+	return []string{}
+}
+
+// getStroomApiUrl returns the URL of the Stroom API, served by the first NodeSet with any nodes
+func getStroomApiUrl(stroomCluster *stroomv1.StroomCluster) (string, error) {
+	for _, nodeSet := range stroomCluster.Spec.NodeSets {
+		if nodeSet.Count > 0 {
+			return fmt.Sprintf("http://%v.%v.svc.cluster.local:%v/api", stroomCluster.GetNodeSetServiceName(&nodeSet), stroomCluster.Namespace, AppHttpPortNumber), nil
+		}
+	}
+	return "", fmt.Errorf("StroomCluster '%v' has no nodes to serve the Stroom API", stroomCluster.Name)
+}
+
+// getStroomApiClient returns a client for the Stroom API of a StroomCluster, authenticating with its OpenID client
+// credentials. Clients are reused between reconciles, so their access tokens are cached until they expire.
+func (r *StroomClusterReconciler) getStroomApiClient(ctx context.Context, stroomCluster *stroomv1.StroomCluster) (*stroomapi.Client, error) {
+	openIdConfig := stroomCluster.Spec.OpenId
+	if openIdConfig.IsZero() {
+		return nil, fmt.Errorf("StroomCluster '%v' has no OpenID client credentials to call the Stroom API", stroomCluster.Name)
+	}
+	baseUrl, err := getStroomApiUrl(stroomCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: stroomCluster.Namespace, Name: openIdConfig.ClientSecret.SecretName}, &secret); err != nil {
+		log.FromContext(ctx).Error(err, "Could not retrieve OpenID client secret", "Namespace", stroomCluster.Namespace, "Name", openIdConfig.ClientSecret.SecretName)
+		return nil, err
+	}
+	clientSecret, exists := secret.Data[openIdConfig.ClientSecret.Key]
+	if !exists {
+		return nil, fmt.Errorf("secret '%v' does not contain the key '%v'", openIdConfig.ClientSecret.SecretName, openIdConfig.ClientSecret.Key)
+	}
+
+	r.apiClientsMutex.Lock()
+	defer r.apiClientsMutex.Unlock()
+
+	key := types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.Name}
+	apiClient := r.apiClients[key]
+	if apiClient == nil || apiClient.BaseUrl != baseUrl || apiClient.ClientId != openIdConfig.ClientId || apiClient.ClientSecret != string(clientSecret) {
+		if r.apiClients == nil {
+			r.apiClients = make(map[types.NamespacedName]*stroomapi.Client)
+		}
+		apiClient = stroomapi.NewClient(baseUrl, openIdConfig.ClientId, string(clientSecret))
+		r.apiClients[key] = apiClient
+	}
+	return apiClient, nil
+}
+
+// releaseStroomApiClient discards the cached Stroom API client of a deleted StroomCluster
+func (r *StroomClusterReconciler) releaseStroomApiClient(stroomCluster *stroomv1.StroomCluster) {
+	r.apiClientsMutex.Lock()
+	defer r.apiClientsMutex.Unlock()
+
+	delete(r.apiClients, types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.Name})
+}
+
+// getReadyNodes lists the Pods matching the specified labels that are ready to serve requests. Each Pod is named
+// after the Stroom node it runs.
+func (r *StroomClusterReconciler) getReadyNodes(ctx context.Context, namespace string, labels map[string]string) ([]corev1.Pod, error) {
+	podList := corev1.PodList{}
+	if err := r.List(ctx, &podList, client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		if pod.DeletionTimestamp == nil && isPodReady(&pod) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// getPodOrdinal returns the StatefulSet ordinal of a Pod, from the suffix of its name
+func getPodOrdinal(pod *corev1.Pod) (int32, bool) {
+	index := strings.LastIndex(pod.Name, "-")
+	if index < 0 {
+		return 0, false
+	}
+	ordinal, err := strconv.ParseInt(pod.Name[index+1:], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(ordinal), true
+}
+
+// getNodeInstance identifies the running instance of the Stroom container of a Pod, which changes each time the
+// container restarts
+func getNodeInstance(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == StroomNodeContainerName {
+			return strconv.Itoa(int(status.RestartCount))
+		}
+	}
+	return ""
+}
+
+// enableStroomNodes enables each ready node of a NodeSet and its managed jobs, once per container instance. The Pod is
+// annotated with the instance once the node is enabled, so a restarted container or replacement Pod is enabled again.
+// Nodes being removed by a scale-down, or drained ahead of a rolling update, are not enabled.
+func (r *StroomClusterReconciler) enableStroomNodes(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet) error {
+	logger := log.FromContext(ctx)
+
+	pods, err := r.getReadyNodes(ctx, stroomCluster.Namespace, stroomCluster.GetNodeSetSelectorLabels(nodeSet))
+	if err != nil {
+		return err
+	}
+
+	var apiClient *stroomapi.Client
+	for _, pod := range pods {
+		instance := getNodeInstance(&pod)
+		if enabledInstance, ok := pod.Annotations[stroomv1.NodeEnabledAnnotation]; ok && enabledInstance == instance {
+			continue
+		} else if _, draining := pod.Annotations[stroomv1.NodeDrainStartedAnnotation]; draining {
+			continue
+		} else if ordinal, ok := getPodOrdinal(&pod); !ok || ordinal >= nodeSet.Count {
+			continue
+		}
+		if apiClient == nil {
+			if apiClient, err = r.getStroomApiClient(ctx, stroomCluster); err != nil {
+				return err
+			}
+		}
+
+		if err := apiClient.SetNodeEnabled(ctx, pod.Name, true); err != nil {
+			logger.Error(err, "Failed to enable Stroom node", "StroomCluster", stroomCluster.Name, "Node", pod.Name)
+			return err
+		}
+		if err := apiClient.SetJobsEnabled(ctx, pod.Name, true, getManagedJobs(nodeSet)); err != nil {
+			logger.Error(err, "Failed to enable Stroom node jobs", "StroomCluster", stroomCluster.Name, "Node", pod.Name)
+			return err
+		}
+
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[stroomv1.NodeEnabledAnnotation] = instance
+		if err := r.Patch(ctx, &pod, patch); err != nil {
+			return err
+		}
+		logger.Info("Stroom node and jobs enabled", "StroomCluster", stroomCluster.Name, "Node", pod.Name)
+	}
+
+	return nil
+}
+
+// disableTaskProcessing disables the jobs of each Stroom node prior to deleting the StroomCluster. This allows all
+// nodes to drain.
+func (r *StroomClusterReconciler) disableTaskProcessing(ctx context.Context, stroomCluster *stroomv1.StroomCluster) error {
+	logger := log.FromContext(ctx)
+
+	pods, err := r.getReadyNodes(ctx, stroomCluster.Namespace, stroomCluster.GetNodeSelectorLabels())
+	if err != nil || len(pods) == 0 {
+		return err
+	}
+	apiClient, err := r.getStroomApiClient(ctx, stroomCluster)
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods {
+		if err := apiClient.SetJobsEnabled(ctx, pod.Name, false, nil); err != nil {
+			logger.Error(err, "Failed to disable Stroom node task processing", "StroomCluster", stroomCluster.Name, "Node", pod.Name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countRemainingTasks records the number of tasks still running on each ready node of the StroomCluster. Nodes with no
+// tasks are omitted.
+func (r *StroomClusterReconciler) countRemainingTasks(ctx context.Context, stroomCluster *stroomv1.StroomCluster, remainingTasks map[string]int) error {
+	logger := log.FromContext(ctx)
+
+	pods, err := r.getReadyNodes(ctx, stroomCluster.Namespace, stroomCluster.GetNodeSelectorLabels())
+	if err != nil || len(pods) == 0 {
+		return err
+	}
+	apiClient, err := r.getStroomApiClient(ctx, stroomCluster)
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods {
+		if taskCount, err := apiClient.CountTasks(ctx, pod.Name); err != nil {
+			logger.Error(err, "Failed to list the active tasks of Stroom node", "StroomCluster", stroomCluster.Name, "Node", pod.Name)
+			return err
+		} else if taskCount > 0 {
+			remainingTasks[pod.Name] = int(taskCount)
+		}
+	}
+
+	return nil
+}
+
+// drainNode disables a node and its jobs, if they were enabled by the operator, and returns the number of tasks still
+// running on it. The node is disabled so the cluster does not try to contact it once it stops.
+func (r *StroomClusterReconciler) drainNode(ctx context.Context, stroomCluster *stroomv1.StroomCluster, apiClient *stroomapi.Client, pod *corev1.Pod) (int, error) {
+	if _, enabled := pod.Annotations[stroomv1.NodeEnabledAnnotation]; enabled {
+		if err := apiClient.SetJobsEnabled(ctx, pod.Name, false, nil); err != nil {
+			return 0, err
+		}
+		if err := apiClient.SetNodeEnabled(ctx, pod.Name, false); err != nil {
+			return 0, err
+		}
+		// Clear the annotation, so the node is enabled again if the drain is cancelled
+		patch := client.MergeFrom(pod.DeepCopy())
+		delete(pod.Annotations, stroomv1.NodeEnabledAnnotation)
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			return 0, err
+		}
+		log.FromContext(ctx).Info("Stroom node and jobs disabled, draining node", "StroomCluster", stroomCluster.Name, "Node", pod.Name)
+	}
+
+	taskCount, err := apiClient.CountTasks(ctx, pod.Name)
+	if err != nil {
+		return 0, err
+	}
+	return int(taskCount), nil
+}
+
+// drainNodes drains the named nodes of a NodeSet and returns the number of tasks still running on them. Nodes without
+// a ready Pod are not counted, as they cannot be running tasks.
+func (r *StroomClusterReconciler) drainNodes(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, nodeNames []string) (int, error) {
+	pods, err := r.getReadyNodes(ctx, stroomCluster.Namespace, stroomCluster.GetNodeSetSelectorLabels(nodeSet))
+	if err != nil {
+		return 0, err
+	}
+
+	remainingTasks := 0
+	for _, pod := range pods {
+		if !slices.Contains(nodeNames, pod.Name) {
+			continue
+		}
+		apiClient, err := r.getStroomApiClient(ctx, stroomCluster)
+		if err != nil {
+			return 0, err
+		}
+		taskCount, err := r.drainNode(ctx, stroomCluster, apiClient, &pod)
+		if err != nil {
+			return 0, err
+		}
+		remainingTasks += taskCount
+	}
+
+	return remainingTasks, nil
+}
+
+// drainTerminatingNodes drains the nodes whose Pods are terminating, such as when they are evicted or deleted. Once a
+// node has no running tasks, or the node termination period has passed, its Pod is annotated, allowing its pre-stop
+// hook to complete. Returns the names of the nodes still draining.
+func (r *StroomClusterReconciler) drainTerminatingNodes(ctx context.Context, stroomCluster *stroomv1.StroomCluster) ([]string, error) {
+	logger := log.FromContext(ctx)
+
+	podList := corev1.PodList{}
+	if err := r.List(ctx, &podList, client.InNamespace(stroomCluster.Namespace), client.MatchingLabels(stroomCluster.GetNodeSelectorLabels())); err != nil {
+		return nil, err
+	}
+
+	var draining []string
+	timeout := time.Duration(stroomCluster.Spec.NodeTerminationPeriodSecs) * time.Second
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.DeletionTimestamp == nil {
+			continue
+		} else if _, drained := pod.Annotations[stroomv1.NodeDrainedAnnotation]; drained {
+			continue
+		}
+
+		// Nodes are stopped without waiting for their tasks while a database restore is running. A node that is not
+		// ready cannot be running tasks.
+		drained := stroomCluster.IsRestoreInProgress() || !isPodReady(pod) || time.Since(pod.DeletionTimestamp.Time) > timeout
+		if !drained {
+			apiClient, err := r.getStroomApiClient(ctx, stroomCluster)
+			if err != nil {
+				return draining, err
+			}
+			if remainingTasks, err := r.drainNode(ctx, stroomCluster, apiClient, pod); err != nil {
+				// Keep the node running until the timeout, in case the Stroom API becomes available
+				logger.Info("Terminating node could not be drained", "StroomCluster", stroomCluster.Name, "Node", pod.Name, "Error", err.Error())
+			} else {
+				drained = remainingTasks == 0
+			}
+		}
+
+		if !drained {
+			draining = append(draining, pod.Name)
+		} else if err := r.setNodeDrained(ctx, pod); err != nil {
+			return draining, err
+		} else {
+			logger.Info("Stroom node drained, allowing its Pod to terminate", "StroomCluster", stroomCluster.Name, "Node", pod.Name)
+		}
+	}
+
+	return draining, nil
+}
+
+// setNodesDrained annotates the named node Pods of a StroomCluster, or all of them if nodeNames is nil, as drained, so
+// their pre-stop hooks complete without waiting once the Pods are deleted
+func (r *StroomClusterReconciler) setNodesDrained(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeNames []string) error {
+	podList := corev1.PodList{}
+	if err := r.List(ctx, &podList, client.InNamespace(stroomCluster.Namespace), client.MatchingLabels(stroomCluster.GetNodeSelectorLabels())); err != nil {
+		return err
+	}
+
+	for i := range podList.Items {
+		if nodeNames != nil && !slices.Contains(nodeNames, podList.Items[i].Name) {
+			continue
+		}
+		if err := r.setNodeDrained(ctx, &podList.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setNodeDrained annotates a node Pod as drained, if it is not already
+func (r *StroomClusterReconciler) setNodeDrained(ctx context.Context, pod *corev1.Pod) error {
+	if _, drained := pod.Annotations[stroomv1.NodeDrainedAnnotation]; drained {
+		return nil
+	}
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[stroomv1.NodeDrainedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	return r.Patch(ctx, pod, patch)
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// getRemovedNodeSets returns the NodeSets of the StatefulSets that are no longer in the StroomCluster spec. Each is
+// identified by the NodeSet label of its Pod selector.
+func getRemovedNodeSets(stroomCluster *stroomv1.StroomCluster, statefulSets []appsv1.StatefulSet) map[string]*appsv1.StatefulSet {
+	removed := make(map[string]*appsv1.StatefulSet)
+	for i, statefulSet := range statefulSets {
+		if statefulSet.Spec.Selector == nil {
+			continue
+		}
+		nodeSetName := statefulSet.Spec.Selector.MatchLabels[stroomv1.NodeSetLabel]
+		if nodeSetName == "" || slices.ContainsFunc(stroomCluster.Spec.NodeSets, func(nodeSet stroomv1.NodeSet) bool {
+			return nodeSet.Name == nodeSetName
+		}) {
+			continue
+		}
+		removed[nodeSetName] = &statefulSets[i]
+	}
+	return removed
+}
+
+// reconcileRemovedNodeSets drains the nodes of NodeSets removed from the StroomCluster spec, then deletes their
+// StatefulSets and Services. PVCs are deleted according to the VolumeClaimDeletePolicy. Returns the status of each
+// removed NodeSet still being drained.
+func (r *StroomClusterReconciler) reconcileRemovedNodeSets(ctx context.Context, stroomCluster *stroomv1.StroomCluster) ([]stroomv1.NodeSetStatus, error) {
+	logger := log.FromContext(ctx)
+
+	statefulSets := appsv1.StatefulSetList{}
+	if err := r.List(ctx, &statefulSets, client.InNamespace(stroomCluster.Namespace), client.MatchingLabels(stroomCluster.GetLabels())); err != nil {
+		logger.Error(err, "Failed to list StatefulSets", "StroomCluster", stroomCluster.Name)
+		return nil, err
+	}
+
+	var removedStatuses []stroomv1.NodeSetStatus
+	for nodeSetName, statefulSet := range getRemovedNodeSets(stroomCluster, statefulSets.Items) {
+		nodeSet := stroomv1.NodeSet{Name: nodeSetName}
+
+		// Drain every node as if the NodeSet were being scaled to zero, rather than scaling its StatefulSet. Once the
+		// nodes are drained, the StatefulSet is deleted.
+		var replicas int32 = 0
+		scaledDownStatefulSet := appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: statefulSet.Name, Namespace: statefulSet.Namespace},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		}
+		scaleDownStatus, err := r.reconcileScaleDown(ctx, stroomCluster, &nodeSet, &scaledDownStatefulSet)
+		if err != nil {
+			return nil, err
+		} else if scaleDownStatus != nil {
+			nodeSetStatus := newNodeSetStatus(&nodeSet, statefulSet)
+			nodeSetStatus.ScaleDown = scaleDownStatus
+			removedStatuses = append(removedStatuses, nodeSetStatus)
+			continue
+		}
+
+		if err := r.deleteNodeSet(ctx, stroomCluster, &nodeSet, statefulSet); err != nil {
+			return nil, err
+		}
+	}
+
+	return removedStatuses, nil
+}
+
+// deleteNodeSet deletes the StatefulSet and Services of a removed NodeSet and, depending on the VolumeClaimDeletePolicy,
+// its PVCs
+func (r *StroomClusterReconciler) deleteNodeSet(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, statefulSet *appsv1.StatefulSet) error {
+	logger := log.FromContext(ctx)
+
+	objects := []client.Object{statefulSet}
+	for _, serviceName := range []string{stroomCluster.GetNodeSetHeadlessServiceName(nodeSet), stroomCluster.GetNodeSetServiceName(nodeSet)} {
+		objects = append(objects, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: serviceName, Namespace: stroomCluster.Namespace}})
+	}
+
+	pvcDeletePolicy := stroomCluster.Spec.VolumeClaimDeletePolicy
+	if pvcDeletePolicy == stroomv1.DeleteOnScaledownAndClusterDeletionPolicy || pvcDeletePolicy == stroomv1.DeleteOnScaledownOnlyPolicy {
+		pvcList := corev1.PersistentVolumeClaimList{}
+		if err := r.List(ctx, &pvcList, client.InNamespace(stroomCluster.Namespace), client.MatchingLabels(r.createNodeSetLabels(stroomCluster, nodeSet))); err != nil {
+			logger.Error(err, "Failed to list PVCs of removed NodeSet", "StroomCluster", stroomCluster.Name, "NodeSet", nodeSet.Name)
+			return err
+		}
+		for i := range pvcList.Items {
+			objects = append(objects, &pvcList.Items[i])
+		}
+	}
+
+	for _, object := range objects {
+		if err := r.Delete(ctx, object); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete object of removed NodeSet", "NodeSet", nodeSet.Name, "Namespace", object.GetNamespace(), "Name", object.GetName())
+			return err
+		}
+	}
+
+	logger.Info("Removed NodeSet deleted", "StroomCluster", stroomCluster.Name, "NodeSet", nodeSet.Name, "DeletedObjects", len(objects))
+	return nil
+}
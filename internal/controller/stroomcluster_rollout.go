@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// RollingUpdatePollInterval is how often the tasks of a node being drained ahead of a rolling update are counted
+	RollingUpdatePollInterval = time.Second * 10
+)
+
+// getPodTemplateHash returns a digest of a Pod template, to detect when a change to it is to be rolled out
+func getPodTemplateHash(template *corev1.PodTemplateSpec) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// getRollingUpdatePartition returns the partition of a StatefulSet rolling update, limited to its replicas
+func getRollingUpdatePartition(statefulSet *appsv1.StatefulSet) int32 {
+	rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate == nil || rollingUpdate.Partition == nil || statefulSet.Spec.Replicas == nil {
+		return 0
+	}
+	return min(*rollingUpdate.Partition, *statefulSet.Spec.Replicas)
+}
+
+// reconcileRollingUpdate replaces the Pods of a NodeSet one at a time when its Pod template changes, draining each node
+// before its Pod is deleted. The partition of the StatefulSet rolling update holds back the Pods of nodes not yet
+// drained. Pods are replaced from the highest ordinal, as they would be by the StatefulSet controller. Returns the
+// progress of the rolling update, or "" once every Pod is up to date.
+func (r *StroomClusterReconciler) reconcileRollingUpdate(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, statefulSet *appsv1.StatefulSet) (string, error) {
+	logger := log.FromContext(ctx)
+
+	templateHash, err := getPodTemplateHash(&statefulSet.Spec.Template)
+	if err != nil {
+		return "", err
+	}
+	if statefulSet.Annotations == nil {
+		statefulSet.Annotations = map[string]string{}
+	}
+	statefulSet.Annotations[stroomv1.PodTemplateHashAnnotation] = templateHash
+	var partition int32 = 0
+	statefulSet.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+		Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+	}
+
+	// Nodes are already stopped while a database restore is running, without waiting for their tasks
+	if stroomCluster.IsRestoreInProgress() {
+		return "", nil
+	}
+
+	existingStatefulSet := appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: statefulSet.Namespace, Name: statefulSet.Name}, &existingStatefulSet); err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if existingStatefulSet.Spec.Replicas == nil {
+		return "", nil
+	}
+	replicas := *existingStatefulSet.Spec.Replicas
+
+	if existingTemplateHash, ok := existingStatefulSet.Annotations[stroomv1.PodTemplateHashAnnotation]; !ok {
+		// StatefulSets created by earlier versions of the operator have no hash. Take the current template as the
+		// baseline, rather than draining and replacing every node when the operator is upgraded. Their Pods drain
+		// themselves in their pre-stop hook.
+		return "", nil
+	} else if existingTemplateHash != templateHash {
+		// Hold back every Pod until its node is drained
+		partition = replicas
+		logger.Info("Pod template changed, starting rolling update", "StroomCluster", stroomCluster.Name, "NodeSet", nodeSet.Name)
+		return "Rolling update starting", nil
+	}
+	partition = getRollingUpdatePartition(&existingStatefulSet)
+
+	podList := corev1.PodList{}
+	if err := r.List(ctx, &podList, client.InNamespace(stroomCluster.Namespace), client.MatchingLabels(stroomCluster.GetNodeSetSelectorLabels(nodeSet))); err != nil {
+		return "", err
+	}
+	updateRevision := existingStatefulSet.Status.UpdateRevision
+	pods := make(map[int32]*corev1.Pod)
+	for i, pod := range podList.Items {
+		ordinal, ok := getPodOrdinal(&pod)
+		if !ok {
+			continue
+		}
+		pods[ordinal] = &podList.Items[i]
+
+		// If the change was reverted before the Pod was replaced, allow its node to be enabled again
+		if _, draining := pod.Annotations[stroomv1.NodeDrainStartedAnnotation]; draining && pod.Labels[appsv1.ControllerRevisionHashLabelKey] == updateRevision {
+			patch := client.MergeFrom(pod.DeepCopy())
+			delete(pod.Annotations, stroomv1.NodeDrainStartedAnnotation)
+			delete(pod.Annotations, stroomv1.NodeDrainedAnnotation)
+			if err := r.Patch(ctx, &pod, patch); err != nil {
+				return "", err
+			}
+		}
+	}
+	if partition == 0 {
+		return "", nil
+	}
+
+	// Wait until the Pods already released have been replaced and are ready
+	if existingStatefulSet.Status.ObservedGeneration < existingStatefulSet.Generation {
+		return "Waiting for the StatefulSet to be updated", nil
+	}
+	for ordinal := partition; ordinal < replicas; ordinal++ {
+		pod, ok := pods[ordinal]
+		if !ok || pod.Labels[appsv1.ControllerRevisionHashLabelKey] != updateRevision || !isPodReady(pod) {
+			return fmt.Sprintf("Waiting for node %v to be replaced", stroomCluster.GetNodeName(nodeSet, ordinal)), nil
+		}
+	}
+
+	ordinal := partition - 1
+	nodeName := stroomCluster.GetNodeName(nodeSet, ordinal)
+	if pod, ok := pods[ordinal]; ok && pod.Labels[appsv1.ControllerRevisionHashLabelKey] != updateRevision {
+		drained, err := r.drainNodeForUpdate(ctx, stroomCluster, nodeSet, pod)
+		if err != nil {
+			return "", err
+		} else if !drained {
+			return fmt.Sprintf("Draining node %v", nodeName), nil
+		}
+	}
+
+	partition = ordinal
+	logger.Info("Replacing the Pod of Stroom node", "StroomCluster", stroomCluster.Name, "NodeSet", nodeSet.Name, "Node", nodeName)
+	return fmt.Sprintf("Replacing node %v", nodeName), nil
+}
+
+// drainNodeForUpdate disables a node whose Pod is to be replaced by a rolling update, and its jobs. Returns whether the
+// node has no remaining tasks, or has been draining for longer than the node termination period. Once it has, the Pod
+// is annotated as drained, so its pre-stop hook does not wait again when it is deleted.
+func (r *StroomClusterReconciler) drainNodeForUpdate(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, pod *corev1.Pod) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	startTime, err := time.Parse(time.RFC3339, pod.Annotations[stroomv1.NodeDrainStartedAnnotation])
+	if err != nil {
+		// Record when the drain started, so enableStroomNodes leaves the node disabled
+		startTime = time.Now()
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[stroomv1.NodeDrainStartedAnnotation] = startTime.UTC().Format(time.RFC3339)
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			return false, err
+		}
+	}
+
+	timeout := time.Duration(stroomCluster.Spec.NodeTerminationPeriodSecs) * time.Second
+	if time.Since(startTime) > timeout {
+		logger.Info("Drain timeout exceeded, replacing node with active tasks", "StroomCluster", stroomCluster.Name,
+			"NodeSet", nodeSet.Name, "Node", pod.Name)
+		return true, r.setNodeDrained(ctx, pod)
+	}
+
+	remainingTasks, err := r.drainNodes(ctx, stroomCluster, nodeSet, []string{pod.Name})
+	if err != nil {
+		// Keep the node running until the timeout, in case the Stroom API becomes available
+		logger.Info("Node could not be drained", "StroomCluster", stroomCluster.Name, "NodeSet", nodeSet.Name, "Node", pod.Name, "Error", err.Error())
+		return false, nil
+	} else if remainingTasks > 0 {
+		return false, nil
+	}
+	return true, r.setNodeDrained(ctx, pod)
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ScaleDownPollInterval is how often the tasks of nodes being removed by a scale-down are counted
+	ScaleDownPollInterval = time.Second * 30
+)
+
+// getScaleDownStatus returns the recorded progress of a scale-down of the NodeSet to the specified number of replicas
+func getScaleDownStatus(stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, targetReplicas int32) *stroomv1.NodeSetScaleDownStatus {
+	for _, nodeSetStatus := range slices.Concat(stroomCluster.Status.NodeSets, stroomCluster.Status.RemovedNodeSets) {
+		if nodeSetStatus.Name == nodeSet.Name && nodeSetStatus.ScaleDown != nil && nodeSetStatus.ScaleDown.TargetReplicas == targetReplicas {
+			return nodeSetStatus.ScaleDown
+		}
+	}
+	return nil
+}
+
+// reconcileScaleDown drains the nodes being removed from a NodeSet, before its StatefulSet is scaled down. The jobs of
+// the highest ordinal nodes are disabled, and the StatefulSet keeps its current replicas until they have no remaining
+// tasks, or the drain timeout is exceeded. Returns the progress of the scale-down, or nil if the StatefulSet may be
+// scaled to the desired replicas.
+func (r *StroomClusterReconciler) reconcileScaleDown(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet, statefulSet *appsv1.StatefulSet) (*stroomv1.NodeSetScaleDownStatus, error) {
+	logger := log.FromContext(ctx)
+
+	// Nodes are already stopped while a database restore is running, without waiting for their tasks
+	if stroomCluster.IsRestoreInProgress() {
+		return nil, nil
+	}
+
+	existingStatefulSet := appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: statefulSet.Namespace, Name: statefulSet.Name}, &existingStatefulSet); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if existingStatefulSet.Spec.Replicas == nil {
+		return nil, nil
+	}
+	currentReplicas := *existingStatefulSet.Spec.Replicas
+	targetReplicas := *statefulSet.Spec.Replicas
+	if targetReplicas >= currentReplicas {
+		return nil, nil
+	}
+
+	status := stroomv1.NodeSetScaleDownStatus{TargetReplicas: targetReplicas}
+	if previousStatus := getScaleDownStatus(stroomCluster, nodeSet, targetReplicas); previousStatus != nil && previousStatus.StartTime != nil {
+		status.StartTime = previousStatus.StartTime
+	} else {
+		startTime := metav1.Now()
+		status.StartTime = &startTime
+	}
+	for ordinal := targetReplicas; ordinal < currentReplicas; ordinal++ {
+		status.DrainingNodes = append(status.DrainingNodes, stroomCluster.GetNodeName(nodeSet, ordinal))
+	}
+
+	timeout := time.Duration(stroomCluster.Spec.ScaleDownDrainTimeoutMins) * time.Minute
+	if time.Since(status.StartTime.Time) > timeout {
+		logger.Info("Drain timeout exceeded, removing nodes with active tasks", "StroomCluster", stroomCluster.Name,
+			"NodeSet", nodeSet.Name, "Nodes", status.DrainingNodes)
+		return nil, r.setNodesDrained(ctx, stroomCluster, status.DrainingNodes)
+	}
+
+	remainingTasks, err := r.drainNodes(ctx, stroomCluster, nodeSet, status.DrainingNodes)
+	if err != nil {
+		// Keep the nodes running until the drain timeout, in case the Stroom API becomes available
+		logger.Info("Nodes being removed could not be drained", "StroomCluster", stroomCluster.Name, "NodeSet", nodeSet.Name, "Error", err.Error())
+		status.Message = fmt.Sprintf("Nodes could not be drained: %v", err)
+	} else if remainingTasks == 0 {
+		logger.Info("Nodes drained, scaling down NodeSet", "StroomCluster", stroomCluster.Name, "NodeSet", nodeSet.Name, "Replicas", targetReplicas)
+		// Allow the pre-stop hooks of the removed nodes to complete without waiting for a further drain
+		return nil, r.setNodesDrained(ctx, stroomCluster, status.DrainingNodes)
+	} else {
+		status.RemainingTasks = remainingTasks
+		status.Message = fmt.Sprintf("Waiting for %v tasks to complete on nodes %v", remainingTasks, strings.Join(status.DrainingNodes, ", "))
+	}
+
+	// Keep the nodes running until they are drained
+	*statefulSet.Spec.Replicas = currentReplicas
+	return &status, nil
+}
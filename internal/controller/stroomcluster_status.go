@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DatabasePingTimeout is how long to wait for the database server to respond when checking connectivity
+	DatabasePingTimeout = time.Second * 5
+	// DatabaseCheckInterval is how long the result of a database connectivity check is kept before checking again
+	DatabaseCheckInterval = time.Minute
+)
+
+// setCondition records a StroomCluster status condition against the current generation.
+// The transition time is only updated if the status of the condition changes.
+func (r *StroomClusterReconciler) setCondition(stroomCluster *stroomv1.StroomCluster, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&stroomCluster.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: stroomCluster.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// updateStatus persists the StroomCluster status subresource
+func (r *StroomClusterReconciler) updateStatus(ctx context.Context, stroomCluster *stroomv1.StroomCluster) error {
+	logger := log.FromContext(ctx)
+
+	stroomCluster.Status.ObservedGeneration = stroomCluster.Generation
+	if err := r.Status().Update(ctx, stroomCluster); err != nil {
+		logger.Error(err, "Failed to update StroomCluster status", "Namespace", stroomCluster.Namespace, "Name", stroomCluster.Name)
+		return err
+	}
+
+	return nil
+}
+
+// isDatabaseCheckDue returns whether the database connections of a StroomCluster should be checked, because the
+// DatabaseReady condition is missing, was recorded against an earlier generation, or the last check has expired
+func isDatabaseCheckDue(stroomCluster *stroomv1.StroomCluster, lastCheck time.Time, now time.Time) bool {
+	condition := meta.FindStatusCondition(stroomCluster.Status.Conditions, stroomv1.DatabaseReadyCondition)
+	return condition == nil || condition.ObservedGeneration != stroomCluster.Generation || now.Sub(lastCheck) >= DatabaseCheckInterval
+}
+
+// startDatabaseCheck returns whether the database connections of a StroomCluster are due to be checked, recording
+// the time of the check if so. This avoids connecting to the database servers on every reconcile.
+func (r *StroomClusterReconciler) startDatabaseCheck(stroomCluster *stroomv1.StroomCluster) bool {
+	r.databaseChecksMutex.Lock()
+	defer r.databaseChecksMutex.Unlock()
+
+	key := types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.Name}
+	now := time.Now()
+	if !isDatabaseCheckDue(stroomCluster, r.databaseChecks[key], now) {
+		return false
+	}
+	if r.databaseChecks == nil {
+		r.databaseChecks = make(map[types.NamespacedName]time.Time)
+	}
+	r.databaseChecks[key] = now
+	return true
+}
+
+// releaseDatabaseCheck discards the time of the last database connectivity check of a deleted StroomCluster
+func (r *StroomClusterReconciler) releaseDatabaseCheck(stroomCluster *stroomv1.StroomCluster) {
+	r.databaseChecksMutex.Lock()
+	defer r.databaseChecksMutex.Unlock()
+
+	delete(r.databaseChecks, types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.Name})
+}
+
+// checkDatabaseConnections sets the DatabaseReady condition, according to whether the app and statistics databases
+// accept connections
+func (r *StroomClusterReconciler) checkDatabaseConnections(ctx context.Context, stroomCluster *stroomv1.StroomCluster, dbInfo *DatabaseConnectionInfo, statsDbInfo *DatabaseConnectionInfo) {
+	logger := log.FromContext(ctx)
+
+	if err := r.checkDatabaseConnection(ctx, stroomCluster, dbInfo, dbInfo.GetDatabaseName(stroomCluster.Spec.AppDatabaseName)); err != nil {
+		logger.Info("Database is not accepting connections", "Host", dbInfo.Host, "Error", err.Error())
+		r.setCondition(stroomCluster, stroomv1.DatabaseReadyCondition, metav1.ConditionFalse, "DatabaseUnavailable", err.Error())
+	} else if err := r.checkDatabaseConnection(ctx, stroomCluster, statsDbInfo, statsDbInfo.GetDatabaseName(stroomCluster.Spec.StatsDatabaseName)); err != nil {
+		logger.Info("Statistics database is not accepting connections", "Host", statsDbInfo.Host, "Error", err.Error())
+		r.setCondition(stroomCluster, stroomv1.DatabaseReadyCondition, metav1.ConditionFalse, "StatsDatabaseUnavailable", err.Error())
+	} else if statsDbInfo.Host != dbInfo.Host || statsDbInfo.Port != dbInfo.Port {
+		r.setCondition(stroomCluster, stroomv1.DatabaseReadyCondition, metav1.ConditionTrue, "DatabaseAvailable",
+			fmt.Sprintf("Connected to database servers %v:%v and %v:%v", dbInfo.Host, dbInfo.Port, statsDbInfo.Host, statsDbInfo.Port))
+	} else {
+		r.setCondition(stroomCluster, stroomv1.DatabaseReadyCondition, metav1.ConditionTrue, "DatabaseAvailable",
+			fmt.Sprintf("Connected to database server %v:%v", dbInfo.Host, dbInfo.Port))
+	}
+}
+
+// checkDatabaseConnection verifies the database server accepts connections for the specified database
+func (r *StroomClusterReconciler) checkDatabaseConnection(ctx context.Context, stroomCluster *stroomv1.StroomCluster, dbInfo *DatabaseConnectionInfo, databaseName string) error {
+	if dbInfo.DatabaseServer != nil && dbInfo.DatabaseServer.Status.State != "Deployed" {
+		return fmt.Errorf("DatabaseServer '%v/%v' is not yet deployed", dbInfo.DatabaseServer.Namespace, dbInfo.DatabaseServer.Name)
+	}
+
+	db, err := OpenDatabase(r, ctx, dbInfo, stroomCluster.Namespace, databaseName)
+	if err != nil {
+		return err
+	}
+	defer CloseDatabase(db)
+
+	pingCtx, cancel := context.WithTimeout(ctx, DatabasePingTimeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		databaseConnectionErrorsTotal.WithLabelValues(stroomCluster.Namespace, stroomCluster.Name, dbInfo.Host).Inc()
+		return err
+	}
+	return nil
+}
+
+// newNodeSetStatus summarises the replica counts of a NodeSet's StatefulSet
+func newNodeSetStatus(nodeSet *stroomv1.NodeSet, statefulSet *appsv1.StatefulSet) stroomv1.NodeSetStatus {
+	return stroomv1.NodeSetStatus{
+		Name:            nodeSet.Name,
+		DesiredReplicas: nodeSet.Count,
+		Replicas:        statefulSet.Status.Replicas,
+		ReadyReplicas:   statefulSet.Status.ReadyReplicas,
+		UpdatedReplicas: statefulSet.Status.UpdatedReplicas,
+	}
+}
+
+// setNodeSetStatus records the NodeSet replica counts and derives the overall NodeSet readiness
+func (r *StroomClusterReconciler) setNodeSetStatus(stroomCluster *stroomv1.StroomCluster, nodeSetStatuses []stroomv1.NodeSetStatus) {
+	var readyNodes, desiredNodes int32
+	var nodeNames, notReady []string
+
+	for _, nodeSetStatus := range nodeSetStatuses {
+		readyNodes += nodeSetStatus.ReadyReplicas
+		desiredNodes += nodeSetStatus.DesiredReplicas
+		if !nodeSetStatus.IsReady() {
+			notReady = append(notReady, fmt.Sprintf("%v (%v/%v)", nodeSetStatus.Name, nodeSetStatus.ReadyReplicas, nodeSetStatus.DesiredReplicas))
+		}
+	}
+	for _, nodeSet := range stroomCluster.Spec.NodeSets {
+		for ordinal := int32(0); ordinal < nodeSet.Count; ordinal++ {
+			nodeNames = append(nodeNames, stroomCluster.GetNodeName(&nodeSet, ordinal))
+		}
+	}
+
+	stroomCluster.Status.NodeSets = nodeSetStatuses
+	stroomCluster.Status.Nodes = nodeNames
+	stroomCluster.Status.ReadyNodes = fmt.Sprintf("%v/%v", readyNodes, desiredNodes)
+
+	if stroomCluster.IsRestoreInProgress() {
+		r.setCondition(stroomCluster, stroomv1.NodeSetsReadyCondition, metav1.ConditionFalse, "RestoreInProgress",
+			fmt.Sprintf("All NodeSets are scaled down while DatabaseRestore '%v' is running", stroomCluster.Annotations[stroomv1.RestoreInProgressAnnotation]))
+	} else if len(notReady) == 0 {
+		r.setCondition(stroomCluster, stroomv1.NodeSetsReadyCondition, metav1.ConditionTrue, "AllNodesReady",
+			fmt.Sprintf("All %v Stroom nodes are ready", desiredNodes))
+	} else {
+		r.setCondition(stroomCluster, stroomv1.NodeSetsReadyCondition, metav1.ConditionFalse, "NodesNotReady",
+			fmt.Sprintf("NodeSets awaiting ready replicas: %v", strings.Join(notReady, ", ")))
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("StroomCluster status", func() {
+
+	var (
+		reconciler    StroomClusterReconciler
+		stroomCluster stroomv1.StroomCluster
+	)
+
+	BeforeEach(func() {
+		reconciler = StroomClusterReconciler{}
+		stroomCluster = stroomv1.StroomCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Generation: 2},
+			Spec: stroomv1.StroomClusterSpec{
+				NodeSets: []stroomv1.NodeSet{
+					{Name: "ui", Count: 1},
+					{Name: "data", Count: 2},
+				},
+			},
+		}
+	})
+
+	Context("setNodeSetStatus()", func() {
+		It("should report ready when all NodeSets have their desired replicas ready", func() {
+			reconciler.setNodeSetStatus(&stroomCluster, []stroomv1.NodeSetStatus{
+				newNodeSetStatus(&stroomCluster.Spec.NodeSets[0], &appsv1.StatefulSet{Status: appsv1.StatefulSetStatus{Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1}}),
+				newNodeSetStatus(&stroomCluster.Spec.NodeSets[1], &appsv1.StatefulSet{Status: appsv1.StatefulSetStatus{Replicas: 2, ReadyReplicas: 2, UpdatedReplicas: 2}}),
+			})
+
+			Expect(stroomCluster.Status.ReadyNodes).Should(Equal("3/3"))
+			Expect(stroomCluster.Status.Nodes).Should(Equal([]string{"stroom-dev-node-ui-0", "stroom-dev-node-data-0", "stroom-dev-node-data-1"}))
+			condition := meta.FindStatusCondition(stroomCluster.Status.Conditions, stroomv1.NodeSetsReadyCondition)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(metav1.ConditionTrue))
+			Expect(condition.ObservedGeneration).Should(Equal(int64(2)))
+		})
+		It("should report the NodeSets that are not ready", func() {
+			reconciler.setNodeSetStatus(&stroomCluster, []stroomv1.NodeSetStatus{
+				newNodeSetStatus(&stroomCluster.Spec.NodeSets[0], &appsv1.StatefulSet{Status: appsv1.StatefulSetStatus{Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1}}),
+				newNodeSetStatus(&stroomCluster.Spec.NodeSets[1], &appsv1.StatefulSet{Status: appsv1.StatefulSetStatus{Replicas: 2, ReadyReplicas: 1, UpdatedReplicas: 2}}),
+			})
+
+			Expect(stroomCluster.Status.ReadyNodes).Should(Equal("2/3"))
+			condition := meta.FindStatusCondition(stroomCluster.Status.Conditions, stroomv1.NodeSetsReadyCondition)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(metav1.ConditionFalse))
+			Expect(condition.Message).Should(ContainSubstring("data (1/2)"))
+		})
+		It("should report NodeSets scaled down while a database restore is in progress", func() {
+			stroomCluster.Annotations = map[string]string{stroomv1.RestoreInProgressAnnotation: "stroom/dev"}
+			reconciler.setNodeSetStatus(&stroomCluster, []stroomv1.NodeSetStatus{
+				newNodeSetStatus(&stroomCluster.Spec.NodeSets[0], &appsv1.StatefulSet{}),
+				newNodeSetStatus(&stroomCluster.Spec.NodeSets[1], &appsv1.StatefulSet{}),
+			})
+
+			condition := meta.FindStatusCondition(stroomCluster.Status.Conditions, stroomv1.NodeSetsReadyCondition)
+			Expect(condition).ShouldNot(BeNil())
+			Expect(condition.Status).Should(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).Should(Equal("RestoreInProgress"))
+		})
+	})
+
+	Context("isDatabaseCheckDue()", func() {
+		It("should only check the database connections again once the last check expires or the spec changes", func() {
+			now := time.Now()
+			Expect(isDatabaseCheckDue(&stroomCluster, time.Time{}, now)).Should(BeTrue())
+
+			reconciler.setCondition(&stroomCluster, stroomv1.DatabaseReadyCondition, metav1.ConditionFalse, "DatabaseUnavailable", "")
+			Expect(isDatabaseCheckDue(&stroomCluster, now.Add(-time.Second*10), now)).Should(BeFalse())
+			Expect(isDatabaseCheckDue(&stroomCluster, now.Add(-DatabaseCheckInterval), now)).Should(BeTrue())
+
+			stroomCluster.Generation++
+			Expect(isDatabaseCheckDue(&stroomCluster, now.Add(-time.Second*10), now)).Should(BeTrue())
+		})
+	})
+})
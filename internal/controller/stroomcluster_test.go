@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("StroomCluster", func() {
+
+	var (
+		reconciler    StroomClusterReconciler
+		stroomCluster stroomv1.StroomCluster
+		dbInfo        DatabaseConnectionInfo
+		statsDbInfo   DatabaseConnectionInfo
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(stroomv1.AddToScheme(scheme)).Should(Succeed())
+		reconciler = StroomClusterReconciler{Scheme: scheme}
+		stroomCluster = stroomv1.StroomCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.StroomClusterSpec{
+				DatabaseServerRef: stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev", Namespace: "stroom"}},
+				AppDatabaseName:   "stroom",
+				StatsDatabaseName: "stats",
+				NodeSets:          []stroomv1.NodeSet{{Name: "data", Count: 1}},
+			},
+		}
+		dbInfo = DatabaseConnectionInfo{
+			ServerAddress: stroomv1.ServerAddress{Host: "stroom-dev-db", Port: 3306, SecretName: "stroom-dev-db"},
+			UserName:      "stroomuser",
+		}
+		statsDbInfo = dbInfo
+	})
+
+	getEnv := func(statefulSet *appsv1.StatefulSet, name string) *corev1.EnvVar {
+		for _, env := range statefulSet.Spec.Template.Spec.Containers[0].Env {
+			if env.Name == name {
+				return &env
+			}
+		}
+		return nil
+	}
+
+	getInitContainer := func(statefulSet *appsv1.StatefulSet, name string) *corev1.Container {
+		for _, container := range statefulSet.Spec.Template.Spec.InitContainers {
+			if container.Name == name {
+				return &container
+			}
+		}
+		return nil
+	}
+
+	Context("createStatefulSet()", func() {
+		It("should connect to the statistics database on the app database server by default", func() {
+			statefulSet := reconciler.createStatefulSet(&stroomCluster, &stroomCluster.Spec.NodeSets[0], &dbInfo, &statsDbInfo, "gchq/stroom:v7.2", "")
+
+			Expect(getEnv(statefulSet, "STROOM_STATISTICS_JDBC_DRIVER_URL").Value).Should(HavePrefix("jdbc:mysql://stroom-dev-db:3306/stats?"))
+			Expect(getEnv(statefulSet, "STROOM_STATISTICS_JDBC_DRIVER_PASSWORD").ValueFrom.SecretKeyRef.Name).Should(Equal("stroom-dev-db"))
+			Expect(getInitContainer(statefulSet, "render-config")).Should(BeNil())
+		})
+		It("should connect to a separate statistics database server", func() {
+			stroomCluster.Spec.StatsDatabaseServerRef = &stroomv1.DatabaseServerRef{ServerAddress: stroomv1.ServerAddress{Host: "stats-db", Port: 3307}}
+			statsDbInfo = DatabaseConnectionInfo{
+				ServerAddress: stroomv1.ServerAddress{
+					Host:         "stats-db",
+					Port:         3307,
+					CaSecretName: "stats-db-ca",
+					PasswordFile: &stroomv1.PasswordFileSource{
+						Volume: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "stats-db-password"}},
+						Path:   "password",
+					},
+				},
+				UserName: "stats",
+			}
+			statefulSet := reconciler.createStatefulSet(&stroomCluster, &stroomCluster.Spec.NodeSets[0], &dbInfo, &statsDbInfo, "gchq/stroom:v7.2", "")
+
+			Expect(getEnv(statefulSet, "STROOM_JDBC_DRIVER_URL").Value).Should(HavePrefix("jdbc:mysql://stroom-dev-db:3306/stroom?"))
+			Expect(getEnv(statefulSet, "STROOM_JDBC_DRIVER_PASSWORD")).ShouldNot(BeNil())
+			Expect(getEnv(statefulSet, "STROOM_STATISTICS_JDBC_DRIVER_URL").Value).Should(HavePrefix("jdbc:mysql://stats-db:3307/stats?"))
+			Expect(getEnv(statefulSet, "STROOM_STATISTICS_JDBC_DRIVER_USERNAME").Value).Should(Equal("stats"))
+			Expect(getEnv(statefulSet, "STROOM_STATISTICS_JDBC_DRIVER_PASSWORD")).Should(BeNil())
+
+			renderConfig := getInitContainer(statefulSet, "render-config")
+			Expect(renderConfig).ShouldNot(BeNil())
+			Expect(renderConfig.Env).Should(ConsistOf(corev1.EnvVar{
+				Name:  "STROOM_STATISTICS_JDBC_DRIVER_PASSWORD_FILE",
+				Value: "/etc/stroom/stats-database-password/password",
+			}))
+
+			truststore := getInitContainer(statefulSet, "generate-database-truststore")
+			Expect(truststore).ShouldNot(BeNil())
+			Expect(truststore.VolumeMounts).Should(ContainElement(corev1.VolumeMount{
+				Name:      StatsDatabaseCaVolumeName,
+				MountPath: "/opt/database-ca/stats-database-ca",
+				ReadOnly:  true,
+			}))
+		})
+		It("should restart nodes when the passwords of either DatabaseServer are rotated", func() {
+			appRotated := metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+			statsRotated := metav1.NewTime(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+			dbInfo.DatabaseServer = &stroomv1.DatabaseServer{ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"}}
+			dbInfo.DatabaseServer.Status.CredentialRotation.LastRotationTime = &appRotated
+			statsDbInfo.DatabaseServer = &stroomv1.DatabaseServer{ObjectMeta: metav1.ObjectMeta{Name: "stats", Namespace: "stroom"}}
+			statsDbInfo.DatabaseServer.Status.CredentialRotation.LastRotationTime = &statsRotated
+			statefulSet := reconciler.createStatefulSet(&stroomCluster, &stroomCluster.Spec.NodeSets[0], &dbInfo, &statsDbInfo, "gchq/stroom:v7.2", "")
+
+			Expect(statefulSet.Spec.Template.Annotations).Should(HaveKeyWithValue(stroomv1.CredentialsRotatedAnnotation,
+				"2026-01-01T00:00:00Z 2026-02-01T00:00:00Z"))
+		})
+		It("should restart nodes when their configuration changes, unless opted out", func() {
+			statefulSet := reconciler.createStatefulSet(&stroomCluster, &stroomCluster.Spec.NodeSets[0], &dbInfo, &statsDbInfo, "gchq/stroom:v7.2", "abc123")
+			Expect(statefulSet.Spec.Template.Annotations).Should(HaveKeyWithValue(stroomv1.ConfigHashAnnotation, "abc123"))
+
+			statefulSet = reconciler.createStatefulSet(&stroomCluster, &stroomCluster.Spec.NodeSets[0], &dbInfo, &statsDbInfo, "gchq/stroom:v7.2", "")
+			Expect(statefulSet.Spec.Template.Annotations).ShouldNot(HaveKey(stroomv1.ConfigHashAnnotation))
+		})
+		It("should expose the Pod annotations to the pre-stop hook", func() {
+			statefulSet := reconciler.createStatefulSet(&stroomCluster, &stroomCluster.Spec.NodeSets[0], &dbInfo, &statsDbInfo, "gchq/stroom:v7.2", "")
+
+			container := statefulSet.Spec.Template.Spec.Containers[0]
+			Expect(container.Lifecycle.PreStop.Exec.Command).Should(Equal([]string{"bash", "/stroom/scripts/node-pre-stop.sh"}))
+			Expect(container.VolumeMounts).Should(ContainElement(corev1.VolumeMount{
+				Name:      StroomPodInfoVolumeName,
+				MountPath: "/stroom/pod-info",
+				ReadOnly:  true,
+			}))
+			Expect(statefulSet.Spec.Template.Spec.Volumes).Should(ContainElement(HaveField("Name", StroomPodInfoVolumeName)))
+		})
+	})
+
+	Context("getPodTemplateHash()", func() {
+		It("should change when the Pod template changes", func() {
+			template := corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: StroomNodeContainerName, Image: "stroom:7.8"}}}}
+			hash, err := getPodTemplateHash(&template)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(getPodTemplateHash(template.DeepCopy())).Should(Equal(hash))
+
+			template.Spec.Containers[0].Image = "stroom:7.9"
+			Expect(getPodTemplateHash(&template)).ShouldNot(Equal(hash))
+		})
+	})
+
+	Context("getRollingUpdatePartition()", func() {
+		It("should not exceed the StatefulSet replicas", func() {
+			var replicas, partition int32 = 2, 3
+			statefulSet := appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: &replicas}}
+			Expect(getRollingUpdatePartition(&statefulSet)).Should(Equal(int32(0)))
+
+			statefulSet.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition}
+			Expect(getRollingUpdatePartition(&statefulSet)).Should(Equal(int32(2)))
+
+			partition = 1
+			Expect(getRollingUpdatePartition(&statefulSet)).Should(Equal(int32(1)))
+		})
+	})
+
+	Context("getNodeInstance()", func() {
+		It("should change when the Stroom container restarts", func() {
+			pod := corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "stroom-log-sender", RestartCount: 5},
+				{Name: StroomNodeContainerName, RestartCount: 0},
+			}}}
+			Expect(getNodeInstance(&pod)).Should(Equal("0"))
+
+			pod.Status.ContainerStatuses[1].RestartCount = 1
+			Expect(getNodeInstance(&pod)).Should(Equal("1"))
+		})
+	})
+
+	Context("mapPodToStroomCluster()", func() {
+		It("should enqueue the StroomCluster of a node Pod", func() {
+			pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "stroom-dev-node-data-0", Namespace: "stroom", Labels: stroomCluster.GetNodeSetSelectorLabels(&stroomCluster.Spec.NodeSets[0])}}
+			Expect(mapPodToStroomCluster(context.Background(), &pod)).Should(ConsistOf(
+				reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "stroom", Name: "dev"}}))
+
+			pod.Labels = nil
+			Expect(mapPodToStroomCluster(context.Background(), &pod)).Should(BeEmpty())
+		})
+	})
+
+	Context("getConfigSecretNames()", func() {
+		It("should list each Secret used by the Stroom nodes once", func() {
+			Expect(getConfigSecretNames(&stroomCluster)).Should(BeEmpty())
+
+			stroomCluster.Spec.Https = stroomv1.HttpsSettings{
+				TlsSecretName:                "stroom-tls",
+				TlsKeystorePasswordSecretRef: stroomv1.SecretItem{SecretName: "stroom-secrets", Key: "keystore-password"},
+			}
+			stroomCluster.Spec.OpenId = stroomv1.OpenIdConfiguration{
+				ClientId:     "stroom",
+				ClientSecret: stroomv1.SecretItem{SecretName: "stroom-secrets", Key: "client-secret"},
+			}
+			Expect(getConfigSecretNames(&stroomCluster)).Should(Equal([]string{"stroom-secrets", "stroom-tls"}))
+		})
+	})
+
+	Context("getManagedJobs()", func() {
+		It("should manage the jobs of the NodeSet role, unless listed", func() {
+			Expect(getManagedJobs(&stroomv1.NodeSet{Role: stroomv1.ProcessingNodeRole})).Should(BeEmpty())
+			Expect(getManagedJobs(&stroomv1.NodeSet{Role: stroomv1.FrontendNodeRole})).Should(Equal([]string{"Reindex Content"}))
+			Expect(getManagedJobs(&stroomv1.NodeSet{Role: stroomv1.FrontendNodeRole, ManagedJobs: []string{"Index Shard Delete"}})).
+				Should(Equal([]string{"Index Shard Delete"}))
+		})
+	})
+
+	Context("getStroomApiUrl()", func() {
+		It("should call the API of the first NodeSet with nodes", func() {
+			stroomCluster.Spec.NodeSets = []stroomv1.NodeSet{{Name: "ui", Count: 0}, {Name: "data", Count: 2}}
+			Expect(getStroomApiUrl(&stroomCluster)).Should(Equal("http://stroom-dev-node-data-http.stroom.svc.cluster.local:8080/api"))
+
+			stroomCluster.Spec.NodeSets[1].Count = 0
+			_, err := getStroomApiUrl(&stroomCluster)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("getPodOrdinal()", func() {
+		It("should read the StatefulSet ordinal from the Pod name", func() {
+			ordinal, ok := getPodOrdinal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "stroom-dev-node-data-12"}})
+			Expect(ok).Should(BeTrue())
+			Expect(ordinal).Should(Equal(int32(12)))
+			_, ok = getPodOrdinal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "stroom-dev-node-data"}})
+			Expect(ok).Should(BeFalse())
+		})
+	})
+
+	Context("getScaleDownStatus()", func() {
+		It("should only resume a scale-down to the same number of replicas", func() {
+			startTime := metav1.Now()
+			stroomCluster.Status.NodeSets = []stroomv1.NodeSetStatus{{
+				Name:      "data",
+				ScaleDown: &stroomv1.NodeSetScaleDownStatus{TargetReplicas: 2, StartTime: &startTime},
+			}}
+			nodeSet := &stroomCluster.Spec.NodeSets[0]
+
+			Expect(getScaleDownStatus(&stroomCluster, nodeSet, 2).StartTime).Should(Equal(&startTime))
+			Expect(getScaleDownStatus(&stroomCluster, nodeSet, 1)).Should(BeNil())
+		})
+	})
+
+	Context("getRemovedNodeSets()", func() {
+		It("should find StatefulSets of NodeSets no longer in the spec", func() {
+			newStatefulSet := func(nodeSetName string) appsv1.StatefulSet {
+				return appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: stroomCluster.GetNodeSetSelectorLabels(&stroomv1.NodeSet{Name: nodeSetName})},
+				}}
+			}
+			statefulSets := []appsv1.StatefulSet{newStatefulSet("data"), newStatefulSet("ui"), {}}
+
+			removed := getRemovedNodeSets(&stroomCluster, statefulSets)
+			Expect(removed).Should(HaveLen(1))
+			Expect(removed).Should(HaveKeyWithValue("ui", &statefulSets[1]))
+		})
+	})
+
+	Context("getDepartedNodes()", func() {
+		It("should list nodes of the StroomCluster without a Pod or NodeSet", func() {
+			departedTime := metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+			now := metav1.NewTime(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+			stroomCluster.Status.Nodes = []string{"stroom-dev-node-data-0"}
+			stroomCluster.Status.DepartedNodes = []stroomv1.DepartedNode{{Name: "stroom-dev-node-data-2", DepartedTime: departedTime}}
+			nodeNames := []string{
+				"stroom-dev-node-data-0",
+				"stroom-dev-node-data-1",
+				"stroom-dev-node-data-2",
+				"stroom-dev-node-ui-0",
+				"stroom-dev-node-data",
+				"stroom-other-node-data-0",
+			}
+
+			Expect(getDepartedNodes(&stroomCluster, nodeNames, []string{"stroom-dev-node-data-1"}, now)).Should(Equal([]stroomv1.DepartedNode{
+				{Name: "stroom-dev-node-data-2", DepartedTime: departedTime},
+				{Name: "stroom-dev-node-ui-0", DepartedTime: now},
+			}))
+		})
+	})
+})
@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// UpgradePollInterval is how often the progress of an upgrade is checked
+	UpgradePollInterval = time.Second * 15
+)
+
+// reconcileUpgrade detects a change to the StroomCluster image and advances any upgrade in progress.
+// Upgrades proceed by running an optional database backup, then rolling out the new image to one NodeSet at a time.
+// The NodeSet image to deploy is then determined by getNodeSetImage.
+func (r *StroomClusterReconciler) reconcileUpgrade(ctx context.Context, stroomCluster *stroomv1.StroomCluster) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	status := &stroomCluster.Status
+	upgrade := &status.Upgrade
+	targetImage := stroomCluster.Spec.Image.String()
+
+	if status.Image == "" {
+		// The StroomCluster is newly-created, or was deployed before upgrades were tracked. Either way, its NodeSets
+		// run the current image.
+		status.Image = targetImage
+		return ctrl.Result{}, nil
+	}
+
+	if targetImage == status.Image {
+		if upgrade.IsInProgress() {
+			// The image was reverted, so any upgraded NodeSets are rolled back together
+			logger.Info("Upgrade cancelled", "FromImage", upgrade.FromImage, "TargetImage", upgrade.TargetImage)
+			r.setUpgradePhase(stroomCluster, stroomv1.UpgradeCancelledPhase, metav1.ConditionFalse,
+				fmt.Sprintf("Upgrade to %v cancelled. Reverting to %v", upgrade.TargetImage, upgrade.FromImage))
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !upgrade.IsInProgress() || upgrade.TargetImage != targetImage {
+		// Start a new upgrade. If the target changed during an upgrade, start over, as NodeSets already upgraded
+		// are running an image that was never fully deployed.
+		now := metav1.Now()
+		*upgrade = stroomv1.UpgradeStatus{
+			FromImage: status.Image,
+			StartTime: &now,
+		}
+		upgrade.TargetImage = targetImage
+		logger.Info("Starting upgrade", "FromImage", upgrade.FromImage, "TargetImage", upgrade.TargetImage)
+
+		if stroomCluster.Spec.Upgrade.PreUpgradeBackupName != "" {
+			upgrade.BackupJobName = stroomCluster.GetPreUpgradeBackupJobName()
+			r.startUpgradeStep(stroomCluster, stroomv1.UpgradeBackingUpPhase, "Backing up the database prior to upgrade")
+		} else {
+			r.startUpgradeStep(stroomCluster, stroomv1.UpgradeRollingOutPhase, "Upgrading NodeSets")
+		}
+	}
+
+	if upgrade.IsBackupPending() {
+		if completed, err := r.reconcilePreUpgradeBackup(ctx, stroomCluster); err != nil {
+			return ctrl.Result{}, err
+		} else if !completed {
+			return ctrl.Result{RequeueAfter: UpgradePollInterval}, nil
+		}
+		r.startUpgradeStep(stroomCluster, stroomv1.UpgradeRollingOutPhase, "Database backup completed. Upgrading NodeSets")
+	}
+
+	// Move on to the next NodeSet once the current one is running the target image with all replicas ready
+	for upgrade.Phase == stroomv1.UpgradeRollingOutPhase || (upgrade.Phase == stroomv1.UpgradeFailedPhase && upgrade.CurrentNodeSet != "") {
+		if upgrade.CurrentNodeSet != "" {
+			if rolledOut, err := r.isNodeSetRolledOut(ctx, stroomCluster, upgrade.CurrentNodeSet, upgrade.TargetImage); err != nil {
+				return ctrl.Result{}, err
+			} else if !rolledOut {
+				r.checkNodeSetReadyTimeout(ctx, stroomCluster)
+				return ctrl.Result{RequeueAfter: UpgradePollInterval}, nil
+			}
+
+			logger.Info("NodeSet upgraded", "NodeSet", upgrade.CurrentNodeSet, "Image", upgrade.TargetImage)
+			upgrade.CompletedNodeSets = append(upgrade.CompletedNodeSets, upgrade.CurrentNodeSet)
+			upgrade.CurrentNodeSet = ""
+		}
+
+		if nextNodeSet := getNextNodeSetToUpgrade(stroomCluster); nextNodeSet != "" {
+			upgrade.CurrentNodeSet = nextNodeSet
+			r.startUpgradeStep(stroomCluster, stroomv1.UpgradeRollingOutPhase, fmt.Sprintf("Upgrading NodeSet '%v'", nextNodeSet))
+			logger.Info("Upgrading NodeSet", "NodeSet", nextNodeSet, "Image", upgrade.TargetImage)
+			return ctrl.Result{RequeueAfter: UpgradePollInterval}, nil
+		}
+
+		// All NodeSets are upgraded
+		now := metav1.Now()
+		upgrade.CompletionTime = &now
+		status.Image = upgrade.TargetImage
+		r.setUpgradePhase(stroomCluster, stroomv1.UpgradeCompletePhase, metav1.ConditionFalse,
+			fmt.Sprintf("All NodeSets upgraded to %v", upgrade.TargetImage))
+		logger.Info("Upgrade complete", "Image", upgrade.TargetImage)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// getNodeSetImage returns the image a NodeSet is to run, given the progress of any upgrade
+func getNodeSetImage(stroomCluster *stroomv1.StroomCluster, nodeSet *stroomv1.NodeSet) string {
+	upgrade := &stroomCluster.Status.Upgrade
+	if !upgrade.IsInProgress() {
+		return stroomCluster.Spec.Image.String()
+	}
+
+	if !upgrade.IsBackupPending() && upgrade.IsNodeSetUpgraded(nodeSet.Name) {
+		return upgrade.TargetImage
+	} else {
+		return upgrade.FromImage
+	}
+}
+
+// getNextNodeSetToUpgrade returns the name of the first NodeSet in the upgrade order not yet upgraded, or an empty
+// string if there are none left
+func getNextNodeSetToUpgrade(stroomCluster *stroomv1.StroomCluster) string {
+	upgrade := &stroomCluster.Status.Upgrade
+
+	nodeSetNames := make([]string, 0, len(stroomCluster.Spec.NodeSets))
+	for _, name := range stroomCluster.Spec.Upgrade.NodeSetOrder {
+		for _, nodeSet := range stroomCluster.Spec.NodeSets {
+			if nodeSet.Name == name {
+				nodeSetNames = append(nodeSetNames, name)
+				break
+			}
+		}
+	}
+	for _, nodeSet := range stroomCluster.Spec.NodeSets {
+		nodeSetNames = append(nodeSetNames, nodeSet.Name)
+	}
+
+	for _, name := range nodeSetNames {
+		if !upgrade.IsNodeSetUpgraded(name) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// isNodeSetRolledOut returns whether every Pod in a NodeSet StatefulSet is running the specified image and is ready.
+// A NodeSet that no longer exists is treated as rolled out, so the upgrade can proceed.
+func (r *StroomClusterReconciler) isNodeSetRolledOut(ctx context.Context, stroomCluster *stroomv1.StroomCluster, nodeSetName string, image string) (bool, error) {
+	var nodeSet *stroomv1.NodeSet
+	for i := range stroomCluster.Spec.NodeSets {
+		if stroomCluster.Spec.NodeSets[i].Name == nodeSetName {
+			nodeSet = &stroomCluster.Spec.NodeSets[i]
+		}
+	}
+	if nodeSet == nil {
+		return true, nil
+	}
+
+	statefulSet := appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.GetNodeSetName(nodeSet)}, &statefulSet); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, container := range statefulSet.Spec.Template.Spec.Containers {
+		if container.Name == StroomNodeContainerName && container.Image != image {
+			// StatefulSet has not yet been updated
+			return false, nil
+		}
+	}
+
+	status := statefulSet.Status
+	return status.ObservedGeneration >= statefulSet.Generation &&
+		status.CurrentRevision == status.UpdateRevision &&
+		status.UpdatedReplicas == nodeSet.Count &&
+		status.ReadyReplicas == nodeSet.Count, nil
+}
+
+// checkNodeSetReadyTimeout halts the upgrade if the current NodeSet has not become ready within the allowed time.
+// Remaining NodeSets continue to run the previous image. If the NodeSet subsequently becomes ready, the upgrade
+// resumes.
+func (r *StroomClusterReconciler) checkNodeSetReadyTimeout(ctx context.Context, stroomCluster *stroomv1.StroomCluster) {
+	logger := log.FromContext(ctx)
+	upgrade := &stroomCluster.Status.Upgrade
+	timeout := time.Duration(stroomCluster.Spec.Upgrade.NodeSetReadyTimeoutMins) * time.Minute
+
+	if upgrade.Phase == stroomv1.UpgradeRollingOutPhase && timeout > 0 && upgrade.StepStartTime != nil &&
+		time.Since(upgrade.StepStartTime.Time) > timeout {
+		message := fmt.Sprintf("NodeSet '%v' did not become ready within %v. Upgrade halted with NodeSets [%v] remaining on %v",
+			upgrade.CurrentNodeSet, timeout, strings.Join(getRemainingNodeSets(stroomCluster), ", "), upgrade.FromImage)
+		logger.Info(message)
+		r.setUpgradePhase(stroomCluster, stroomv1.UpgradeFailedPhase, metav1.ConditionTrue, message)
+	}
+}
+
+// getRemainingNodeSets returns the names of NodeSets that have not been upgraded
+func getRemainingNodeSets(stroomCluster *stroomv1.StroomCluster) []string {
+	var remaining []string
+	for _, nodeSet := range stroomCluster.Spec.NodeSets {
+		if !stroomCluster.Status.Upgrade.IsNodeSetUpgraded(nodeSet.Name) {
+			remaining = append(remaining, nodeSet.Name)
+		}
+	}
+
+	return remaining
+}
+
+// reconcilePreUpgradeBackup runs a one-off Job using the settings of the DatabaseBackup referenced in the upgrade
+// settings. Returns true once the Job has succeeded.
+func (r *StroomClusterReconciler) reconcilePreUpgradeBackup(ctx context.Context, stroomCluster *stroomv1.StroomCluster) (bool, error) {
+	logger := log.FromContext(ctx)
+	upgrade := &stroomCluster.Status.Upgrade
+
+	existingJob := batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: stroomCluster.Namespace, Name: upgrade.BackupJobName}, &existingJob); err != nil {
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+
+		dbBackup := stroomv1.DatabaseBackup{}
+		backupName := types.NamespacedName{Namespace: stroomCluster.Namespace, Name: stroomCluster.Spec.Upgrade.PreUpgradeBackupName}
+		if err := r.Get(ctx, backupName, &dbBackup); err != nil {
+			if errors.IsNotFound(err) {
+				r.setUpgradePhase(stroomCluster, stroomv1.UpgradeFailedPhase, metav1.ConditionTrue,
+					fmt.Sprintf("DatabaseBackup '%v' not found. Cannot perform pre-upgrade backup", backupName.Name))
+				return false, nil
+			}
+			return false, err
+		}
+
+		dbInfo := DatabaseConnectionInfo{}
+		if err := GetDatabaseConnectionInfo(r.Client, ctx, &dbBackup.Spec.DatabaseServerRef, dbBackup.Namespace, &dbInfo); err != nil {
+			return false, err
+		}
+
+		job := r.createPreUpgradeBackupJob(stroomCluster, &dbBackup, &dbInfo)
+		logger.Info("Creating pre-upgrade backup Job", "Namespace", job.Namespace, "Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create pre-upgrade backup Job", "Namespace", job.Namespace, "Name", job.Name)
+			return false, err
+		}
+
+		// A failed backup is retried if its Job is deleted
+		r.startUpgradeStep(stroomCluster, stroomv1.UpgradeBackingUpPhase, "Backing up the database prior to upgrade")
+		return false, nil
+	}
+
+	for _, condition := range existingJob.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		if condition.Type == batchv1.JobComplete {
+			logger.Info("Pre-upgrade backup completed", "Job", existingJob.Name)
+			return true, nil
+		} else if condition.Type == batchv1.JobFailed {
+			r.setUpgradePhase(stroomCluster, stroomv1.UpgradeFailedPhase, metav1.ConditionTrue,
+				fmt.Sprintf("Pre-upgrade backup Job '%v' failed: %v", existingJob.Name, condition.Message))
+			return false, nil
+		}
+	}
+
+	timeout := time.Duration(stroomCluster.Spec.Upgrade.BackupTimeoutMins) * time.Minute
+	if timeout > 0 && upgrade.StepStartTime != nil && time.Since(upgrade.StepStartTime.Time) > timeout {
+		r.setUpgradePhase(stroomCluster, stroomv1.UpgradeFailedPhase, metav1.ConditionTrue,
+			fmt.Sprintf("Pre-upgrade backup Job '%v' did not complete within %v", existingJob.Name, timeout))
+	}
+
+	return false, nil
+}
+
+// createPreUpgradeBackupJob creates a Job from the DatabaseBackup job template, owned by the StroomCluster
+func (r *StroomClusterReconciler) createPreUpgradeBackupJob(stroomCluster *stroomv1.StroomCluster, dbBackup *stroomv1.DatabaseBackup, dbInfo *DatabaseConnectionInfo) *batchv1.Job {
+	labels := stroomCluster.GetLabels()
+	labels["app.kubernetes.io/component"] = "pre-upgrade-backup"
+
+	// Fail rather than retrying indefinitely, so the upgrade can be halted
+	var backoffLimit int32 = 2
+	jobSpec := createBackupJobSpec(dbBackup, dbInfo)
+	jobSpec.BackoffLimit = &backoffLimit
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      stroomCluster.Status.Upgrade.BackupJobName,
+			Namespace: stroomCluster.Namespace,
+			Labels:    labels,
+		},
+		Spec: jobSpec,
+	}
+
+	ctrl.SetControllerReference(stroomCluster, job, r.Scheme)
+	return job
+}
+
+// startUpgradeStep records the start of an upgrade phase, or the rollout of a NodeSet
+func (r *StroomClusterReconciler) startUpgradeStep(stroomCluster *stroomv1.StroomCluster, phase stroomv1.UpgradePhase, message string) {
+	now := metav1.Now()
+	stroomCluster.Status.Upgrade.StepStartTime = &now
+	r.setUpgradePhase(stroomCluster, phase, metav1.ConditionTrue, message)
+}
+
+// setUpgradePhase sets the upgrade phase and the corresponding Upgrading condition
+func (r *StroomClusterReconciler) setUpgradePhase(stroomCluster *stroomv1.StroomCluster, phase stroomv1.UpgradePhase, upgrading metav1.ConditionStatus, message string) {
+	stroomCluster.Status.Upgrade.Phase = phase
+	stroomCluster.Status.Upgrade.Message = message
+	r.setCondition(stroomCluster, stroomv1.UpgradingCondition, upgrading, string(phase), message)
+}
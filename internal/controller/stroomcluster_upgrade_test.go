@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"strings"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("StroomCluster upgrade", func() {
+
+	var stroomCluster stroomv1.StroomCluster
+
+	BeforeEach(func() {
+		stroomCluster = stroomv1.StroomCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev"},
+			Spec: stroomv1.StroomClusterSpec{
+				Image: stroomv1.Image{Repository: "gchq/stroom", Tag: "v7.3"},
+				NodeSets: []stroomv1.NodeSet{
+					{Name: "ui", Count: 1},
+					{Name: "data", Count: 3},
+					{Name: "ingest", Count: 2},
+				},
+				Upgrade: stroomv1.UpgradeSettings{NodeSetOrder: []string{"data"}},
+			},
+			Status: stroomv1.StroomClusterStatus{
+				Image: "gchq/stroom:v7.2",
+				Upgrade: stroomv1.UpgradeStatus{
+					Phase:       stroomv1.UpgradeRollingOutPhase,
+					FromImage:   "gchq/stroom:v7.2",
+					TargetImage: "gchq/stroom:v7.3",
+				},
+			},
+		}
+	})
+
+	Context("getNextNodeSetToUpgrade()", func() {
+		It("should upgrade NodeSets in the specified order first", func() {
+			Expect(getNextNodeSetToUpgrade(&stroomCluster)).Should(Equal("data"))
+		})
+		It("should upgrade unlisted NodeSets in the order they are defined", func() {
+			stroomCluster.Status.Upgrade.CompletedNodeSets = []string{"data"}
+			Expect(getNextNodeSetToUpgrade(&stroomCluster)).Should(Equal("ui"))
+
+			stroomCluster.Status.Upgrade.CompletedNodeSets = []string{"data", "ui"}
+			Expect(getNextNodeSetToUpgrade(&stroomCluster)).Should(Equal("ingest"))
+		})
+		It("should return nothing once all NodeSets are upgraded", func() {
+			stroomCluster.Status.Upgrade.CompletedNodeSets = []string{"data", "ui", "ingest"}
+			Expect(getNextNodeSetToUpgrade(&stroomCluster)).Should(BeEmpty())
+		})
+	})
+
+	Context("GetPreUpgradeBackupJobName()", func() {
+		It("should name the backup Job after the generation that started the upgrade", func() {
+			stroomCluster.Generation = 4
+			Expect(stroomCluster.GetPreUpgradeBackupJobName()).Should(Equal("stroom-dev-pre-upgrade-4"))
+			Expect(stroomCluster.GetPreUpgradeBackupJobName()).Should(Equal(stroomCluster.GetPreUpgradeBackupJobName()))
+		})
+
+		It("should keep the name of the backup Job within its limit", func() {
+			stroomCluster.Name = strings.Repeat("a", 60)
+			stroomCluster.Generation = 4
+			jobName := stroomCluster.GetPreUpgradeBackupJobName()
+			Expect(jobName).Should(HaveLen(stroomv1.JobNameMaxLength))
+			stroomCluster.Generation = 5
+			Expect(stroomCluster.GetPreUpgradeBackupJobName()).ShouldNot(Equal(jobName))
+		})
+	})
+
+	Context("getNodeSetImage()", func() {
+		It("should only run the target image on upgraded NodeSets", func() {
+			stroomCluster.Status.Upgrade.CompletedNodeSets = []string{"data"}
+			stroomCluster.Status.Upgrade.CurrentNodeSet = "ui"
+			Expect(getNodeSetImage(&stroomCluster, &stroomCluster.Spec.NodeSets[0])).Should(Equal("gchq/stroom:v7.3"))
+			Expect(getNodeSetImage(&stroomCluster, &stroomCluster.Spec.NodeSets[1])).Should(Equal("gchq/stroom:v7.3"))
+			Expect(getNodeSetImage(&stroomCluster, &stroomCluster.Spec.NodeSets[2])).Should(Equal("gchq/stroom:v7.2"))
+		})
+		It("should run the previous image on all NodeSets while the backup is pending", func() {
+			stroomCluster.Status.Upgrade.Phase = stroomv1.UpgradeBackingUpPhase
+			stroomCluster.Status.Upgrade.BackupJobName = "stroom-dev-pre-upgrade-1"
+			for _, nodeSet := range stroomCluster.Spec.NodeSets {
+				Expect(getNodeSetImage(&stroomCluster, &nodeSet)).Should(Equal("gchq/stroom:v7.2"))
+			}
+		})
+		It("should keep remaining NodeSets on the previous image after a failure", func() {
+			stroomCluster.Status.Upgrade.Phase = stroomv1.UpgradeFailedPhase
+			stroomCluster.Status.Upgrade.CurrentNodeSet = "data"
+			Expect(getNodeSetImage(&stroomCluster, &stroomCluster.Spec.NodeSets[1])).Should(Equal("gchq/stroom:v7.3"))
+			Expect(getNodeSetImage(&stroomCluster, &stroomCluster.Spec.NodeSets[2])).Should(Equal("gchq/stroom:v7.2"))
+		})
+		It("should run the StroomCluster image when no upgrade is in progress", func() {
+			stroomCluster.Status.Upgrade.Phase = stroomv1.UpgradeCompletePhase
+			Expect(getNodeSetImage(&stroomCluster, &stroomCluster.Spec.NodeSets[2])).Should(Equal("gchq/stroom:v7.3"))
+		})
+	})
+})
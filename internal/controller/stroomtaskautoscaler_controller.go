@@ -181,6 +181,7 @@ func (r *StroomTaskAutoscalerReconciler) scaleStroomNode(ctx context.Context, st
 				if err := GetDatabaseConnectionInfo(r.Client, ctx, &dbServerRef, stroomCluster.Namespace, &dbInfo); err != nil {
 					return err
 				}
+				dbInfo.useTenant(stroomCluster)
 				taskName := autoScaleOptions.TaskName
 				var activeTasks, taskLimit int
 				if err := r.getNodeTasks(ctx, stroomCluster, &dbInfo, podNamespacedName.Name, taskName, &activeTasks, &taskLimit); err == nil {
@@ -210,6 +211,7 @@ func (r *StroomTaskAutoscalerReconciler) scaleStroomNode(ctx context.Context, st
 						if err := r.updateNodeTaskLimit(ctx, stroomCluster, &dbInfo, podNamespacedName.Name, taskName, newTaskLimit); err != nil {
 							return err
 						}
+						recordTaskLimitChange(stroomCluster, podNamespacedName.Name, taskName, taskLimit, newTaskLimit)
 					}
 				}
 			}
@@ -222,7 +224,7 @@ func (r *StroomTaskAutoscalerReconciler) scaleStroomNode(ctx context.Context, st
 func (r *StroomTaskAutoscalerReconciler) getNodeTasks(ctx context.Context, stroomCluster *stroomv1.StroomCluster, dbInfo *DatabaseConnectionInfo, nodeName string, taskName string, activeTasks *int, taskLimit *int) error {
 	logger := log.FromContext(ctx)
 
-	if db, err := OpenDatabase(r, ctx, dbInfo, stroomCluster.Namespace, stroomCluster.Spec.AppDatabaseName); err != nil {
+	if db, err := OpenDatabase(r, ctx, dbInfo, stroomCluster.Namespace, dbInfo.GetDatabaseName(stroomCluster.Spec.AppDatabaseName)); err != nil {
 		return err
 	} else {
 		defer CloseDatabase(db)
@@ -246,7 +248,7 @@ func (r *StroomTaskAutoscalerReconciler) getNodeTasks(ctx context.Context, stroo
 func (r *StroomTaskAutoscalerReconciler) updateNodeTaskLimit(ctx context.Context, stroomCluster *stroomv1.StroomCluster, dbInfo *DatabaseConnectionInfo, nodeName string, taskName string, taskLimit int) error {
 	logger := log.FromContext(ctx)
 
-	if db, err := OpenDatabase(r, ctx, dbInfo, stroomCluster.Namespace, stroomCluster.Spec.AppDatabaseName); err != nil {
+	if db, err := OpenDatabase(r, ctx, dbInfo, stroomCluster.Namespace, dbInfo.GetDatabaseName(stroomCluster.Spec.AppDatabaseName)); err != nil {
 		return err
 	} else {
 		defer CloseDatabase(db)
@@ -301,5 +303,5 @@ func (r *StroomTaskAutoscalerReconciler) SetupWithManager(mgr ctrl.Manager) erro
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&stroomv1.StroomTaskAutoscaler{}).
-		Complete(r)
+		Complete(instrumentReconciler("StroomTaskAutoscaler", r))
 }
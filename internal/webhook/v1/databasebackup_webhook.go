@@ -0,0 +1,122 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"net/url"
+	"slices"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var databasebackuplog = logf.Log.WithName("databasebackup-resource")
+
+// SetupDatabaseBackupWebhookWithManager registers the webhooks for DatabaseBackup in the manager
+func SetupDatabaseBackupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &stroomv1.DatabaseBackup{}).
+		WithValidator(&DatabaseBackupCustomValidator{}).
+		WithDefaulter(&DatabaseBackupCustomDefaulter{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-stroom-gchq-github-io-v1-databasebackup,mutating=true,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=databasebackups,verbs=create;update,versions=v1,name=mdatabasebackup-v1.kb.io,admissionReviewVersions=v1
+
+// DatabaseBackupCustomDefaulter sets default values on DatabaseBackup resources when they are created or updated
+type DatabaseBackupCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *DatabaseBackupCustomDefaulter) Default(_ context.Context, databaseBackup *stroomv1.DatabaseBackup) error {
+	databasebackuplog.V(1).Info("Defaulting", "Namespace", databaseBackup.Namespace, "Name", databaseBackup.Name)
+
+	// A DatabaseServer without a namespace is resolved in the namespace of the DatabaseBackup
+	serverRef := &databaseBackup.Spec.DatabaseServerRef.ServerRef
+	if serverRef.Name != "" && serverRef.Namespace == "" {
+		serverRef.Namespace = databaseBackup.Namespace
+	}
+
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-stroom-gchq-github-io-v1-databasebackup,mutating=false,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=databasebackups,verbs=create;update,versions=v1,name=vdatabasebackup-v1.kb.io,admissionReviewVersions=v1
+
+// DatabaseBackupCustomValidator validates DatabaseBackup resources when they are created or updated
+type DatabaseBackupCustomValidator struct{}
+
+// ValidateCreate implements admission.Validator
+func (v *DatabaseBackupCustomValidator) ValidateCreate(_ context.Context, databaseBackup *stroomv1.DatabaseBackup) (admission.Warnings, error) {
+	databasebackuplog.V(1).Info("Validating create", "Namespace", databaseBackup.Namespace, "Name", databaseBackup.Name)
+
+	return nil, toInvalidError("DatabaseBackup", databaseBackup.Name, validateDatabaseBackupSpec(&databaseBackup.Spec))
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *DatabaseBackupCustomValidator) ValidateUpdate(_ context.Context, _, databaseBackup *stroomv1.DatabaseBackup) (admission.Warnings, error) {
+	databasebackuplog.V(1).Info("Validating update", "Namespace", databaseBackup.Namespace, "Name", databaseBackup.Name)
+
+	return nil, toInvalidError("DatabaseBackup", databaseBackup.Name, validateDatabaseBackupSpec(&databaseBackup.Spec))
+}
+
+// ValidateDelete implements admission.Validator
+func (v *DatabaseBackupCustomValidator) ValidateDelete(_ context.Context, _ *stroomv1.DatabaseBackup) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateDatabaseBackupSpec(spec *stroomv1.DatabaseBackupSpec) field.ErrorList {
+	specPath := field.NewPath("spec")
+	allErrs := validateDatabaseServerRef(&spec.DatabaseServerRef, specPath.Child("databaseServerRef"))
+	allErrs = append(allErrs, validateDatabaseNames(spec.DatabaseNames, specPath.Child("databaseNames"))...)
+	allErrs = append(allErrs, validateCronSchedule(spec.Schedule, specPath.Child("schedule"))...)
+
+	if spec.TargetVolume == nil && spec.ObjectStorage == nil {
+		allErrs = append(allErrs, field.Required(specPath.Child("volume"), "either volume or objectStorage must be specified"))
+	}
+	if objectStorage := spec.ObjectStorage; objectStorage != nil {
+		objectStoragePath := specPath.Child("objectStorage")
+		if objectStorage.Endpoint != "" {
+			if endpoint, err := url.Parse(objectStorage.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+				allErrs = append(allErrs, field.Invalid(objectStoragePath.Child("endpoint"), objectStorage.Endpoint, "must be an http or https URL"))
+			}
+		}
+		if objectStorage.KmsKeyId != "" && objectStorage.ServerSideEncryption != "aws:kms" {
+			allErrs = append(allErrs, field.Invalid(objectStoragePath.Child("kmsKeyId"), objectStorage.KmsKeyId, "only applies when serverSideEncryption is aws:kms"))
+		}
+	}
+	if verify := spec.Verify; verify != nil {
+		verifyPath := specPath.Child("verify")
+		if verify.Schedule != "" {
+			allErrs = append(allErrs, validateCronSchedule(verify.Schedule, verifyPath.Child("schedule"))...)
+		}
+		for i, table := range verify.Tables {
+			tablePath := verifyPath.Child("tables").Index(i)
+			if !databaseNamePattern.MatchString(table.Database) {
+				allErrs = append(allErrs, field.Invalid(tablePath.Child("database"), table.Database, "must be a valid MySQL database name"))
+			} else if len(spec.DatabaseNames) > 0 && !slices.Contains(spec.DatabaseNames, table.Database) {
+				allErrs = append(allErrs, field.Invalid(tablePath.Child("database"), table.Database, "database is not included in databaseNames"))
+			}
+			if !databaseNamePattern.MatchString(table.Table) {
+				allErrs = append(allErrs, field.Invalid(tablePath.Child("table"), table.Table, "must be a valid MySQL table name"))
+			}
+		}
+	}
+
+	return allErrs
+}
@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"context"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("DatabaseBackup webhook", func() {
+
+	var (
+		ctx            = context.Background()
+		validator      DatabaseBackupCustomValidator
+		databaseBackup *stroomv1.DatabaseBackup
+	)
+
+	BeforeEach(func() {
+		databaseBackup = &stroomv1.DatabaseBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.DatabaseBackupSpec{
+				Image:             stroomv1.Image{Repository: "mysql/mysql-server", Tag: "8.0.26"},
+				DatabaseServerRef: stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev"}},
+				DatabaseNames:     []string{"stroom", "stats"},
+				Schedule:          "0 0 * * *",
+				TargetVolume:      &corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			},
+		}
+	})
+
+	It("should admit a valid DatabaseBackup", func() {
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should admit a predefined schedule", func() {
+		databaseBackup.Spec.Schedule = "@daily"
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should deny an invalid cron schedule", func() {
+		databaseBackup.Spec.Schedule = "0 0 * *"
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).To(MatchError(ContainSubstring("spec.schedule")))
+	})
+	It("should deny an invalid database name", func() {
+		databaseBackup.Spec.DatabaseNames = []string{"stroom; DROP DATABASE stats"}
+		_, err := validator.ValidateUpdate(ctx, databaseBackup, databaseBackup)
+		Expect(err).To(MatchError(ContainSubstring("spec.databaseNames[0]")))
+	})
+	It("should require a secret for an external server address", func() {
+		databaseBackup.Spec.DatabaseServerRef = stroomv1.DatabaseServerRef{ServerAddress: stroomv1.ServerAddress{Host: "mysql", Port: 3306}}
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).To(MatchError(ContainSubstring("spec.databaseServerRef.serverAddress.secretName")))
+	})
+	It("should accept a password read from a file", func() {
+		databaseBackup.Spec.DatabaseServerRef = stroomv1.DatabaseServerRef{ServerAddress: stroomv1.ServerAddress{
+			Host: "mysql",
+			Port: 3306,
+			PasswordFile: &stroomv1.PasswordFileSource{
+				Volume:       corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "secrets-store.csi.k8s.io"}},
+				Path:         "password",
+				OperatorPath: "/etc/stroom-operator/credentials/password",
+			},
+		}}
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).NotTo(HaveOccurred())
+
+		databaseBackup.Spec.DatabaseServerRef.ServerAddress.PasswordSecretKeyRef = &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "db"},
+			Key:                  "password",
+		}
+		_, err = validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).To(MatchError(ContainSubstring("only one of passwordSecretKeyRef or passwordFile")))
+	})
+	It("should require a volume or object storage", func() {
+		databaseBackup.Spec.TargetVolume = nil
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).To(MatchError(ContainSubstring("spec.volume")))
+	})
+	It("should admit an S3-compatible endpoint without a volume", func() {
+		databaseBackup.Spec.TargetVolume = nil
+		databaseBackup.Spec.ObjectStorage = &stroomv1.BackupObjectStorage{
+			Image:                 stroomv1.Image{Repository: "amazon/aws-cli"},
+			Bucket:                "backups",
+			Endpoint:              "http://minio.minio.svc:9000",
+			CredentialsSecretName: "minio-credentials",
+		}
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should deny an invalid object storage endpoint", func() {
+		databaseBackup.Spec.ObjectStorage = &stroomv1.BackupObjectStorage{
+			Bucket:                "backups",
+			Endpoint:              "minio:9000",
+			CredentialsSecretName: "minio-credentials",
+		}
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).To(MatchError(ContainSubstring("spec.objectStorage.endpoint")))
+	})
+	It("should deny verification of a database that is not backed up", func() {
+		databaseBackup.Spec.DatabaseNames = []string{"stroom"}
+		databaseBackup.Spec.Verify = &stroomv1.BackupVerification{
+			Schedule: "@weekly",
+			Tables:   []stroomv1.BackupTableCheck{{Database: "stroom", Table: "node"}, {Database: "stats", Table: "SQL_STAT_KEY"}},
+		}
+		_, err := validator.ValidateCreate(ctx, databaseBackup)
+		Expect(err).To(MatchError(ContainSubstring("spec.verify.tables[1].database")))
+	})
+})
@@ -0,0 +1,119 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var databaserestorelog = logf.Log.WithName("databaserestore-resource")
+
+// SetupDatabaseRestoreWebhookWithManager registers the webhooks for DatabaseRestore in the manager
+func SetupDatabaseRestoreWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &stroomv1.DatabaseRestore{}).
+		WithValidator(&DatabaseRestoreCustomValidator{}).
+		WithDefaulter(&DatabaseRestoreCustomDefaulter{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-stroom-gchq-github-io-v1-databaserestore,mutating=true,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=databaserestores,verbs=create;update,versions=v1,name=mdatabaserestore-v1.kb.io,admissionReviewVersions=v1
+
+// DatabaseRestoreCustomDefaulter sets default values on DatabaseRestore resources when they are created or updated
+type DatabaseRestoreCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *DatabaseRestoreCustomDefaulter) Default(_ context.Context, databaseRestore *stroomv1.DatabaseRestore) error {
+	databaserestorelog.V(1).Info("Defaulting", "Namespace", databaseRestore.Namespace, "Name", databaseRestore.Name)
+
+	// A DatabaseServer without a namespace is resolved in the namespace of the DatabaseRestore
+	serverRef := &databaseRestore.Spec.DatabaseServerRef.ServerRef
+	if serverRef.Name != "" && serverRef.Namespace == "" {
+		serverRef.Namespace = databaseRestore.Namespace
+	}
+
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-stroom-gchq-github-io-v1-databaserestore,mutating=false,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=databaserestores,verbs=create;update,versions=v1,name=vdatabaserestore-v1.kb.io,admissionReviewVersions=v1
+
+// DatabaseRestoreCustomValidator validates DatabaseRestore resources when they are created or updated
+type DatabaseRestoreCustomValidator struct{}
+
+// ValidateCreate implements admission.Validator
+func (v *DatabaseRestoreCustomValidator) ValidateCreate(_ context.Context, databaseRestore *stroomv1.DatabaseRestore) (admission.Warnings, error) {
+	databaserestorelog.V(1).Info("Validating create", "Namespace", databaseRestore.Namespace, "Name", databaseRestore.Name)
+
+	return nil, toInvalidError("DatabaseRestore", databaseRestore.Name, validateDatabaseRestoreSpec(&databaseRestore.Spec))
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *DatabaseRestoreCustomValidator) ValidateUpdate(_ context.Context, oldDatabaseRestore, databaseRestore *stroomv1.DatabaseRestore) (admission.Warnings, error) {
+	databaserestorelog.V(1).Info("Validating update", "Namespace", databaseRestore.Namespace, "Name", databaseRestore.Name)
+
+	// A restore runs once, so changes to its spec would not be acted upon
+	allErrs := field.ErrorList{}
+	if !equality.Semantic.DeepEqual(oldDatabaseRestore.Spec, databaseRestore.Spec) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"), "field is immutable. Create a new DatabaseRestore instead"))
+	}
+	return nil, toInvalidError("DatabaseRestore", databaseRestore.Name, allErrs)
+}
+
+// ValidateDelete implements admission.Validator
+func (v *DatabaseRestoreCustomValidator) ValidateDelete(_ context.Context, _ *stroomv1.DatabaseRestore) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateDatabaseRestoreSpec(spec *stroomv1.DatabaseRestoreSpec) field.ErrorList {
+	specPath := field.NewPath("spec")
+	allErrs := validateDatabaseServerRef(&spec.DatabaseServerRef, specPath.Child("databaseServerRef"))
+
+	if spec.BackupName == "" {
+		if spec.SourceVolume == nil {
+			allErrs = append(allErrs, field.Required(specPath.Child("backupName"), "either backupName or volume must be specified"))
+		}
+		if spec.ArchivePath == stroomv1.LatestArchivePath || spec.ArchivePath == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("backupName"), "required to restore the latest archive"))
+		}
+	}
+
+	if spec.ArchivePath != "" && spec.ArchivePath != stroomv1.LatestArchivePath {
+		archivePath := specPath.Child("archivePath")
+		if path.IsAbs(spec.ArchivePath) {
+			allErrs = append(allErrs, field.Invalid(archivePath, spec.ArchivePath, "must be relative to the root of the volume"))
+		} else if cleanPath := path.Clean(spec.ArchivePath); cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+			allErrs = append(allErrs, field.Invalid(archivePath, spec.ArchivePath, "must not refer to a location outside the volume"))
+		} else if !strings.HasSuffix(spec.ArchivePath, ".sql.gz") {
+			allErrs = append(allErrs, field.Invalid(archivePath, spec.ArchivePath, "must be a compressed archive (.sql.gz)"))
+		}
+	}
+
+	if spec.PointInTime != nil && spec.PointInTime.After(time.Now()) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("pointInTime"), spec.PointInTime.UTC().Format(time.RFC3339), "must not be in the future"))
+	}
+
+	return allErrs
+}
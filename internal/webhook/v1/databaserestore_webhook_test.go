@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"context"
+	"time"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("DatabaseRestore webhook", func() {
+
+	var (
+		ctx             = context.Background()
+		validator       DatabaseRestoreCustomValidator
+		databaseRestore *stroomv1.DatabaseRestore
+	)
+
+	BeforeEach(func() {
+		databaseRestore = &stroomv1.DatabaseRestore{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.DatabaseRestoreSpec{
+				Image:             stroomv1.Image{Repository: "mysql/mysql-server", Tag: "8.0.26"},
+				DatabaseServerRef: stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev"}},
+				BackupName:        "dev",
+				ArchivePath:       stroomv1.LatestArchivePath,
+			},
+		}
+	})
+
+	It("should admit the latest archive of a DatabaseBackup", func() {
+		_, err := validator.ValidateCreate(ctx, databaseRestore)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should admit an archive path within a volume", func() {
+		databaseRestore.Spec.BackupName = ""
+		databaseRestore.Spec.SourceVolume = &corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+		databaseRestore.Spec.ArchivePath = "2026-10/dev_2026-10-17_01-00-00.sql.gz"
+		_, err := validator.ValidateCreate(ctx, databaseRestore)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should require a DatabaseBackup to restore the latest archive", func() {
+		databaseRestore.Spec.BackupName = ""
+		databaseRestore.Spec.SourceVolume = &corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+		_, err := validator.ValidateCreate(ctx, databaseRestore)
+		Expect(err).To(MatchError(ContainSubstring("spec.backupName")))
+	})
+	It("should deny an archive path outside the volume", func() {
+		databaseRestore.Spec.ArchivePath = "../other/dev_2026-10-17_01-00-00.sql.gz"
+		_, err := validator.ValidateCreate(ctx, databaseRestore)
+		Expect(err).To(MatchError(ContainSubstring("spec.archivePath")))
+	})
+	It("should deny a point in time in the future", func() {
+		databaseRestore.Spec.PointInTime = &metav1.Time{Time: time.Now().Add(time.Hour)}
+		_, err := validator.ValidateCreate(ctx, databaseRestore)
+		Expect(err).To(MatchError(ContainSubstring("spec.pointInTime")))
+	})
+	It("should deny changes to the spec", func() {
+		oldDatabaseRestore := databaseRestore.DeepCopy()
+		databaseRestore.Spec.ArchivePath = "2026-10/dev_2026-10-17_01-00-00.sql.gz"
+		_, err := validator.ValidateUpdate(ctx, oldDatabaseRestore, databaseRestore)
+		Expect(err).To(MatchError(ContainSubstring("spec")))
+	})
+})
@@ -0,0 +1,128 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var databaseserverlog = logf.Log.WithName("databaseserver-resource")
+
+// SetupDatabaseServerWebhookWithManager registers the webhooks for DatabaseServer in the manager
+func SetupDatabaseServerWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &stroomv1.DatabaseServer{}).
+		WithValidator(&DatabaseServerCustomValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-stroom-gchq-github-io-v1-databaseserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=databaseservers,verbs=create;update,versions=v1,name=vdatabaseserver-v1.kb.io,admissionReviewVersions=v1
+
+// DatabaseServerCustomValidator validates DatabaseServer resources when they are created or updated
+type DatabaseServerCustomValidator struct{}
+
+// ValidateCreate implements admission.Validator
+func (v *DatabaseServerCustomValidator) ValidateCreate(_ context.Context, databaseServer *stroomv1.DatabaseServer) (admission.Warnings, error) {
+	databaseserverlog.V(1).Info("Validating create", "Namespace", databaseServer.Namespace, "Name", databaseServer.Name)
+
+	return nil, toInvalidError("DatabaseServer", databaseServer.Name, validateDatabaseServerSpec(&databaseServer.Spec))
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *DatabaseServerCustomValidator) ValidateUpdate(_ context.Context, oldDatabaseServer, databaseServer *stroomv1.DatabaseServer) (admission.Warnings, error) {
+	databaseserverlog.V(1).Info("Validating update", "Namespace", databaseServer.Namespace, "Name", databaseServer.Name)
+
+	allErrs := validateDatabaseServerSpec(&databaseServer.Spec)
+
+	// Volume claim templates of a StatefulSet cannot be changed
+	if !equality.Semantic.DeepEqual(databaseServer.Spec.VolumeClaim, oldDatabaseServer.Spec.VolumeClaim) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "volumeClaim"), "field is immutable"))
+	}
+	// Instances cannot be converted between topologies
+	if databaseServer.Spec.Topology != oldDatabaseServer.Spec.Topology {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "topology"), "field is immutable"))
+	}
+	// StroomClusters would otherwise switch to different users and databases
+	if databaseServer.Spec.MultiTenant != oldDatabaseServer.Spec.MultiTenant {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "multiTenant"), "field is immutable"))
+	}
+
+	return nil, toInvalidError("DatabaseServer", databaseServer.Name, allErrs)
+}
+
+// ValidateDelete implements admission.Validator
+func (v *DatabaseServerCustomValidator) ValidateDelete(_ context.Context, _ *stroomv1.DatabaseServer) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// systemDatabaseNames are the databases MySQL requires
+var systemDatabaseNames = []string{"mysql", "sys", "information_schema", "performance_schema"}
+
+func validateDatabaseServerSpec(spec *stroomv1.DatabaseServerSpec) field.ErrorList {
+	specPath := field.NewPath("spec")
+	allErrs := field.ErrorList{}
+
+	if spec.Image.Repository == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("image", "repository"), "an image repository must be specified"))
+	}
+	if len(spec.DatabaseNames) == 0 && !spec.MultiTenant {
+		allErrs = append(allErrs, field.Required(specPath.Child("databaseNames"), "at least one database name must be specified"))
+	}
+	allErrs = append(allErrs, validateDatabaseNames(spec.DatabaseNames, specPath.Child("databaseNames"))...)
+	for i, name := range spec.DatabaseNames {
+		if slices.Contains(systemDatabaseNames, strings.ToLower(name)) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("databaseNames").Index(i), "system databases cannot be granted to the Stroom service user"))
+		}
+	}
+	allErrs = append(allErrs, validateDatabaseNames(spec.DropDatabaseNames, specPath.Child("dropDatabaseNames"))...)
+	for i, name := range spec.DropDatabaseNames {
+		if slices.Contains(spec.DatabaseNames, name) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("dropDatabaseNames").Index(i), name, "database is listed in databaseNames"))
+		} else if slices.Contains(systemDatabaseNames, strings.ToLower(name)) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("dropDatabaseNames").Index(i), "system databases cannot be dropped"))
+		}
+	}
+
+	switch spec.Topology {
+	case stroomv1.GroupReplicationTopology:
+		// A group of fewer than three members cannot tolerate the failure of any member
+		if spec.Replicas < 3 {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("replicas"), spec.Replicas, "a replication group requires at least 3 replicas"))
+		}
+	default:
+		if spec.Replicas > 1 {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("replicas"), spec.Replicas, "a standalone server has exactly 1 replica"))
+		}
+	}
+
+	if binaryLog := spec.BinaryLog; binaryLog != nil {
+		for _, msg := range validation.IsDNS1123Subdomain(binaryLog.BackupName) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("binaryLog", "backupName"), binaryLog.BackupName, msg))
+		}
+	}
+
+	return allErrs
+}
@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"context"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("DatabaseServer webhook", func() {
+
+	var (
+		ctx            = context.Background()
+		validator      DatabaseServerCustomValidator
+		databaseServer *stroomv1.DatabaseServer
+	)
+
+	BeforeEach(func() {
+		databaseServer = &stroomv1.DatabaseServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.DatabaseServerSpec{
+				Image:         stroomv1.Image{Repository: "mysql/mysql-server", Tag: "8.0.26"},
+				DatabaseNames: []string{"stroom", "stats"},
+			},
+		}
+	})
+
+	It("should admit a valid DatabaseServer", func() {
+		_, err := validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should deny duplicate database names", func() {
+		databaseServer.Spec.DatabaseNames = []string{"stroom", "stroom"}
+		_, err := validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).To(MatchError(ContainSubstring("spec.databaseNames[1]: Duplicate value")))
+	})
+	It("should deny an invalid binary log backup name", func() {
+		databaseServer.Spec.BinaryLog = &stroomv1.BinaryLogSettings{BackupName: "Dev_Backup"}
+		_, err := validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).To(MatchError(ContainSubstring("spec.binaryLog.backupName")))
+	})
+	It("should require at least 3 replicas for group replication", func() {
+		databaseServer.Spec.Topology = stroomv1.GroupReplicationTopology
+		databaseServer.Spec.Replicas = 2
+		_, err := validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).To(MatchError(ContainSubstring("spec.replicas")))
+
+		databaseServer.Spec.Replicas = 3
+		_, err = validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should deny multiple replicas of a standalone server", func() {
+		databaseServer.Spec.Replicas = 3
+		_, err := validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).To(MatchError(ContainSubstring("spec.replicas")))
+	})
+	It("should deny changing the topology", func() {
+		updated := databaseServer.DeepCopy()
+		updated.Spec.Topology = stroomv1.GroupReplicationTopology
+		updated.Spec.Replicas = 3
+		_, err := validator.ValidateUpdate(ctx, databaseServer, updated)
+		Expect(err).To(MatchError(ContainSubstring("spec.topology")))
+	})
+	It("should admit a multi-tenant DatabaseServer without database names", func() {
+		databaseServer.Spec.MultiTenant = true
+		databaseServer.Spec.DatabaseNames = nil
+		_, err := validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should deny changing the tenancy", func() {
+		updated := databaseServer.DeepCopy()
+		updated.Spec.MultiTenant = true
+		_, err := validator.ValidateUpdate(ctx, databaseServer, updated)
+		Expect(err).To(MatchError(ContainSubstring("spec.multiTenant")))
+	})
+	It("should only drop databases that are no longer listed", func() {
+		databaseServer.Spec.DropDatabaseNames = []string{"stats_old"}
+		_, err := validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).NotTo(HaveOccurred())
+
+		databaseServer.Spec.DropDatabaseNames = []string{"stats"}
+		_, err = validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).To(MatchError(ContainSubstring("spec.dropDatabaseNames[0]")))
+	})
+	It("should deny dropping a system database", func() {
+		databaseServer.Spec.DropDatabaseNames = []string{"mysql"}
+		_, err := validator.ValidateCreate(ctx, databaseServer)
+		Expect(err).To(MatchError(ContainSubstring("system databases cannot be dropped")))
+	})
+	It("should deny changing the volume claim", func() {
+		updated := databaseServer.DeepCopy()
+		updated.Spec.VolumeClaim.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}
+		_, err := validator.ValidateUpdate(ctx, databaseServer, updated)
+		Expect(err).To(MatchError(ContainSubstring("spec.volumeClaim")))
+	})
+})
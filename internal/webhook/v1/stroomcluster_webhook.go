@@ -0,0 +1,180 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var stroomclusterlog = logf.Log.WithName("stroomcluster-resource")
+
+// SetupStroomClusterWebhookWithManager registers the webhooks for StroomCluster in the manager
+func SetupStroomClusterWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &stroomv1.StroomCluster{}).
+		WithValidator(&StroomClusterCustomValidator{}).
+		WithDefaulter(&StroomClusterCustomDefaulter{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-stroom-gchq-github-io-v1-stroomcluster,mutating=true,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=stroomclusters,verbs=create;update,versions=v1,name=mstroomcluster-v1.kb.io,admissionReviewVersions=v1
+
+// StroomClusterCustomDefaulter sets default values on StroomCluster resources when they are created or updated
+type StroomClusterCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *StroomClusterCustomDefaulter) Default(_ context.Context, stroomCluster *stroomv1.StroomCluster) error {
+	stroomclusterlog.V(1).Info("Defaulting", "Namespace", stroomCluster.Namespace, "Name", stroomCluster.Name)
+
+	// A DatabaseServer without a namespace is resolved in the namespace of the StroomCluster
+	serverRefs := []*stroomv1.ResourceRef{&stroomCluster.Spec.DatabaseServerRef.ServerRef}
+	if stroomCluster.Spec.StatsDatabaseServerRef != nil {
+		serverRefs = append(serverRefs, &stroomCluster.Spec.StatsDatabaseServerRef.ServerRef)
+	}
+	for _, serverRef := range serverRefs {
+		if serverRef.Name != "" && serverRef.Namespace == "" {
+			serverRef.Namespace = stroomCluster.Namespace
+		}
+	}
+
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-stroom-gchq-github-io-v1-stroomcluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=stroomclusters,verbs=create;update,versions=v1,name=vstroomcluster-v1.kb.io,admissionReviewVersions=v1
+
+// StroomClusterCustomValidator validates StroomCluster resources when they are created or updated
+type StroomClusterCustomValidator struct{}
+
+// ValidateCreate implements admission.Validator
+func (v *StroomClusterCustomValidator) ValidateCreate(_ context.Context, stroomCluster *stroomv1.StroomCluster) (admission.Warnings, error) {
+	stroomclusterlog.V(1).Info("Validating create", "Namespace", stroomCluster.Namespace, "Name", stroomCluster.Name)
+
+	return nil, toInvalidError("StroomCluster", stroomCluster.Name, validateStroomClusterSpec(&stroomCluster.Spec))
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *StroomClusterCustomValidator) ValidateUpdate(_ context.Context, oldStroomCluster, stroomCluster *stroomv1.StroomCluster) (admission.Warnings, error) {
+	stroomclusterlog.V(1).Info("Validating update", "Namespace", stroomCluster.Namespace, "Name", stroomCluster.Name)
+
+	allErrs := validateStroomClusterSpec(&stroomCluster.Spec)
+	allErrs = append(allErrs, validateStroomClusterSpecUpdate(&oldStroomCluster.Spec, &stroomCluster.Spec)...)
+	return nil, toInvalidError("StroomCluster", stroomCluster.Name, allErrs)
+}
+
+// ValidateDelete implements admission.Validator
+func (v *StroomClusterCustomValidator) ValidateDelete(_ context.Context, _ *stroomv1.StroomCluster) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateStroomClusterSpec(spec *stroomv1.StroomClusterSpec) field.ErrorList {
+	specPath := field.NewPath("spec")
+	allErrs := validateDatabaseServerRef(&spec.DatabaseServerRef, specPath.Child("databaseServerRef"))
+	if spec.StatsDatabaseServerRef != nil {
+		allErrs = append(allErrs, validateDatabaseServerRef(spec.StatsDatabaseServerRef, specPath.Child("statsDatabaseServerRef"))...)
+	}
+
+	nodeSetNames := make(map[string]bool)
+	for i, nodeSet := range spec.NodeSets {
+		nodeSetPath := specPath.Child("nodeSets").Index(i)
+		if nodeSet.Name == "" {
+			allErrs = append(allErrs, field.Required(nodeSetPath.Child("name"), "NodeSet name must be specified"))
+		} else if errs := validation.IsDNS1123Label(nodeSet.Name); len(errs) > 0 {
+			for _, msg := range errs {
+				allErrs = append(allErrs, field.Invalid(nodeSetPath.Child("name"), nodeSet.Name, msg))
+			}
+		} else if nodeSetNames[nodeSet.Name] {
+			allErrs = append(allErrs, field.Duplicate(nodeSetPath.Child("name"), nodeSet.Name))
+		}
+		nodeSetNames[nodeSet.Name] = true
+
+		memoryOptions := nodeSet.MemoryOptions
+		if memoryOptions.InitialPercentage > 0 && memoryOptions.MaxPercentage > 0 && memoryOptions.InitialPercentage > memoryOptions.MaxPercentage {
+			allErrs = append(allErrs, field.Invalid(nodeSetPath.Child("memoryOptions", "initialPercentage"), memoryOptions.InitialPercentage,
+				fmt.Sprintf("must not be greater than maxPercentage (%v)", memoryOptions.MaxPercentage)))
+		}
+	}
+
+	for i, name := range spec.Upgrade.NodeSetOrder {
+		if !nodeSetNames[name] {
+			allErrs = append(allErrs, field.NotFound(specPath.Child("upgrade", "nodeSetOrder").Index(i), name))
+		}
+	}
+
+	return allErrs
+}
+
+// validateStroomClusterSpecUpdate blocks changes to fields that cannot be changed once the StroomCluster is deployed
+func validateStroomClusterSpecUpdate(oldSpec *stroomv1.StroomClusterSpec, spec *stroomv1.StroomClusterSpec) field.ErrorList {
+	specPath := field.NewPath("spec")
+	allErrs := field.ErrorList{}
+
+	if spec.AppDatabaseName != oldSpec.AppDatabaseName {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("appDatabaseName"), "field is immutable"))
+	}
+	if spec.StatsDatabaseName != oldSpec.StatsDatabaseName {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("statsDatabaseName"), "field is immutable"))
+	}
+
+	oldNodeSets := make(map[string]*stroomv1.NodeSet)
+	for i := range oldSpec.NodeSets {
+		oldNodeSets[oldSpec.NodeSets[i].Name] = &oldSpec.NodeSets[i]
+	}
+
+	nodeSetsAdded := false
+	for i, nodeSet := range spec.NodeSets {
+		nodeSetPath := specPath.Child("nodeSets").Index(i)
+		if oldNodeSet, exists := oldNodeSets[nodeSet.Name]; exists {
+			// Volume claim templates of a StatefulSet cannot be changed
+			if !equality.Semantic.DeepEqual(nodeSet.LocalDataVolumeClaim, oldNodeSet.LocalDataVolumeClaim) {
+				allErrs = append(allErrs, field.Forbidden(nodeSetPath.Child("localDataVolumeClaim"), "field is immutable"))
+			}
+		} else {
+			nodeSetsAdded = true
+		}
+	}
+
+	// A NodeSet is only removed if no NodeSet is added by the same change. Otherwise, it may have been renamed, which
+	// would replace its StatefulSet and leave its PVCs behind.
+	if nodeSetsAdded {
+		for _, oldNodeSet := range oldSpec.NodeSets {
+			if _, retained := nodeSetIndex(spec.NodeSets, oldNodeSet.Name); !retained {
+				allErrs = append(allErrs, field.Forbidden(specPath.Child("nodeSets"),
+					fmt.Sprintf("NodeSet '%v' cannot be renamed. Remove it and add the new NodeSet as separate changes", oldNodeSet.Name)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func nodeSetIndex(nodeSets []stroomv1.NodeSet, name string) (int, bool) {
+	for i, nodeSet := range nodeSets {
+		if nodeSet.Name == name {
+			return i, true
+		}
+	}
+
+	return -1, false
+}
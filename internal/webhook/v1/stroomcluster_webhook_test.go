@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"context"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("StroomCluster webhook", func() {
+
+	var (
+		ctx           = context.Background()
+		validator     StroomClusterCustomValidator
+		defaulter     StroomClusterCustomDefaulter
+		stroomCluster *stroomv1.StroomCluster
+	)
+
+	BeforeEach(func() {
+		stroomCluster = &stroomv1.StroomCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.StroomClusterSpec{
+				Image:             stroomv1.Image{Repository: "gchq/stroom", Tag: "v7.2"},
+				DatabaseServerRef: stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "dev"}},
+				AppDatabaseName:   "stroom",
+				StatsDatabaseName: "stats",
+				NodeSets: []stroomv1.NodeSet{
+					{Name: "data", Count: 3, MemoryOptions: stroomv1.JvmMemoryOptions{InitialPercentage: 50, MaxPercentage: 75}},
+					{Name: "ui", Count: 1},
+				},
+			},
+		}
+	})
+
+	Context("Defaulting", func() {
+		It("should resolve the DatabaseServer in the StroomCluster namespace", func() {
+			Expect(defaulter.Default(ctx, stroomCluster)).To(Succeed())
+			Expect(stroomCluster.Spec.DatabaseServerRef.ServerRef.Namespace).To(Equal("stroom"))
+		})
+		It("should resolve the statistics DatabaseServer in the StroomCluster namespace", func() {
+			stroomCluster.Spec.StatsDatabaseServerRef = &stroomv1.DatabaseServerRef{ServerRef: stroomv1.ResourceRef{Name: "stats"}}
+			Expect(defaulter.Default(ctx, stroomCluster)).To(Succeed())
+			Expect(stroomCluster.Spec.StatsDatabaseServerRef.ServerRef.Namespace).To(Equal("stroom"))
+		})
+	})
+
+	Context("Validating create", func() {
+		It("should admit a valid StroomCluster", func() {
+			_, err := validator.ValidateCreate(ctx, stroomCluster)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("should deny duplicate NodeSet names", func() {
+			stroomCluster.Spec.NodeSets[1].Name = "data"
+			_, err := validator.ValidateCreate(ctx, stroomCluster)
+			Expect(err).To(MatchError(ContainSubstring("spec.nodeSets[1].name: Duplicate value")))
+		})
+		It("should deny an initial memory percentage greater than the maximum", func() {
+			stroomCluster.Spec.NodeSets[0].MemoryOptions.InitialPercentage = 80
+			_, err := validator.ValidateCreate(ctx, stroomCluster)
+			Expect(err).To(MatchError(ContainSubstring("spec.nodeSets[0].memoryOptions.initialPercentage")))
+		})
+		It("should deny both a DatabaseServer and an external server address", func() {
+			stroomCluster.Spec.DatabaseServerRef.ServerAddress = stroomv1.ServerAddress{Host: "mysql", Port: 3306, SecretName: "db"}
+			_, err := validator.ValidateCreate(ctx, stroomCluster)
+			Expect(err).To(MatchError(ContainSubstring("only one of serverRef or serverAddress")))
+		})
+		It("should deny an upgrade order referencing an unknown NodeSet", func() {
+			stroomCluster.Spec.Upgrade.NodeSetOrder = []string{"ui", "processing"}
+			_, err := validator.ValidateCreate(ctx, stroomCluster)
+			Expect(err).To(MatchError(ContainSubstring("spec.upgrade.nodeSetOrder[1]: Not found")))
+		})
+		It("should deny a statistics database server without a server", func() {
+			stroomCluster.Spec.StatsDatabaseServerRef = &stroomv1.DatabaseServerRef{}
+			_, err := validator.ValidateCreate(ctx, stroomCluster)
+			Expect(err).To(MatchError(ContainSubstring("spec.statsDatabaseServerRef")))
+		})
+		It("should deny a missing database server", func() {
+			stroomCluster.Spec.DatabaseServerRef = stroomv1.DatabaseServerRef{ServerAddress: stroomv1.ServerAddress{Port: 3306}}
+			_, err := validator.ValidateCreate(ctx, stroomCluster)
+			Expect(err).To(MatchError(ContainSubstring("one of serverRef or serverAddress must be specified")))
+		})
+	})
+
+	Context("Validating update", func() {
+		var updated *stroomv1.StroomCluster
+
+		BeforeEach(func() {
+			updated = stroomCluster.DeepCopy()
+		})
+
+		It("should admit adding NodeSets", func() {
+			updated.Spec.NodeSets = append(updated.Spec.NodeSets, stroomv1.NodeSet{Name: "ingest", Count: 2})
+			_, err := validator.ValidateUpdate(ctx, stroomCluster, updated)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("should admit removing a NodeSet", func() {
+			updated.Spec.NodeSets = updated.Spec.NodeSets[:1]
+			_, err := validator.ValidateUpdate(ctx, stroomCluster, updated)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("should deny removing and adding NodeSets in the same change", func() {
+			updated.Spec.NodeSets = append(updated.Spec.NodeSets[:1], stroomv1.NodeSet{Name: "ui2", Count: 1})
+			updated.Spec.NodeSets = append(updated.Spec.NodeSets, stroomv1.NodeSet{Name: "ingest", Count: 2})
+			_, err := validator.ValidateUpdate(ctx, stroomCluster, updated)
+			Expect(err).To(MatchError(ContainSubstring("NodeSet 'ui' cannot be renamed")))
+		})
+		It("should deny renaming a NodeSet", func() {
+			updated.Spec.NodeSets[1].Name = "frontend"
+			_, err := validator.ValidateUpdate(ctx, stroomCluster, updated)
+			Expect(err).To(MatchError(ContainSubstring("NodeSet 'ui' cannot be renamed")))
+		})
+		It("should deny renaming a NodeSet while reordering the others", func() {
+			updated.Spec.NodeSets[0], updated.Spec.NodeSets[1] = updated.Spec.NodeSets[1], updated.Spec.NodeSets[0]
+			updated.Spec.NodeSets[1].Name = "processing"
+			_, err := validator.ValidateUpdate(ctx, stroomCluster, updated)
+			Expect(err).To(MatchError(ContainSubstring("NodeSet 'data' cannot be renamed")))
+		})
+		It("should deny changing a NodeSet volume claim", func() {
+			updated.Spec.NodeSets[0].LocalDataVolumeClaim.Resources.Requests = corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse("10Gi"),
+			}
+			_, err := validator.ValidateUpdate(ctx, stroomCluster, updated)
+			Expect(err).To(MatchError(ContainSubstring("spec.nodeSets[0].localDataVolumeClaim")))
+		})
+		It("should deny changing the app database name", func() {
+			updated.Spec.AppDatabaseName = "stroom2"
+			_, err := validator.ValidateUpdate(ctx, stroomCluster, updated)
+			Expect(err).To(MatchError(ContainSubstring("spec.appDatabaseName")))
+		})
+	})
+})
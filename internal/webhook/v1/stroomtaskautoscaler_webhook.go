@@ -0,0 +1,107 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var stroomtaskautoscalerlog = logf.Log.WithName("stroomtaskautoscaler-resource")
+
+// SetupStroomTaskAutoscalerWebhookWithManager registers the webhooks for StroomTaskAutoscaler in the manager
+func SetupStroomTaskAutoscalerWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &stroomv1.StroomTaskAutoscaler{}).
+		WithValidator(&StroomTaskAutoscalerCustomValidator{}).
+		WithDefaulter(&StroomTaskAutoscalerCustomDefaulter{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-stroom-gchq-github-io-v1-stroomtaskautoscaler,mutating=true,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=stroomtaskautoscalers,verbs=create;update,versions=v1,name=mstroomtaskautoscaler-v1.kb.io,admissionReviewVersions=v1
+
+// StroomTaskAutoscalerCustomDefaulter sets default values on StroomTaskAutoscaler resources when they are created or updated
+type StroomTaskAutoscalerCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *StroomTaskAutoscalerCustomDefaulter) Default(_ context.Context, autoscaler *stroomv1.StroomTaskAutoscaler) error {
+	stroomtaskautoscalerlog.V(1).Info("Defaulting", "Namespace", autoscaler.Namespace, "Name", autoscaler.Name)
+
+	// A StroomCluster without a namespace is resolved in the namespace of the StroomTaskAutoscaler
+	if autoscaler.Spec.StroomClusterRef.Namespace == "" {
+		autoscaler.Spec.StroomClusterRef.Namespace = autoscaler.Namespace
+	}
+
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-stroom-gchq-github-io-v1-stroomtaskautoscaler,mutating=false,failurePolicy=fail,sideEffects=None,groups=stroom.gchq.github.io,resources=stroomtaskautoscalers,verbs=create;update,versions=v1,name=vstroomtaskautoscaler-v1.kb.io,admissionReviewVersions=v1
+
+// StroomTaskAutoscalerCustomValidator validates StroomTaskAutoscaler resources when they are created or updated
+type StroomTaskAutoscalerCustomValidator struct{}
+
+// ValidateCreate implements admission.Validator
+func (v *StroomTaskAutoscalerCustomValidator) ValidateCreate(_ context.Context, autoscaler *stroomv1.StroomTaskAutoscaler) (admission.Warnings, error) {
+	stroomtaskautoscalerlog.V(1).Info("Validating create", "Namespace", autoscaler.Namespace, "Name", autoscaler.Name)
+
+	return nil, toInvalidError("StroomTaskAutoscaler", autoscaler.Name, validateStroomTaskAutoscalerSpec(&autoscaler.Spec))
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *StroomTaskAutoscalerCustomValidator) ValidateUpdate(_ context.Context, _, autoscaler *stroomv1.StroomTaskAutoscaler) (admission.Warnings, error) {
+	stroomtaskautoscalerlog.V(1).Info("Validating update", "Namespace", autoscaler.Namespace, "Name", autoscaler.Name)
+
+	return nil, toInvalidError("StroomTaskAutoscaler", autoscaler.Name, validateStroomTaskAutoscalerSpec(&autoscaler.Spec))
+}
+
+// ValidateDelete implements admission.Validator
+func (v *StroomTaskAutoscalerCustomValidator) ValidateDelete(_ context.Context, _ *stroomv1.StroomTaskAutoscaler) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateStroomTaskAutoscalerSpec(spec *stroomv1.StroomTaskAutoscalerSpec) field.ErrorList {
+	specPath := field.NewPath("spec")
+	allErrs := field.ErrorList{}
+
+	if spec.StroomClusterRef.Name == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("stroomClusterRef", "name"), "StroomCluster name must be specified"))
+	}
+	if spec.MinCpuPercent < 0 || spec.MinCpuPercent > 100 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("minCpuPercent"), spec.MinCpuPercent, "must be between 0 and 100"))
+	}
+	if spec.MaxCpuPercent < 0 || spec.MaxCpuPercent > 100 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("maxCpuPercent"), spec.MaxCpuPercent, "must be between 0 and 100"))
+	}
+	if spec.MinCpuPercent >= spec.MaxCpuPercent {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("minCpuPercent"), spec.MinCpuPercent,
+			fmt.Sprintf("must be less than maxCpuPercent (%v)", spec.MaxCpuPercent)))
+	}
+	if spec.MinTaskLimit < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("minTaskLimit"), spec.MinTaskLimit, "must not be negative"))
+	}
+	if spec.MinTaskLimit > spec.MaxTaskLimit {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("minTaskLimit"), spec.MinTaskLimit,
+			fmt.Sprintf("must not be greater than maxTaskLimit (%v)", spec.MaxTaskLimit)))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"context"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("StroomTaskAutoscaler webhook", func() {
+
+	var (
+		ctx        = context.Background()
+		validator  StroomTaskAutoscalerCustomValidator
+		defaulter  StroomTaskAutoscalerCustomDefaulter
+		autoscaler *stroomv1.StroomTaskAutoscaler
+	)
+
+	BeforeEach(func() {
+		autoscaler = &stroomv1.StroomTaskAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "stroom"},
+			Spec: stroomv1.StroomTaskAutoscalerSpec{
+				StroomClusterRef: stroomv1.ResourceRef{Name: "dev"},
+				TaskName:         "Data Processor",
+				MinCpuPercent:    50,
+				MaxCpuPercent:    90,
+				MinTaskLimit:     1,
+				MaxTaskLimit:     20,
+			},
+		}
+	})
+
+	It("should resolve the StroomCluster in the StroomTaskAutoscaler namespace", func() {
+		Expect(defaulter.Default(ctx, autoscaler)).To(Succeed())
+		Expect(autoscaler.Spec.StroomClusterRef.Namespace).To(Equal("stroom"))
+	})
+	It("should admit a valid StroomTaskAutoscaler", func() {
+		_, err := validator.ValidateCreate(ctx, autoscaler)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should deny a minimum CPU percentage not less than the maximum", func() {
+		autoscaler.Spec.MinCpuPercent = 90
+		_, err := validator.ValidateCreate(ctx, autoscaler)
+		Expect(err).To(MatchError(ContainSubstring("spec.minCpuPercent")))
+	})
+	It("should deny a minimum task limit greater than the maximum", func() {
+		autoscaler.Spec.MinTaskLimit = 30
+		_, err := validator.ValidateUpdate(ctx, autoscaler, autoscaler)
+		Expect(err).To(MatchError(ContainSubstring("spec.minTaskLimit")))
+	})
+})
@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"regexp"
+
+	stroomv1 "github.com/gradata-systems/stroom-k8s-operator/api/v1"
+	"github.com/robfig/cron/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// databaseNamePattern matches an unquoted MySQL identifier
+var databaseNamePattern = regexp.MustCompile(`^[0-9A-Za-z_$]{1,64}$`)
+
+// validateDatabaseServerRef ensures exactly one of an operator-managed DatabaseServer or an external server address
+// is specified
+func validateDatabaseServerRef(ref *stroomv1.DatabaseServerRef, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	hasServerRef := !ref.ServerRef.IsZero()
+	hasServerAddress := ref.ServerAddress.Host != ""
+	if hasServerRef && hasServerAddress {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only one of serverRef or serverAddress may be specified"))
+	} else if !hasServerRef && !hasServerAddress {
+		allErrs = append(allErrs, field.Required(fldPath, "one of serverRef or serverAddress must be specified"))
+	} else if hasServerRef && ref.ServerRef.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("serverRef", "name"), "DatabaseServer name must be specified"))
+	} else if hasServerAddress {
+		allErrs = append(allErrs, validatePasswordSource(&ref.ServerAddress, fldPath.Child("serverAddress"))...)
+	}
+
+	return allErrs
+}
+
+// validatePasswordSource ensures the password of an external database user is read from one source: the Secret key
+// named after the user, a specific Secret key, or a file
+func validatePasswordSource(address *stroomv1.ServerAddress, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if address.PasswordSecretKeyRef != nil && address.PasswordFile != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only one of passwordSecretKeyRef or passwordFile may be specified"))
+	} else if address.PasswordSecretKeyRef != nil {
+		if address.PasswordSecretKeyRef.Name == "" || address.PasswordSecretKeyRef.Key == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("passwordSecretKeyRef"), "the Secret name and key must be specified"))
+		}
+	} else if address.PasswordFile == nil && address.SecretName == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("secretName"), "a Secret containing the database user password must be specified"))
+	}
+
+	return allErrs
+}
+
+// validateDatabaseNames ensures each database name is a valid MySQL identifier and appears only once
+func validateDatabaseNames(databaseNames []string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	seen := make(map[string]bool)
+	for i, name := range databaseNames {
+		if !databaseNamePattern.MatchString(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), name, "must be a valid MySQL database name"))
+		} else if seen[name] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), name))
+		}
+		seen[name] = true
+	}
+
+	return allErrs
+}
+
+// validateCronSchedule ensures a schedule is in the standard five-field cron format accepted by a CronJob
+func validateCronSchedule(schedule string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if schedule == "" {
+		allErrs = append(allErrs, field.Required(fldPath, "a cron schedule must be specified"))
+	} else if _, err := cron.ParseStandard(schedule); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, schedule, err.Error()))
+	}
+
+	return allErrs
+}
+
+// toInvalidError converts a list of field errors into an API error, or returns nil if there are none
+func toInvalidError(kind string, name string, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(schema.GroupKind{Group: stroomv1.GroupVersion.Group, Kind: kind}, name, allErrs)
+}